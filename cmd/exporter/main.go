@@ -1,20 +1,26 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"regexp"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // scratch イメージでも Asia/Tokyo を解決できるよう tzdata を埋め込む
 
 	"github.com/dghubble/oauth1"
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/metrics"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/server"
@@ -24,6 +30,15 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// Build information, injected at build time:
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
 func main() {
 	_ = godotenv.Load()
 
@@ -34,8 +49,9 @@ func main() {
 	)
 	flag.Parse()
 
-	// Initialize logger
-	logger := initLogger(*debugMode)
+	// Initialize logger (level can be changed at runtime via SIGHUP)
+	logLevel := zap.NewAtomicLevelAt(resolveLogLevel(getEnv("LOG_LEVEL", "info"), *debugMode))
+	logger := initLogger(logLevel)
 	defer logger.Sync()
 
 	// Health check mode
@@ -46,72 +62,322 @@ func main() {
 
 	// Load configuration
 	config := loadConfig()
+	if err := checkInvalidEnv(config, logger); err != nil {
+		logger.Fatal("invalid configuration (STRICT_CONFIG)", zap.Error(err))
+	}
+
+	if err := validateBindAddress(config.BindAddress); err != nil {
+		logger.Fatal("invalid BIND_ADDRESS", zap.Error(err))
+	}
+	if config.MetricsAddress != "" {
+		if err := validateBindAddress(config.MetricsAddress); err != nil {
+			logger.Fatal("invalid METRICS_PORT", zap.Error(err))
+		}
+	}
+	if err := validateRequestTokenStore(config); err != nil {
+		logger.Fatal("invalid request token store configuration", zap.Error(err))
+	}
 
-	// Validate configuration
-	if config.ConsumerKey == "" || config.ConsumerSecret == "" {
+	// Validate configuration (fixture mode does not talk to Zaim)
+	if config.FixtureFile == "" && (config.ConsumerKey == "" || config.ConsumerSecret == "") {
 		logger.Fatal("ZAIM_CONSUMER_KEY and ZAIM_CONSUMER_SECRET must be set")
 	}
 
-	// Initialize token storage
-	tokenStorage, err := auth.NewFileTokenStorage(config.TokenFile, config.EncryptionKey)
-	if err != nil {
-		logger.Fatal("failed to initialize token storage", zap.Error(err))
+	// Initialize token storage (an injected access token bypasses the token file)
+	var tokenStorage auth.TokenStorage
+	if config.AccessToken != "" && config.AccessSecret != "" {
+		tokenStorage = auth.NewEnvTokenStorage(config.AccessToken, config.AccessSecret)
+		logger.Info("using access token from environment")
+	} else {
+		fileStorage, err := auth.NewFileTokenStorage(config.TokenFile, config.EncryptionKey, config.TokenFileFallbacks...)
+		if err != nil {
+			logger.Fatal("failed to initialize token storage", zap.Error(err))
+		}
+		// Fail now rather than with a 500 after the user has authorized on Zaim
+		if err := fileStorage.CheckWritable(); err != nil {
+			logger.Fatal("token file location is not writable; set TOKEN_FILE to a writable path or mount a volume",
+				zap.String("path", config.TokenFile), zap.Strings("fallbacks", config.TokenFileFallbacks), zap.Error(err))
+		}
+		tokenStorage = fileStorage
+	}
+
+	if config.ZaimAPIBaseURL != zaim.DefaultBaseURL {
+		logger.Warn("using non-default Zaim API base URL", zap.String("url", config.ZaimAPIBaseURL))
 	}
 
 	// Initialize OAuth manager
-	oauthMgr := auth.NewManager(config.ConsumerKey, config.ConsumerSecret, tokenStorage, logger)
+	oauthMgr := auth.NewManager(config.ConsumerKey, config.ConsumerSecret, tokenStorage, logger,
+		auth.WithEndpoint(config.OAuthEndpoint),
+	)
+
+	// Single registry shared by the collector manager and the /metrics handler
+	// Everything is registered through registerer, which adds STATIC_LABELS
+	staticLabels, err := metrics.ParseStaticLabels(config.StaticLabels)
+	if err != nil {
+		logger.Fatal("invalid STATIC_LABELS", zap.Error(err))
+	}
+	registry := prometheus.NewRegistry()
+	registerer := prometheus.WrapRegistererWith(staticLabels, registry)
+	registerer.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	buildInfo := metrics.BuildInfo{Version: version, Commit: commit, BuildDate: buildDate}
+	registerer.MustRegister(metrics.NewBuildInfoCollector(buildInfo))
+	logger.Info("build info",
+		zap.String("version", version),
+		zap.String("commit", commit),
+		zap.String("build_date", buildDate),
+	)
+
+	// Always exported so losing Zaim auth can be alerted on before scrapes fail
+	registerer.MustRegister(metrics.NewAuthCollector(oauthMgr))
+
+	modes, err := metrics.ParseModes(config.Modes)
+	if err != nil {
+		logger.Fatal("invalid ZAIM_MODES", zap.Error(err))
+	}
+
+	amountScale, err := metrics.ParseAmountScale(config.AmountScale)
+	if err != nil {
+		logger.Fatal("invalid AMOUNT_SCALE", zap.Error(err))
+	}
+
+	dataScope, err := zaim.ParseDataScope(config.DataScope)
+	if err != nil {
+		logger.Fatal("invalid ZAIM_DATA_SCOPE", zap.Error(err))
+	}
+
+	fetchWindow, err := zaim.ParseFetchWindow(config.FetchWindow)
+	if err != nil {
+		logger.Fatal("invalid ZAIM_FETCH_WINDOW", zap.Error(err))
+	}
+
+	collectorOpts := []metrics.CollectorOption{
+		metrics.WithCacheDuration(config.CacheDuration),
+		metrics.WithMinRefreshInterval(config.MinRefreshInterval),
+		metrics.WithFailureBackoff(config.MaxFailureBackoff),
+		metrics.WithDataHardExpiry(config.DataHardExpiry),
+		metrics.WithGenreMetrics(config.GenreMetrics),
+		metrics.WithNameRefreshInterval(config.NameRefreshInterval),
+		metrics.WithAccountMetrics(config.AccountMetrics),
+		metrics.WithAccountSplit(config.AccountSplit),
+		metrics.WithFetchWindow(fetchWindow),
+		metrics.WithMaxHours(config.HourlyMaxHours),
+		metrics.WithZeroFillHours(config.HourlyZeroFill),
+		metrics.WithStaleThreshold(config.StaleThreshold),
+		metrics.WithBucketTimestamps(config.BucketTimestamps),
+		metrics.WithDailyMetrics(config.DailyMetrics),
+		metrics.WithBackfill(config.BackfillMonths, 0),
+		metrics.WithBackfillConcurrency(config.BackfillConcurrency),
+		metrics.WithBackfillRefreshInterval(config.BackfillRefreshInterval),
+		metrics.WithAmountScale(amountScale),
+		metrics.WithAmountRounding(config.AmountRoundTo),
+	}
+	// Running payment total; persisted when PAYMENT_TOTALS_FILE is set
+	var paymentTotalsStore storage.PaymentTotalsStore
+	if config.PaymentTotalsFile != "" {
+		paymentTotalsStore = storage.NewFilePaymentTotalsStore(config.PaymentTotalsFile)
+	}
+	paymentCounter, err := metrics.NewPaymentCounter(paymentTotalsStore, logger)
+	if err != nil {
+		logger.Fatal("failed to load payment totals", zap.String("path", config.PaymentTotalsFile), zap.Error(err))
+	}
+	collectorOpts = append(collectorOpts, metrics.WithPaymentCounter(paymentCounter))
+
+	excludeNames, err := metrics.CompileNamePatterns(config.ExcludeNamePatterns)
+	if err != nil {
+		logger.Fatal("invalid EXCLUDE_NAME_PATTERNS", zap.Error(err))
+	}
+	collectorOpts = append(collectorOpts, metrics.WithExcludeNames(excludeNames))
+
+	if config.CommentTagRegex != "" {
+		pattern, err := regexp.Compile(config.CommentTagRegex)
+		if err != nil {
+			logger.Fatal("invalid COMMENT_TAG_REGEX", zap.Error(err))
+		}
+		collectorOpts = append(collectorOpts, metrics.WithCommentTags(pattern, config.CommentTagMax))
+	}
+
+	// Assigned below; the handler only runs after a fetch, by which time it is set
+	var metricsManager *metrics.Manager
+	if config.ClearTokenOnUnauthorized {
+		collectorOpts = append(collectorOpts, metrics.WithUnauthorizedHandler(func() {
+			// Revoked token: show "Not authenticated" until OAuth is re-run
+			if err := oauthMgr.ResetAuth(); err != nil {
+				logger.Error("failed to clear rejected Zaim token", zap.Error(err))
+				return
+			}
+			metricsManager.UnregisterCollector()
+			logger.Warn("cleared rejected Zaim token, re-authenticate via /zaim/auth")
+		}))
+	}
+
+	if config.AuthLostWebhookURL != "" {
+		notifier := metrics.NewAuthLostNotifier(config.AuthLostWebhookURL, logger)
+		collectorOpts = append(collectorOpts, metrics.WithUnauthorizedHandler(notifier.Notify))
+	}
+
+	todayInclude, err := metrics.ParseCategoryIDs(config.TodayIncludeCategories)
+	if err != nil {
+		logger.Fatal("invalid TODAY_INCLUDE_CATEGORIES", zap.Error(err))
+	}
+	todayExclude, err := metrics.ParseCategoryIDs(config.TodayExcludeCategories)
+	if err != nil {
+		logger.Fatal("invalid TODAY_EXCLUDE_CATEGORIES", zap.Error(err))
+	}
+
+	aggregator := metrics.NewAggregator(
+		metrics.WithLocation(zaim.LoadLocation(logger)),
+		metrics.WithModes(modes...),
+		metrics.WithTodayCategories(todayInclude, todayExclude),
+		metrics.WithMonthlyBudget(config.MonthlyBudget, config.CategoryBudgets),
+		metrics.WithProjectionMinDays(config.ProjectionMinDays),
+	)
+	// Root context cancelled on shutdown; stops background refreshes and
+	// aborts in-flight Zaim requests
+	rootCtx, stopRoot := context.WithCancel(context.Background())
+	defer stopRoot()
+
+	metricsManager = metrics.NewManager(dataScopeRegisterer(registerer, dataScope), logger,
+		metrics.WithRootContext(rootCtx),
+		metrics.WithBackgroundRefresh(config.BackgroundRefresh),
+		metrics.WithPolling(config.PollInterval),
+		metrics.WithAggregator(aggregator),
+		metrics.WithCollectorOptions(collectorOpts...),
+	)
+
+	// Zaim clients are built from the stored access token, both at startup
+	// and after the OAuth callback completes
+	oauthConfig := &oauth1.Config{
+		ConsumerKey:    config.ConsumerKey,
+		ConsumerSecret: config.ConsumerSecret,
+	}
+	newFetcher := func(token *oauth1.Token) zaim.TransactionFetcher {
+		return zaim.NewClient(oauthConfig, token, logger,
+			zaim.WithTimeout(config.ZaimHTTPTimeout),
+			zaim.WithBaseURL(config.ZaimAPIBaseURL),
+			zaim.WithDataScope(dataScope),
+			zaim.WithMaxResponseSize(int64(config.ZaimMaxResponseSize)),
+			zaim.WithClockSkewThreshold(config.ClockSkewThreshold),
+			zaim.WithRateLimit(config.RateLimit, config.RateLimitBurst),
+			zaim.WithRateLimitFailFast(config.RateLimitFailFast),
+		)
+	}
 
 	// Initialize Zaim client if authenticated
-	if oauthMgr.IsAuthenticated() {
+	if config.FixtureFile != "" {
+		// Fixture mode: serve metrics from a local JSON file without OAuth
+		// Fixture data is not dated around the clock, so keep every hour
+		if err := metricsManager.RegisterCollector(zaim.NewFixtureFetcher(config.FixtureFile, logger), metrics.WithHourlyWindow(false)); err != nil {
+			logger.Fatal("failed to register fixture collector", zap.Error(err))
+		}
+		logger.Warn("serving metrics from fixture file, Zaim API is not used", zap.String("path", config.FixtureFile))
+	} else if oauthMgr.IsAuthenticated() {
 		token, err := oauthMgr.GetClient(context.Background())
 		if err == nil {
-			oauthConfig := &oauth1.Config{
-				ConsumerKey:    config.ConsumerKey,
-				ConsumerSecret: config.ConsumerSecret,
+			// Only the collector created at process start is jittered; one
+			// created after the OAuth callback fetches right away
+			if err := metricsManager.RegisterCollector(newFetcher(token), metrics.WithStartupJitter(config.StartupJitter)); err != nil {
+				logger.Error("failed to register Zaim metrics collector", zap.Error(err))
 			}
-			zaimClient := zaim.NewClient(oauthConfig, token, logger)
-			aggregator := metrics.NewAggregator()
-			collector := metrics.NewZaimCollector(zaimClient, aggregator, logger)
-			prometheus.MustRegister(collector)
-			logger.Info("registered Zaim metrics collector")
 		} else {
 			logger.Warn("failed to initialize Zaim client", zap.Error(err))
 		}
 	} else {
-		logger.Warn("not authenticated with Zaim API, metrics will not be available")
+		logger.Warn("not authenticated with Zaim API, metrics will be available after OAuth")
 	}
 
 	// Initialize request token store
 	var requestTokenStore storage.RequestTokenStore
 	if redisURL := config.RedisURL; redisURL != "" {
-		store, err := storage.NewRedisRequestTokenStore(redisURL, 10*time.Minute, logger)
+		// Request secrets are encrypted at rest when ENCRYPTION_KEY is set
+		encryptionKey, err := auth.ParseEncryptionKey(config.EncryptionKey)
+		if err != nil {
+			logger.Fatal("invalid encryption key", zap.Error(err))
+		}
+		store, err := storage.NewRedisRequestTokenStore(redisURL, config.OAuthTokenTTL, logger,
+			storage.WithEncryptionKey(encryptionKey),
+			storage.WithRedisTuning(config.RedisTuning),
+		)
 		if err != nil {
 			logger.Fatal("failed to initialize redis store", zap.Error(err))
 		}
-		defer store.Close()
+		// zaim_redis_up reflects the store's background health check
+		registerer.MustRegister(store)
 		requestTokenStore = store
 		logger.Info("using redis for request token storage")
 	} else {
-		requestTokenStore = storage.NewMemoryRequestTokenStore(logger)
+		store := storage.NewMemoryRequestTokenStore(logger, storage.WithTokenTTL(config.OAuthTokenTTL))
+		// zaim_pending_request_tokens shows OAuth flows that never completed
+		registerer.MustRegister(store)
+		requestTokenStore = store
 		logger.Warn("using in-memory request token storage (not suitable for multiple instances)")
 	}
+	defer requestTokenStore.Close()
+
+	// Push to a Pushgateway when the exporter cannot be scraped
+	pushDone := make(chan struct{})
+	if config.PushgatewayURL != "" {
+		pusher := metrics.NewPusher(config.PushgatewayURL, config.PushgatewayJob, registry, config.PushgatewayInterval, logger)
+		go func() {
+			defer close(pushDone)
+			pusher.Run(rootCtx)
+		}()
+		logger.Info("pushing metrics to pushgateway",
+			zap.String("url", config.PushgatewayURL),
+			zap.String("job", config.PushgatewayJob),
+			zap.Duration("interval", config.PushgatewayInterval))
+	} else {
+		close(pushDone)
+	}
+
+	trustedProxies, err := server.ParseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		logger.Fatal("invalid TRUSTED_PROXY", zap.Error(err))
+	}
+
+	if config.AdminToken != "" && config.EncryptionKey == "" {
+		logger.Warn("token export is enabled without ENCRYPTION_KEY; /zaim/auth/export returns the access token in plaintext")
+	}
 
 	// Initialize HTTP server
-	srv := server.NewServer(oauthMgr, requestTokenStore, logger)
+	srv := server.NewServer(oauthMgr, requestTokenStore, metricsManager, registry, logger,
+		server.WithFetcherFactory(newFetcher),
+		server.WithHTTPMetrics(registerer),
+		server.WithBuildInfo(buildInfo),
+		server.WithCORSAllowedOrigins(config.CORSAllowedOrigins...),
+		server.WithBasePath(config.BasePath),
+		server.WithTrustedProxies(trustedProxies),
+		server.WithDebugEndpoints(config.DebugEndpoints),
+		server.WithUI(config.UIEnabled),
+		server.WithAdminToken(config.AdminToken),
+		server.WithSeparateMetrics(config.MetricsAddress != ""),
+	)
 
-	httpServer := &http.Server{
-		Addr:         fmt.Sprintf(":%d", config.Port),
-		Handler:      srv.Router(),
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	// With METRICS_PORT /metrics moves to a second listener
+	httpServers := []*http.Server{newHTTPServer(config.BindAddress, srv.Router())}
+	if config.MetricsAddress != "" {
+		httpServers = append(httpServers, newHTTPServer(config.MetricsAddress, srv.MetricsRouter()))
 	}
 
-	// Start server in goroutine
+	// Start servers in goroutines
+	for _, httpServer := range httpServers {
+		go func() {
+			logger.Info("starting server", zap.String("address", httpServer.Addr))
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("server failed", zap.String("address", httpServer.Addr), zap.Error(err))
+			}
+		}()
+	}
+
+	// Reload runtime-tunable settings on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		logger.Info("starting server", zap.Int("port", config.Port))
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("server failed", zap.Error(err))
+		for range hup {
+			reloadConfig(logger, logLevel, *debugMode, metricsManager)
 		}
 	}()
 
@@ -126,10 +392,18 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := httpServer.Shutdown(ctx); err != nil {
-		logger.Fatal("server forced to shutdown", zap.Error(err))
+	for _, httpServer := range httpServers {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Fatal("server forced to shutdown", zap.String("address", httpServer.Addr), zap.Error(err))
+		}
 	}
 
+	// Stop the collector and background fetches before the deferred store
+	// Close calls run
+	metricsManager.Close()
+	stopRoot()
+	<-pushDone
+
 	logger.Info("server exited")
 }
 
@@ -140,31 +414,284 @@ type Config struct {
 	TokenFile      string
 	EncryptionKey  string
 
+	// TokenFileFallbacks are extra token file paths, written alongside
+	// TokenFile; the most recently written one that can be read is loaded
+	TokenFileFallbacks []string
+
+	// AccessToken/AccessSecret inject an already-obtained access token,
+	// replacing the token file (no interactive OAuth needed)
+	AccessToken  string
+	AccessSecret string
+
+	// OAuthTokenTTL is how long a started OAuth flow may take to complete
+	OAuthTokenTTL time.Duration
+
+	// OAuthEndpoint overrides Zaim's OAuth URLs (non-production only; empty fields use defaults)
+	OAuthEndpoint oauth1.Endpoint
+
+	// Zaim API client
+	ZaimHTTPTimeout time.Duration
+
+	// ZaimMaxResponseSize caps the bytes read from one Zaim response
+	ZaimMaxResponseSize int
+
+	// ClockSkewThreshold is the local/Zaim clock difference that is logged as a warning
+	ClockSkewThreshold time.Duration
+
+	// RateLimit caps Zaim requests per second (0 = unlimited) with RateLimitBurst
+	// requests allowed at once; RateLimitFailFast fails instead of waiting
+	RateLimit         float64
+	RateLimitBurst    int
+	RateLimitFailFast bool
+
+	// CacheDuration is how long fetched transactions are reused (reloadable)
+	CacheDuration time.Duration
+
+	// MinRefreshInterval is the floor between Zaim API fetches
+	MinRefreshInterval time.Duration
+
+	// MaxFailureBackoff caps the wait between fetches while Zaim keeps failing (0 = no backoff)
+	MaxFailureBackoff time.Duration
+
+	// DataHardExpiry is how long the last good data is served while fetches fail (0 = forever)
+	DataHardExpiry time.Duration
+
+	// StaleThreshold is the data age at which zaim_data_stale turns 1 (0 = 2x cache duration)
+	StaleThreshold time.Duration
+
+	// StartupJitter caps the random delay before the first Zaim fetch
+	StartupJitter time.Duration
+
+	// BucketTimestamps stamps hourly/daily samples with their bucket time
+	BucketTimestamps bool
+
+	// DailyMetrics emits per-day amount/count gauges
+	DailyMetrics bool
+
+	// HourlyMaxHours limits hourly series to the most recent hours (0 = all)
+	HourlyMaxHours int
+
+	// HourlyZeroFill emits zero-valued hourly series for hours without transactions
+	HourlyZeroFill bool
+
+	// ZaimAPIBaseURL overrides the Zaim API base URL (mock servers, mirrors)
+	ZaimAPIBaseURL string
+
+	// DataScope selects the personal ("home") or shared ("group") ledger
+	DataScope string
+
+	// FetchWindow is "month" (default) or a rolling day count such as "30d"
+	FetchWindow string
+
+	// Modes limits aggregation to these comma-separated modes (empty = all)
+	Modes string
+
+	// StaticLabels are name=value pairs added to every metric, e.g. "household=smith"
+	StaticLabels string
+
+	// AmountScale lists per-currency amount factors, e.g. "USD=0.01"
+	AmountScale string
+	// AmountRoundTo rounds exported amounts to the nearest multiple (0 = exact)
+	AmountRoundTo float64
+
+	// GenreMetrics enables the per-genre payment breakdown (higher cardinality)
+	GenreMetrics bool
+
+	// NameRefreshInterval is how long genre and category names are cached
+	NameRefreshInterval time.Duration
+
+	// AccountMetrics enables the per-account payment breakdown (higher cardinality)
+	AccountMetrics bool
+
+	// AccountSplit enables the per-account monthly flows and zaim_total_net_worth_change
+	AccountSplit bool
+
+	// BackgroundRefresh refreshes transactions on a timer instead of during scrapes
+	BackgroundRefresh bool
+
+	// PollInterval > 0 serves metrics from gauges updated by a poller
+	PollInterval time.Duration
+
+	// PaymentTotalsFile persists zaim_payment_amount_total ("" = memory only)
+	PaymentTotalsFile string
+
+	// BackfillMonths fetches this many prior months after startup/auth
+	BackfillMonths int
+
+	// BackfillConcurrency is how many backfill months are fetched in parallel
+	BackfillConcurrency int
+
+	// BackfillRefreshInterval refetches the backfilled months (0 = once)
+	BackfillRefreshInterval time.Duration
+
+	// AuthLostWebhookURL receives a POST when Zaim starts rejecting the token ("" = disabled)
+	AuthLostWebhookURL string
+
+	// ClearTokenOnUnauthorized drops the stored token when Zaim answers 401
+	ClearTokenOnUnauthorized bool
+
+	// ExcludeNamePatterns drop transactions by name before aggregation
+	ExcludeNamePatterns []string
+
+	// TodayIncludeCategories / TodayExcludeCategories filter zaim_today_total_amount by category ID
+	TodayIncludeCategories []string
+	TodayExcludeCategories []string
+
+	// MonthlyBudget / CategoryBudgets (by category ID) feed zaim_budget_remaining_amount (0 / empty = none)
+	MonthlyBudget   int
+	CategoryBudgets map[int]int
+
+	// ProjectionMinDays is the first day of the month zaim_projected_month_total_amount is emitted on
+	ProjectionMinDays int
+
+	// CommentTagRegex extracts tags from transaction comments (empty = disabled)
+	CommentTagRegex string
+	CommentTagMax   int
+
+	// LogLevel is debug, info, warn or error (reloadable)
+	LogLevel string
+
+	// FixtureFile serves metrics from a JSON file instead of the Zaim API
+	FixtureFile string
+
 	// Redis configuration components
 	RedisHost     string
 	RedisPort     int
 	RedisPassword string
 	RedisDB       int
-	RedisURL      string  // Constructed or explicitly provided
+	RedisURL      string // Constructed or explicitly provided
+	RedisTuning   storage.RedisTuning
+	// RequireRedis refuses to start without Redis instead of falling back to memory
+	RequireRedis bool
+
+	Port int
+
+	// CORSAllowedOrigins may read the JSON API endpoints from a browser ("*" = any)
+	CORSAllowedOrigins []string
+
+	// DebugEndpoints enables GET /debug/fetch
+	DebugEndpoints bool
+
+	// UIEnabled serves the HTML root page; false returns JSON only
+	UIEnabled bool
+
+	// AdminToken enables the token export/import endpoints ("" = disabled)
+	AdminToken string
+
+	// Pushgateway push mode ("" URL = disabled)
+	PushgatewayURL      string
+	PushgatewayJob      string
+	PushgatewayInterval time.Duration
+
+	// BasePath prefixes every route when served under a reverse-proxy subpath
+	BasePath string
+
+	// TrustedProxies are the IPs/CIDRs whose forwarding headers are honored (empty = any)
+	TrustedProxies []string
+
+	// BindAddress is the host:port to listen on; defaults to ":<Port>" (all interfaces)
+	BindAddress string
+	// MetricsAddress serves /metrics on its own listener (":<METRICS_PORT>"; "" = on BindAddress)
+	MetricsAddress string
 
-	Port          int
+	// StrictConfig refuses to start when a variable in InvalidEnv was set
+	StrictConfig bool
+	// InvalidEnv lists the variables that could not be parsed (defaults used)
+	InvalidEnv []invalidEnv
 }
 
 func loadConfig() *Config {
+	var env envLoader
+
 	cfg := &Config{
-		ConsumerKey:    getEnv("ZAIM_CONSUMER_KEY", ""),
-		ConsumerSecret: getEnv("ZAIM_CONSUMER_SECRET", ""),
-		CallbackURL:    getEnv("ZAIM_CALLBACK_URL", "http://localhost:8080/zaim/auth/callback"),
-		TokenFile:      getEnv("TOKEN_FILE", "/data/oauth_tokens.json"),
-		EncryptionKey:  getSecretOrEnv("ENCRYPTION_KEY", ""),
+		ConsumerKey:        getEnv("ZAIM_CONSUMER_KEY", ""),
+		ConsumerSecret:     getEnv("ZAIM_CONSUMER_SECRET", ""),
+		CallbackURL:        getEnv("ZAIM_CALLBACK_URL", "http://localhost:8080/zaim/auth/callback"),
+		TokenFile:          getEnv("TOKEN_FILE", "/data/oauth_tokens.json"),
+		TokenFileFallbacks: getEnvList("TOKEN_FILE_FALLBACK"),
+		EncryptionKey:      getSecretOrEnv("ENCRYPTION_KEY", ""),
+		AccessToken:        getSecretOrEnv("ZAIM_ACCESS_TOKEN", ""),
+		AccessSecret:       getSecretOrEnv("ZAIM_ACCESS_SECRET", ""),
+
+		OAuthTokenTTL: cmp.Or(env.getDuration("OAUTH_TOKEN_TTL", storage.DefaultRequestTokenTTL), storage.DefaultRequestTokenTTL),
+
+		OAuthEndpoint: oauth1.Endpoint{
+			RequestTokenURL: getEnv("ZAIM_REQUEST_TOKEN_URL", ""),
+			AuthorizeURL:    getEnv("ZAIM_AUTHORIZE_URL", ""),
+			AccessTokenURL:  getEnv("ZAIM_ACCESS_TOKEN_URL", ""),
+		},
+
+		ZaimHTTPTimeout:          cmp.Or(env.getDuration("ZAIM_HTTP_TIMEOUT", zaim.DefaultTimeout), zaim.DefaultTimeout),
+		ZaimMaxResponseSize:      env.getInt("ZAIM_MAX_RESPONSE_SIZE", zaim.DefaultMaxResponseSize),
+		ClockSkewThreshold:       cmp.Or(env.getDuration("CLOCK_SKEW_THRESHOLD", zaim.DefaultClockSkewThreshold), zaim.DefaultClockSkewThreshold),
+		RateLimit:                env.getFloat("ZAIM_RATE_LIMIT", 0),
+		RateLimitBurst:           env.getInt("ZAIM_RATE_LIMIT_BURST", 1),
+		RateLimitFailFast:        env.getBool("ZAIM_RATE_LIMIT_FAIL_FAST", false),
+		FixtureFile:              getEnv("FIXTURE_FILE", ""),
+		CacheDuration:            cmp.Or(env.getDuration("ZAIM_CACHE_DURATION", metrics.DefaultCacheDuration), metrics.DefaultCacheDuration),
+		MinRefreshInterval:       env.getDuration("ZAIM_MIN_REFRESH_INTERVAL", metrics.DefaultMinRefreshInterval),
+		MaxFailureBackoff:        env.getDuration("ZAIM_MAX_FAILURE_BACKOFF", metrics.DefaultMaxFailureBackoff),
+		DataHardExpiry:           env.getDuration("ZAIM_DATA_HARD_EXPIRY", metrics.DefaultDataHardExpiry),
+		StaleThreshold:           env.getDuration("STALE_THRESHOLD", 0),
+		StartupJitter:            env.getDuration("STARTUP_JITTER", 30*time.Second),
+		LogLevel:                 getEnv("LOG_LEVEL", "info"),
+		ZaimAPIBaseURL:           getEnv("ZAIM_API_BASE_URL", zaim.DefaultBaseURL),
+		FetchWindow:              getEnv("ZAIM_FETCH_WINDOW", "month"),
+		DataScope:                getEnv("ZAIM_DATA_SCOPE", zaim.ScopeHome),
+		HourlyMaxHours:           env.getInt("ZAIM_HOURLY_MAX_HOURS", 0),
+		HourlyZeroFill:           env.getBool("ZAIM_HOURLY_ZERO_FILL", false),
+		DailyMetrics:             env.getBool("ZAIM_DAILY_METRICS", false),
+		BucketTimestamps:         env.getBool("ZAIM_BUCKET_TIMESTAMPS", false),
+		Modes:                    getEnv("ZAIM_MODES", ""),
+		StaticLabels:             getEnv("STATIC_LABELS", ""),
+		AmountScale:              getEnv("AMOUNT_SCALE", ""),
+		AmountRoundTo:            env.getFloat("AMOUNT_ROUND_TO", 0),
+		GenreMetrics:             env.getBool("ZAIM_GENRE_METRICS", false),
+		NameRefreshInterval:      cmp.Or(env.getDuration("ZAIM_NAME_REFRESH_INTERVAL", metrics.DefaultNameRefreshInterval), metrics.DefaultNameRefreshInterval),
+		AccountMetrics:           env.getBool("ZAIM_ACCOUNT_METRICS", false),
+		AccountSplit:             env.getBool("ZAIM_ACCOUNT_SPLIT", false),
+		BackgroundRefresh:        env.getBool("ZAIM_BACKGROUND_REFRESH", false),
+		PollInterval:             env.getDuration("ZAIM_POLL_INTERVAL", 0),
+		BackfillMonths:           env.getInt("BACKFILL_MONTHS", 0),
+		BackfillConcurrency:      env.getInt("BACKFILL_CONCURRENCY", metrics.DefaultBackfillConcurrency),
+		BackfillRefreshInterval:  env.getDuration("BACKFILL_REFRESH_INTERVAL", metrics.DefaultBackfillRefreshInterval),
+		PaymentTotalsFile:        getEnv("PAYMENT_TOTALS_FILE", ""),
+		ClearTokenOnUnauthorized: env.getBool("ZAIM_CLEAR_TOKEN_ON_UNAUTHORIZED", false),
+		AuthLostWebhookURL:       getSecretOrEnv("AUTH_LOST_WEBHOOK_URL", ""),
+		ExcludeNamePatterns:      getEnvList("EXCLUDE_NAME_PATTERNS"),
+		TodayIncludeCategories:   getEnvList("TODAY_INCLUDE_CATEGORIES"),
+		TodayExcludeCategories:   getEnvList("TODAY_EXCLUDE_CATEGORIES"),
+		MonthlyBudget:            env.getInt("MONTHLY_BUDGET", 0),
+		ProjectionMinDays:        env.getInt("PROJECTION_MIN_DAYS", metrics.DefaultProjectionMinDays),
+		CategoryBudgets:          env.getCategoryBudgets("MONTHLY_BUDGET_CAT_"),
+		CommentTagRegex:          getEnv("COMMENT_TAG_REGEX", ""),
+		CommentTagMax:            env.getInt("COMMENT_TAG_MAX", metrics.DefaultMaxCommentTags),
 
 		// Redis components (password auto-loaded from secrets)
 		RedisHost:     getEnv("REDIS_HOST", "redis"),
-		RedisPort:     getEnvInt("REDIS_PORT", 6379),
+		RedisPort:     env.getInt("REDIS_PORT", 6379),
 		RedisPassword: getSecretOrEnv("REDIS_PASSWORD", ""),
-		RedisDB:       getEnvInt("REDIS_DB", 0),
+		RedisDB:       env.getInt("REDIS_DB", 0),
+		RedisTuning: storage.RedisTuning{
+			PoolSize:    env.getInt("REDIS_POOL_SIZE", 0),
+			DialTimeout: env.getDuration("REDIS_DIAL_TIMEOUT", 0),
+			ReadTimeout: env.getDuration("REDIS_READ_TIMEOUT", 0),
+		},
 
-		Port:          getEnvInt("PORT", 8080),
+		Port:           env.getInt("PORT", 8080),
+		BindAddress:    bindAddress(getEnv("BIND_ADDRESS", ""), env.getInt("PORT", 8080)),
+		MetricsAddress: metricsAddress(env.getInt("METRICS_PORT", 0)),
+
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS"),
+		DebugEndpoints:     env.getBool("ENABLE_DEBUG_ENDPOINTS", false),
+		UIEnabled:          env.getBool("UI_ENABLED", true),
+		AdminToken:         getSecretOrEnv("ADMIN_TOKEN", ""),
+		BasePath:           server.NormalizeBasePath(getEnv("BASE_PATH", "")),
+		TrustedProxies:     getEnvList("TRUSTED_PROXY"),
+
+		PushgatewayURL:      getEnv("PUSHGATEWAY_URL", ""),
+		PushgatewayJob:      getEnv("PUSHGATEWAY_JOB", metrics.DefaultPushJob),
+		PushgatewayInterval: cmp.Or(env.getDuration("PUSHGATEWAY_INTERVAL", metrics.DefaultPushInterval), metrics.DefaultPushInterval),
 	}
 
 	// REDIS_URL priority:
@@ -176,9 +703,121 @@ func loadConfig() *Config {
 		cfg.RedisURL = buildRedisURL(cfg.RedisHost, cfg.RedisPort, cfg.RedisPassword, cfg.RedisDB)
 	}
 
+	cfg.RequireRedis = env.getBool("REQUIRE_REDIS", false)
+	cfg.StrictConfig = env.getBool("STRICT_CONFIG", false)
+	cfg.InvalidEnv = env.invalid
 	return cfg
 }
 
+// invalidEnv is an environment variable that could not be parsed, so its
+// default was used instead
+type invalidEnv struct {
+	Key     string
+	Value   string
+	Default string
+}
+
+// envLoader parses typed environment variables for loadConfig, collecting
+// the ones that could not be parsed instead of failing on the first
+type envLoader struct {
+	invalid []invalidEnv
+}
+
+// reject notes that key's value was rejected in favour of fallback
+// A variable read more than once (e.g. PORT) is recorded once
+func (l *envLoader) reject(key, value string, fallback any) {
+	for _, entry := range l.invalid {
+		if entry.Key == key {
+			return
+		}
+	}
+	l.invalid = append(l.invalid, invalidEnv{Key: key, Value: value, Default: fmt.Sprint(fallback)})
+}
+
+// checkInvalidEnv logs every variable loadConfig could not parse with its raw
+// value and the default applied. With STRICT_CONFIG it returns an error
+// listing them instead, so the exporter refuses to start misconfigured
+func checkInvalidEnv(config *Config, logger *zap.Logger) error {
+	if len(config.InvalidEnv) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(config.InvalidEnv))
+	for _, entry := range config.InvalidEnv {
+		keys = append(keys, fmt.Sprintf("%s=%q", entry.Key, entry.Value))
+		if !config.StrictConfig {
+			logger.Warn("ignoring invalid environment variable, using default",
+				zap.String("key", entry.Key),
+				zap.String("value", entry.Value),
+				zap.String("default", entry.Default))
+		}
+	}
+	if config.StrictConfig {
+		return fmt.Errorf("invalid environment variables: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries
+// A comma escaped as "\," stays part of the entry (e.g. in a regex "{2\,3}")
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range splitList(getEnv(key, "")) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// splitList splits value at commas not preceded by a backslash and turns
+// each "\," into ","
+func splitList(value string) []string {
+	var (
+		values  []string
+		current strings.Builder
+	)
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ',':
+			current.WriteByte(',')
+			i++
+		case value[i] == ',':
+			values = append(values, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+	return append(values, current.String())
+}
+
+// getCategoryBudgets reads <prefix><category ID>=<amount> variables, e.g.
+// MONTHLY_BUDGET_CAT_101=30000; entries with a non-numeric ID or amount are
+// ignored (and reported as invalid)
+func (l *envLoader) getCategoryBudgets(prefix string) map[int]int {
+	budgets := make(map[int]int)
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		suffix, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		categoryID, err := strconv.Atoi(suffix)
+		if err != nil {
+			l.reject(key, value, "ignored")
+			continue
+		}
+		amount, err := strconv.Atoi(value)
+		if err != nil {
+			l.reject(key, value, "ignored")
+			continue
+		}
+		budgets[categoryID] = amount
+	}
+	return budgets
+}
+
 // getSecretOrEnv: Docker Secrets (/run/secrets/) を優先、次に環境変数を確認
 func getSecretOrEnv(key, fallback string) string {
 	// Docker Secrets: /run/secrets/<key_lowercase>
@@ -200,11 +839,47 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func getEnvInt(key string, fallback int) int {
+func (l *envLoader) getInt(key string, fallback int) int {
 	if value := os.Getenv(key); value != "" {
 		if i, err := strconv.Atoi(value); err == nil {
 			return i
 		}
+		l.reject(key, value, fallback)
+	}
+	return fallback
+}
+
+// getFloat parses a decimal number (e.g. "0.5"); invalid values use the fallback
+func (l *envLoader) getFloat(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+		l.reject(key, value, fallback)
+	}
+	return fallback
+}
+
+// getBool parses strconv.ParseBool values ("true", "1", ...); invalid values use the fallback
+func (l *envLoader) getBool(key string, fallback bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+		l.reject(key, value, fallback)
+	}
+	return fallback
+}
+
+// getDuration parses a Go duration (e.g. "10s"); invalid or negative values
+// use the fallback. An explicit zero is returned as 0 for settings where it
+// means "off"; wrap with cmp.Or where 0 selects the default instead
+func (l *envLoader) getDuration(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+			return d
+		}
+		l.reject(key, value, fallback)
 	}
 	return fallback
 }
@@ -217,11 +892,39 @@ func buildRedisURL(host string, port int, password string, db int) string {
 	return fmt.Sprintf("redis://%s:%d/%d", host, port, db)
 }
 
-func initLogger(debug bool) *zap.Logger {
-	config := zap.NewProductionConfig()
+// reloadConfig re-reads .env and the environment and applies the settings
+// that can change at runtime: log level and collector cache duration
+// Consumer keys, ports and storage settings still require a restart
+func reloadConfig(logger *zap.Logger, level zap.AtomicLevel, debug bool, metricsManager *metrics.Manager) {
+	_ = godotenv.Overload()
+	config := loadConfig()
+	// Running instances keep going; strict mode only applies at startup
+	config.StrictConfig = false
+	_ = checkInvalidEnv(config, logger)
+
+	level.SetLevel(resolveLogLevel(config.LogLevel, debug))
+	metricsManager.SetCacheDuration(config.CacheDuration)
+
+	logger.Info("reloaded configuration",
+		zap.Stringer("log_level", level.Level()),
+		zap.Duration("cache_duration", config.CacheDuration))
+}
+
+// resolveLogLevel parses LOG_LEVEL; the -debug flag always wins
+func resolveLogLevel(name string, debug bool) zapcore.Level {
 	if debug {
-		config.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+		return zapcore.DebugLevel
+	}
+	level, err := zapcore.ParseLevel(name)
+	if err != nil {
+		return zapcore.InfoLevel
 	}
+	return level
+}
+
+func initLogger(level zap.AtomicLevel) *zap.Logger {
+	config := zap.NewProductionConfig()
+	config.Level = level
 
 	// Output to stdout
 	config.OutputPaths = []string{"stdout"}
@@ -239,19 +942,104 @@ func initLogger(debug bool) *zap.Logger {
 	return logger
 }
 
-func runHealthCheck(logger *zap.Logger) {
-	resp, err := http.Get("http://localhost:8080/health")
+// bindAddress returns the listen address, falling back to all interfaces on port
+func bindAddress(address string, port int) string {
+	if address == "" {
+		return fmt.Sprintf(":%d", port)
+	}
+	return address
+}
+
+// dataScopeRegisterer labels the Zaim data metrics scope="group" when reading
+// the shared ledger. The default personal ledger adds no label, so existing
+// series and dashboards keep working
+func dataScopeRegisterer(registerer prometheus.Registerer, scope string) prometheus.Registerer {
+	if scope != zaim.ScopeGroup {
+		return registerer
+	}
+	return prometheus.WrapRegistererWith(prometheus.Labels{"scope": scope}, registerer)
+}
+
+// validateRequestTokenStore rejects REQUIRE_REDIS without a Redis URL. The
+// in-memory fallback breaks OAuth when callbacks reach another replica, so
+// deployments that depend on Redis fail at startup instead
+// (an unreachable Redis already fails NewRedisRequestTokenStore)
+func validateRequestTokenStore(config *Config) error {
+	if config.RequireRedis && config.RedisURL == "" {
+		return errors.New("REQUIRE_REDIS is set but no Redis is configured; set REDIS_URL or REDIS_HOST and REDIS_PASSWORD")
+	}
+	return nil
+}
+
+// metricsAddress returns the listen address of the metrics port, or "" when
+// port is 0 and /metrics stays on the main port
+func metricsAddress(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return fmt.Sprintf(":%d", port)
+}
+
+// newHTTPServer returns a server for handler on address with the exporter's timeouts
+func newHTTPServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         address,
+		Handler:      handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+}
+
+// validateBindAddress checks that address parses as host:port
+func validateBindAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
 	if err != nil {
-		logger.Error("health check failed", zap.Error(err))
-		os.Exit(1)
+		return fmt.Errorf("invalid bind address %q: %w", address, err)
 	}
-	defer resp.Body.Close()
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Errorf("invalid port in bind address %q", address)
+	}
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		logger.Error("health check failed", zap.Int("status", resp.StatusCode))
+// healthCheckURL returns the /livez URL (under basePath) of a server listening on address
+// Liveness is used so a Redis or token storage outage does not get the
+// container restarted. Wildcard hosts (all interfaces) are reached via localhost
+func healthCheckURL(address, basePath string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "http://localhost:8080" + basePath + "/livez"
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s%s/livez", net.JoinHostPort(host, port), basePath)
+}
+
+func runHealthCheck(logger *zap.Logger) {
+	var env envLoader
+	url := healthCheckURL(bindAddress(getEnv("BIND_ADDRESS", ""), env.getInt("PORT", 8080)), server.NormalizeBasePath(getEnv("BASE_PATH", "")))
+	if err := checkHealth(url); err != nil {
+		logger.Error("health check failed", zap.String("url", url), zap.Error(err))
 		os.Exit(1)
 	}
 
 	logger.Info("health check passed")
 	os.Exit(0)
-}
\ No newline at end of file
+}
+
+// checkHealth GETs url and fails unless it answers 200 OK
+func checkHealth(url string) error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/metrics"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestReloadConfig_ChangesLogLevel(t *testing.T) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	logger := zap.New(zapcore.NewNopCore())
+	manager := metrics.NewManager(prometheus.NewRegistry(), zap.NewNop())
+
+	t.Setenv("LOG_LEVEL", "debug")
+	reloadConfig(logger, level, false, manager)
+	assert.Equal(t, zapcore.DebugLevel, level.Level())
+	assert.True(t, level.Enabled(zapcore.DebugLevel))
+
+	t.Setenv("LOG_LEVEL", "warn")
+	reloadConfig(logger, level, false, manager)
+	assert.Equal(t, zapcore.WarnLevel, level.Level())
+	assert.False(t, level.Enabled(zapcore.InfoLevel))
+}
+
+func TestResolveLogLevel(t *testing.T) {
+	assert.Equal(t, zapcore.ErrorLevel, resolveLogLevel("error", false))
+	assert.Equal(t, zapcore.InfoLevel, resolveLogLevel("bogus", false), "不正な値は info")
+	assert.Equal(t, zapcore.DebugLevel, resolveLogLevel("error", true), "-debug フラグが優先")
+}
+
+func TestLoadConfig_BindAddress(t *testing.T) {
+	t.Run("未設定なら全インターフェースの PORT", func(t *testing.T) {
+		t.Setenv("BIND_ADDRESS", "")
+		t.Setenv("PORT", "9100")
+		assert.Equal(t, ":9100", loadConfig().BindAddress)
+	})
+
+	t.Run("BIND_ADDRESS を優先", func(t *testing.T) {
+		t.Setenv("BIND_ADDRESS", "127.0.0.1:8080")
+		t.Setenv("PORT", "9100")
+		assert.Equal(t, "127.0.0.1:8080", loadConfig().BindAddress)
+	})
+}
+
+func TestLoadConfig_MetricsPort(t *testing.T) {
+	t.Setenv("METRICS_PORT", "")
+	assert.Empty(t, loadConfig().MetricsAddress, "未設定ならメインポートで配信")
+
+	t.Setenv("METRICS_PORT", "9101")
+	assert.Equal(t, ":9101", loadConfig().MetricsAddress)
+}
+
+func TestValidateBindAddress(t *testing.T) {
+	for _, address := range []string{":8080", "127.0.0.1:8080", "[::1]:8080", "localhost:9100"} {
+		assert.NoError(t, validateBindAddress(address), address)
+	}
+	for _, address := range []string{"127.0.0.1", "localhost:http-alt", "127.0.0.1:70000", "::1:8080"} {
+		assert.Error(t, validateBindAddress(address), address)
+	}
+}
+
+func TestHealthCheckURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080/livez", healthCheckURL(":8080", ""))
+	assert.Equal(t, "http://localhost:9100/livez", healthCheckURL("0.0.0.0:9100", ""))
+	assert.Equal(t, "http://127.0.0.1:8080/livez", healthCheckURL("127.0.0.1:8080", ""))
+	assert.Equal(t, "http://[::1]:8080/livez", healthCheckURL("[::1]:8080", ""))
+
+	// BASE_PATH 配下で配信している場合
+	assert.Equal(t, "http://localhost:8080/zaim/livez", healthCheckURL(":8080", "/zaim"))
+}
+
+func TestCheckHealth_HonorsPort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/livez", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	// -health と同じ経路で PORT から URL を組み立てる
+	t.Setenv("BIND_ADDRESS", "")
+	t.Setenv("PORT", port)
+	url := healthCheckURL(loadConfig().BindAddress, "")
+
+	assert.Equal(t, "http://localhost:"+port+"/livez", url)
+	assert.NoError(t, checkHealth(url))
+}
+
+func TestCheckHealth_Unhealthy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	assert.ErrorContains(t, checkHealth(server.URL+"/health"), "503")
+}
+
+func TestLoadConfig_RedisTuning(t *testing.T) {
+	t.Setenv("REDIS_POOL_SIZE", "20")
+	t.Setenv("REDIS_DIAL_TIMEOUT", "3s")
+	t.Setenv("REDIS_READ_TIMEOUT", "750ms")
+
+	assert.Equal(t, storage.RedisTuning{
+		PoolSize:    20,
+		DialTimeout: 3 * time.Second,
+		ReadTimeout: 750 * time.Millisecond,
+	}, loadConfig().RedisTuning)
+
+	// 不正な値は既定値（ゼロ値 = go-redis の既定）に戻る
+	t.Setenv("REDIS_DIAL_TIMEOUT", "soon")
+	t.Setenv("REDIS_READ_TIMEOUT", "-1s")
+	tuning := loadConfig().RedisTuning
+	assert.Zero(t, tuning.DialTimeout)
+	assert.Zero(t, tuning.ReadTimeout)
+}
+
+func TestLoadConfig_StartupJitter(t *testing.T) {
+	assert.Equal(t, 30*time.Second, loadConfig().StartupJitter)
+
+	// 0 で無効化できる
+	t.Setenv("STARTUP_JITTER", "0")
+	assert.Zero(t, loadConfig().StartupJitter)
+
+	t.Setenv("STARTUP_JITTER", "-5s")
+	assert.Equal(t, 30*time.Second, loadConfig().StartupJitter)
+}
+
+func TestLoadConfig_OAuthTokenTTL(t *testing.T) {
+	assert.Equal(t, 10*time.Minute, loadConfig().OAuthTokenTTL)
+
+	t.Setenv("OAUTH_TOKEN_TTL", "30m")
+	assert.Equal(t, 30*time.Minute, loadConfig().OAuthTokenTTL)
+
+	// 0 以下は既定値
+	t.Setenv("OAUTH_TOKEN_TTL", "0")
+	assert.Equal(t, 10*time.Minute, loadConfig().OAuthTokenTTL)
+}
+
+func TestLoadConfig_Budgets(t *testing.T) {
+	config := loadConfig()
+	assert.Zero(t, config.MonthlyBudget)
+	assert.Empty(t, config.CategoryBudgets)
+
+	t.Setenv("MONTHLY_BUDGET", "50000")
+	t.Setenv("MONTHLY_BUDGET_CAT_101", "30000")
+	t.Setenv("MONTHLY_BUDGET_CAT_food", "1000")
+	t.Setenv("MONTHLY_BUDGET_CAT_102", "abc")
+
+	config = loadConfig()
+	assert.Equal(t, 50000, config.MonthlyBudget)
+	assert.Equal(t, map[int]int{101: 30000}, config.CategoryBudgets)
+}
+
+func TestCheckInvalidEnv(t *testing.T) {
+	t.Setenv("PORT", "80a0")
+	t.Setenv("ZAIM_CACHE_DURATION", "5 minutes")
+
+	t.Run("寛容モードは警告して既定値を使う", func(t *testing.T) {
+		config := loadConfig()
+		assert.Equal(t, 8080, config.Port)
+
+		core, logs := observer.New(zapcore.WarnLevel)
+		require.NoError(t, checkInvalidEnv(config, zap.New(core)))
+
+		require.Equal(t, 2, logs.Len())
+		fields := logs.All()[0].ContextMap()
+		assert.Equal(t, "ZAIM_CACHE_DURATION", fields["key"])
+		assert.Equal(t, "5 minutes", fields["value"])
+		assert.Equal(t, metrics.DefaultCacheDuration.String(), fields["default"])
+		assert.Equal(t, map[string]interface{}{"key": "PORT", "value": "80a0", "default": "8080"}, logs.All()[1].ContextMap())
+	})
+
+	t.Run("厳格モードはエラー", func(t *testing.T) {
+		t.Setenv("STRICT_CONFIG", "true")
+		config := loadConfig()
+
+		core, logs := observer.New(zapcore.WarnLevel)
+		err := checkInvalidEnv(config, zap.New(core))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `PORT="80a0"`)
+		assert.Contains(t, err.Error(), `ZAIM_CACHE_DURATION="5 minutes"`)
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("不正な値がなければ何もしない", func(t *testing.T) {
+		t.Setenv("PORT", "9090")
+		t.Setenv("ZAIM_CACHE_DURATION", "5m")
+		t.Setenv("STRICT_CONFIG", "true")
+
+		assert.NoError(t, checkInvalidEnv(loadConfig(), zap.NewNop()))
+	})
+
+	t.Run("明示的な 0 は不正な値ではない", func(t *testing.T) {
+		t.Setenv("PORT", "9090")
+		t.Setenv("ZAIM_CACHE_DURATION", "0")
+		t.Setenv("ZAIM_POLL_INTERVAL", "0")
+		t.Setenv("ZAIM_MIN_REFRESH_INTERVAL", "0s")
+		t.Setenv("ZAIM_RATE_LIMIT", "0")
+		t.Setenv("BACKFILL_MONTHS", "0")
+		t.Setenv("STRICT_CONFIG", "true")
+
+		config := loadConfig()
+		assert.Empty(t, config.InvalidEnv)
+		assert.NoError(t, checkInvalidEnv(config, zap.NewNop()))
+		assert.Zero(t, config.PollInterval)
+		assert.Zero(t, config.MinRefreshInterval)
+		assert.Equal(t, metrics.DefaultCacheDuration, config.CacheDuration)
+	})
+
+	t.Run("読み込みごとに独立して集める", func(t *testing.T) {
+		t.Setenv("PORT", "9090")
+		t.Setenv("ZAIM_CACHE_DURATION", "5m")
+		t.Setenv("REDIS_DB", "one")
+		require.Len(t, loadConfig().InvalidEnv, 1)
+
+		t.Setenv("REDIS_DB", "1")
+		assert.Empty(t, loadConfig().InvalidEnv)
+	})
+}
+
+func TestGetEnvList_EscapedComma(t *testing.T) {
+	t.Setenv("EXCLUDE_NAME_PATTERNS", `調整, ^x{2\,3}$ ,,残高`)
+	assert.Equal(t, []string{"調整", "^x{2,3}$", "残高"}, getEnvList("EXCLUDE_NAME_PATTERNS"))
+
+	// エスケープしたカンマを含む正規表現もそのままコンパイルできる
+	pattern, err := metrics.CompileNamePatterns(getEnvList("EXCLUDE_NAME_PATTERNS"))
+	require.NoError(t, err)
+	assert.True(t, pattern.MatchString("xxx"))
+	assert.False(t, pattern.MatchString("x"))
+}
+
+func TestValidateRequestTokenStore(t *testing.T) {
+	t.Setenv("REDIS_URL", "")
+	t.Setenv("REDIS_PASSWORD", "")
+
+	t.Run("REQUIRE_REDIS で Redis 未設定ならエラー", func(t *testing.T) {
+		t.Setenv("REQUIRE_REDIS", "true")
+		config := loadConfig()
+		assert.True(t, config.RequireRedis)
+
+		err := validateRequestTokenStore(config)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "REQUIRE_REDIS")
+	})
+
+	t.Run("REQUIRE_REDIS と REDIS_URL があれば通る", func(t *testing.T) {
+		t.Setenv("REQUIRE_REDIS", "true")
+		t.Setenv("REDIS_URL", "redis://redis:6379/0")
+		assert.NoError(t, validateRequestTokenStore(loadConfig()))
+	})
+
+	t.Run("既定ではメモリへのフォールバックを許す", func(t *testing.T) {
+		assert.NoError(t, validateRequestTokenStore(loadConfig()))
+	})
+}
+
+func TestDataScopeRegisterer(t *testing.T) {
+	labels := func(scope string) map[string]string {
+		registry := prometheus.NewRegistry()
+		dataScopeRegisterer(registry, scope).MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "zaim_test", Help: "test"}))
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		result := make(map[string]string)
+		for _, label := range families[0].GetMetric()[0].GetLabel() {
+			result[label.GetName()] = label.GetValue()
+		}
+		return result
+	}
+
+	// 既定の home ではラベルを付けず、既存の系列名を変えない
+	assert.Empty(t, labels(zaim.ScopeHome))
+	assert.Equal(t, map[string]string{"scope": "group"}, labels(zaim.ScopeGroup))
+}
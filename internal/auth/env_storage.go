@@ -0,0 +1,35 @@
+package auth
+
+// EnvTokenStorage serves an access token injected through the environment
+// (ZAIM_ACCESS_TOKEN / ZAIM_ACCESS_SECRET), for CI and Kubernetes secrets
+// where no interactive OAuth round-trip is possible.
+// The token is read-only: Save and Clear fail with ErrReadOnlyTokenStorage,
+// so it stays in effect until the environment changes
+type EnvTokenStorage struct {
+	tokens OAuthTokens
+}
+
+func NewEnvTokenStorage(token, tokenSecret string) *EnvTokenStorage {
+	return &EnvTokenStorage{
+		tokens: OAuthTokens{Token: token, TokenSecret: tokenSecret},
+	}
+}
+
+func (s *EnvTokenStorage) Load() (*OAuthTokens, error) {
+	if s.tokens.Token == "" || s.tokens.TokenSecret == "" {
+		return nil, ErrTokenNotFound
+	}
+	tokens := s.tokens
+	return &tokens, nil
+}
+
+// Save refuses to replace the injected token with one obtained through OAuth
+func (s *EnvTokenStorage) Save(*OAuthTokens) error {
+	return ErrReadOnlyTokenStorage
+}
+
+// Clear refuses to drop the injected token; unset the environment variables
+// instead
+func (s *EnvTokenStorage) Clear() error {
+	return ErrReadOnlyTokenStorage
+}
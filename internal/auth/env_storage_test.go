@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvTokenStorage_Load(t *testing.T) {
+	storage := NewEnvTokenStorage("access-token", "access-secret")
+
+	tokens, err := storage.Load()
+	require.NoError(t, err)
+	assert.Equal(t, &OAuthTokens{Token: "access-token", TokenSecret: "access-secret"}, tokens)
+}
+
+func TestEnvTokenStorage_LoadMissing(t *testing.T) {
+	_, err := NewEnvTokenStorage("access-token", "").Load()
+	assert.ErrorIs(t, err, ErrTokenNotFound)
+}
+
+func TestEnvTokenStorage_ReadOnly(t *testing.T) {
+	storage := NewEnvTokenStorage("access-token", "access-secret")
+
+	// 保存・削除はエラーになり、環境変数のトークンが維持される
+	assert.ErrorIs(t, storage.Save(&OAuthTokens{Token: "other-token", TokenSecret: "other-secret"}), ErrReadOnlyTokenStorage)
+	assert.ErrorIs(t, storage.Clear(), ErrReadOnlyTokenStorage)
+
+	tokens, err := storage.Load()
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", tokens.Token)
+	assert.Equal(t, "access-secret", tokens.TokenSecret)
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/dghubble/oauth1"
 	"go.uber.org/zap"
@@ -21,6 +22,18 @@ import (
 var (
 	ErrTokenNotFound = errors.New("oauth token not found")
 	ErrInvalidToken  = errors.New("invalid oauth token")
+
+	// ErrRawTokensUnsupported is returned by Manager.ExportTokens and
+	// ImportTokens when the storage does not implement RawTokenStorage
+	ErrRawTokensUnsupported = errors.New("token storage does not support export/import")
+
+	// ErrReadOnlyTokenStorage is returned by Save and Clear of storages that
+	// cannot change their token (EnvTokenStorage)
+	ErrReadOnlyTokenStorage = errors.New("token storage is read-only")
+
+	// ErrPartialWrite is returned by FileTokenStorage.Save and SaveRaw when
+	// the tokens were written to some paths but not all of them
+	ErrPartialWrite = errors.New("token file not written to every path")
 )
 
 type OAuthTokens struct {
@@ -34,47 +47,110 @@ type TokenStorage interface {
 	Clear() error
 }
 
+// FileTokenStorage keeps the tokens in a JSON file, optionally encrypted
+// With fallback paths, Load reads the most recently written path that yields
+// tokens and Save writes every path it can, so the tokens survive one location
+// being unavailable (e.g. a network mount at boot) and a primary that missed
+// a re-authorization does not shadow the newer fallback
 type FileTokenStorage struct {
-	filepath      string
+	paths         []string
 	encryptionKey []byte
 	mu            sync.RWMutex
 }
 
-func NewFileTokenStorage(filepath, encryptionKey string) (*FileTokenStorage, error) {
-	var key []byte
-	if encryptionKey != "" {
-		decoded, err := base64.StdEncoding.DecodeString(encryptionKey)
-		if err != nil {
-			// Try using raw key
-			key = []byte(encryptionKey)
-			if len(key) != 32 {
-				return nil, fmt.Errorf("encryption key must be 32 bytes")
-			}
-		} else {
-			key = decoded
-		}
+// RawTokenStorage exposes the stored token data as is, for backups: encrypted
+// when an encryption key is set, plaintext JSON with the tokens otherwise
+type RawTokenStorage interface {
+	LoadRaw() ([]byte, error)
+	// SaveRaw stores data produced by LoadRaw, rejecting data it cannot decode
+	SaveRaw(data []byte) error
+}
+
+var _ RawTokenStorage = (*FileTokenStorage)(nil)
+
+func NewFileTokenStorage(filepath, encryptionKey string, fallbacks ...string) (*FileTokenStorage, error) {
+	key, err := ParseEncryptionKey(encryptionKey)
+	if err != nil {
+		return nil, err
 	}
 
 	return &FileTokenStorage{
-		filepath:      filepath,
+		paths:         append([]string{filepath}, fallbacks...),
 		encryptionKey: key,
 	}, nil
 }
 
+// Load returns the tokens from the most recently modified path that can be
+// read and decoded (ties keep the earlier path)
+// ErrTokenNotFound is returned only when no path has a token file; otherwise
+// the first other error is returned
 func (s *FileTokenStorage) Load() (*OAuthTokens, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	data, err := os.ReadFile(s.filepath)
+	_, tokens, err := s.newest()
+	return tokens, err
+}
+
+// newest reads every path and returns the contents and tokens of the most
+// recently modified file that decodes
+// s.mu must be held
+func (s *FileTokenStorage) newest() ([]byte, *OAuthTokens, error) {
+	var (
+		data     []byte
+		tokens   *OAuthTokens
+		modTime  time.Time
+		firstErr error
+	)
+	for _, path := range s.paths {
+		d, t, mt, err := s.read(path)
+		if err != nil {
+			if firstErr == nil && !errors.Is(err, ErrTokenNotFound) {
+				firstErr = err
+			}
+			continue
+		}
+		if tokens == nil || mt.After(modTime) {
+			data, tokens, modTime = d, t, mt
+		}
+	}
+	if tokens != nil {
+		return data, tokens, nil
+	}
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return nil, nil, ErrTokenNotFound
+}
+
+// read returns the contents, tokens and modification time of the file at path
+func (s *FileTokenStorage) read(path string) ([]byte, *OAuthTokens, time.Time, error) {
+	info, err := os.Stat(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, ErrTokenNotFound
+			return nil, nil, time.Time{}, ErrTokenNotFound
 		}
-		return nil, err
+		return nil, nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, time.Time{}, ErrTokenNotFound
+		}
+		return nil, nil, time.Time{}, err
+	}
+	tokens, err := s.decode(data)
+	if err != nil {
+		return nil, nil, time.Time{}, err
 	}
+	return data, tokens, info.ModTime(), nil
+}
 
+// decode decrypts (when a key is set) and parses token file contents
+func (s *FileTokenStorage) decode(data []byte) (*OAuthTokens, error) {
+	var err error
 	if s.encryptionKey != nil {
-		data, err = decrypt(data, s.encryptionKey)
+		data, err = Decrypt(data, s.encryptionKey)
 		if err != nil {
 			return nil, err
 		}
@@ -88,6 +164,7 @@ func (s *FileTokenStorage) Load() (*OAuthTokens, error) {
 	return &tokens, nil
 }
 
+// Save writes the tokens to every path (see writeAll)
 func (s *FileTokenStorage) Save(tokens *OAuthTokens) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -98,34 +175,141 @@ func (s *FileTokenStorage) Save(tokens *OAuthTokens) error {
 	}
 
 	if s.encryptionKey != nil {
-		data, err = encrypt(data, s.encryptionKey)
+		data, err = Encrypt(data, s.encryptionKey)
 		if err != nil {
 			return err
 		}
 	}
 
+	return s.writeAll(data)
+}
+
+// LoadRaw returns the token file contents of the path Load would read
+// Like Load, the data must decode, so a corrupt primary falls back too
+func (s *FileTokenStorage) LoadRaw() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, _, err := s.newest()
+	return data, err
+}
+
+// SaveRaw writes token file contents to every path after checking that they
+// decode with this storage's encryption key
+func (s *FileTokenStorage) SaveRaw(data []byte) error {
+	tokens, err := s.decode(data)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if tokens.Token == "" || tokens.TokenSecret == "" {
+		return ErrInvalidToken
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeAll(data)
+}
+
+// writeAll writes data to every path
+// When only some paths fail the error wraps ErrPartialWrite; the tokens are
+// stored and Load will find them, but the failed paths should be looked at
+// s.mu must be held
+func (s *FileTokenStorage) writeAll(data []byte) error {
+	var errs []error
+	for _, path := range s.paths {
+		if err := save(path, data); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case len(s.paths):
+		return errors.Join(errs...)
+	default:
+		return fmt.Errorf("%w: %w", ErrPartialWrite, errors.Join(errs...))
+	}
+}
+
+func save(path string, data []byte) error {
 	// Ensure directory exists (skip if current directory)
-	dir := filepath.Dir(s.filepath)
+	dir := filepath.Dir(path)
 	if dir != "." && dir != "" {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return err
 		}
 	}
 
-	return os.WriteFile(s.filepath, data, 0600)
+	return os.WriteFile(path, data, 0600)
 }
 
+// CheckWritable verifies that Save will be able to write a token file by
+// creating and removing a temporary file next to each path. Run it at startup
+// so a read-only filesystem is reported before the user completes OAuth
+// It fails only when no path is writable
+func (s *FileTokenStorage) CheckWritable() error {
+	var errs []error
+	for _, path := range s.paths {
+		err := checkWritable(path)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func checkWritable(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("token directory %s is not writable: %w", dir, err)
+	}
+
+	f, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("token directory %s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// Clear removes the token file from every path, reporting the paths where
+// an existing file could not be removed
 func (s *FileTokenStorage) Clear() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if err := os.Remove(s.filepath); err != nil && !os.IsNotExist(err) {
-		return err
+	var errs []error
+	for _, path := range s.paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
 	}
-	return nil
+	return errors.Join(errs...)
+}
+
+// ParseEncryptionKey decodes ENCRYPTION_KEY (base64 or a raw 32-byte string)
+// An empty value returns a nil key, which disables encryption
+func ParseEncryptionKey(encryptionKey string) ([]byte, error) {
+	if encryptionKey == "" {
+		return nil, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encryptionKey)
+	if err != nil {
+		// Try using raw key
+		key := []byte(encryptionKey)
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key must be 32 bytes")
+		}
+		return key, nil
+	}
+	return decoded, nil
 }
 
-func encrypt(plaintext []byte, key []byte) ([]byte, error) {
+// Encrypt seals plaintext with AES-GCM, prefixing the random nonce
+func Encrypt(plaintext []byte, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -144,7 +328,8 @@ func encrypt(plaintext []byte, key []byte) ([]byte, error) {
 	return gcm.Seal(nonce, nonce, plaintext, nil), nil
 }
 
-func decrypt(ciphertext []byte, key []byte) ([]byte, error) {
+// Decrypt opens data produced by Encrypt
+func Decrypt(ciphertext []byte, key []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -164,26 +349,59 @@ func decrypt(ciphertext []byte, key []byte) ([]byte, error) {
 	return gcm.Open(nil, nonce, ciphertext, nil)
 }
 
+// DefaultEndpoint is Zaim's production OAuth endpoint
+var DefaultEndpoint = oauth1.Endpoint{
+	RequestTokenURL: "https://api.zaim.net/v2/auth/request",
+	AuthorizeURL:    "https://auth.zaim.net/users/auth",
+	AccessTokenURL:  "https://api.zaim.net/v2/auth/access",
+}
+
 type Manager struct {
 	config  *oauth1.Config
 	storage TokenStorage
 	logger  *zap.Logger
 }
 
-func NewManager(consumerKey, consumerSecret string, storage TokenStorage, logger *zap.Logger) *Manager {
-	return &Manager{
+// Option customizes a Manager
+type Option func(*Manager)
+
+// WithEndpoint overrides the OAuth endpoint URLs (for mock servers and sandboxes)
+// Empty fields keep the production defaults
+func WithEndpoint(endpoint oauth1.Endpoint) Option {
+	return func(m *Manager) {
+		if endpoint.RequestTokenURL != "" {
+			m.config.Endpoint.RequestTokenURL = endpoint.RequestTokenURL
+		}
+		if endpoint.AuthorizeURL != "" {
+			m.config.Endpoint.AuthorizeURL = endpoint.AuthorizeURL
+		}
+		if endpoint.AccessTokenURL != "" {
+			m.config.Endpoint.AccessTokenURL = endpoint.AccessTokenURL
+		}
+	}
+}
+
+func NewManager(consumerKey, consumerSecret string, storage TokenStorage, logger *zap.Logger, opts ...Option) *Manager {
+	m := &Manager{
 		config: &oauth1.Config{
 			ConsumerKey:    consumerKey,
 			ConsumerSecret: consumerSecret,
-			Endpoint: oauth1.Endpoint{
-				RequestTokenURL: "https://api.zaim.net/v2/auth/request",
-				AuthorizeURL:    "https://auth.zaim.net/users/auth",
-				AccessTokenURL:  "https://api.zaim.net/v2/auth/access",
-			},
+			Endpoint:       DefaultEndpoint,
 		},
 		storage: storage,
 		logger:  logger,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.config.Endpoint != DefaultEndpoint {
+		logger.Warn("using non-production Zaim OAuth endpoint",
+			zap.String("request_token_url", m.config.Endpoint.RequestTokenURL),
+			zap.String("authorize_url", m.config.Endpoint.AuthorizeURL),
+			zap.String("access_token_url", m.config.Endpoint.AccessTokenURL))
+	}
+	return m
 }
 
 func (m *Manager) GetAuthorizationURL(callbackURL string) (string, string, string, error) {
@@ -220,8 +438,11 @@ func (m *Manager) HandleCallback(ctx context.Context, requestToken, requestSecre
 	}
 
 	if err := m.storage.Save(tokens); err != nil {
-		m.logger.Error("failed to save tokens", zap.Error(err))
-		return err
+		if !errors.Is(err, ErrPartialWrite) {
+			m.logger.Error("failed to save tokens", zap.Error(err))
+			return err
+		}
+		m.logger.Warn("saved tokens to some token file paths only", zap.Error(err))
 	}
 
 	m.logger.Info("successfully saved access tokens")
@@ -242,6 +463,42 @@ func (m *Manager) IsAuthenticated() bool {
 	return err == nil
 }
 
+// CheckStorage reports whether the token storage can be read
+// A missing token is not a failure; it only means OAuth has not completed yet
+func (m *Manager) CheckStorage() error {
+	_, err := m.storage.Load()
+	if err != nil && !errors.Is(err, ErrTokenNotFound) {
+		return err
+	}
+	return nil
+}
+
 func (m *Manager) ResetAuth() error {
 	return m.storage.Clear()
-}
\ No newline at end of file
+}
+
+// ExportTokens returns the stored token data as is (see RawTokenStorage)
+func (m *Manager) ExportTokens() ([]byte, error) {
+	raw, ok := m.storage.(RawTokenStorage)
+	if !ok {
+		return nil, ErrRawTokensUnsupported
+	}
+	return raw.LoadRaw()
+}
+
+// ImportTokens stores data previously returned by ExportTokens
+func (m *Manager) ImportTokens(data []byte) error {
+	raw, ok := m.storage.(RawTokenStorage)
+	if !ok {
+		return ErrRawTokensUnsupported
+	}
+	if err := raw.SaveRaw(data); err != nil {
+		if !errors.Is(err, ErrPartialWrite) {
+			return err
+		}
+		m.logger.Warn("imported tokens to some token file paths only", zap.Error(err))
+	}
+
+	m.logger.Info("imported access tokens")
+	return nil
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dghubble/oauth1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// newMockZaimOAuthServer は Zaim の request/access token エンドポイントを模したサーバー
+func newMockZaimOAuthServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/auth/request", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Contains(t, r.Header.Get("Authorization"), `oauth_callback="http%3A%2F%2Fexporter%2Fzaim%2Fauth%2Fcallback"`)
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		w.Write([]byte("oauth_token=request-token&oauth_token_secret=request-secret&oauth_callback_confirmed=true"))
+	})
+	mux.HandleFunc("/v2/auth/access", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		auth := r.Header.Get("Authorization")
+		assert.Contains(t, auth, `oauth_token="request-token"`)
+		assert.Contains(t, auth, `oauth_verifier="verifier"`)
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		w.Write([]byte("oauth_token=access-token&oauth_token_secret=access-secret"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestManager_AuthorizationFlow(t *testing.T) {
+	server := newMockZaimOAuthServer(t)
+
+	tokenStorage, err := NewFileTokenStorage(filepath.Join(t.TempDir(), "tokens.json"), "")
+	require.NoError(t, err)
+
+	manager := NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop(),
+		WithEndpoint(oauth1.Endpoint{
+			RequestTokenURL: server.URL + "/v2/auth/request",
+			AuthorizeURL:    server.URL + "/users/auth",
+			AccessTokenURL:  server.URL + "/v2/auth/access",
+		}),
+	)
+	require.False(t, manager.IsAuthenticated())
+
+	authURL, requestToken, requestSecret, err := manager.GetAuthorizationURL("http://exporter/zaim/auth/callback")
+	require.NoError(t, err)
+	assert.Equal(t, "request-token", requestToken)
+	assert.Equal(t, "request-secret", requestSecret)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(authURL, server.URL+"/users/auth"))
+	assert.Equal(t, "request-token", parsed.Query().Get("oauth_token"))
+
+	// ユーザーが Zaim で承認 → コールバック
+	require.NoError(t, manager.HandleCallback(context.Background(), requestToken, requestSecret, "verifier"))
+	assert.True(t, manager.IsAuthenticated())
+
+	token, err := manager.GetClient(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", token.Token)
+	assert.Equal(t, "access-secret", token.TokenSecret)
+}
+
+func TestWithEndpoint_PartialOverride(t *testing.T) {
+	manager := NewManager("key", "secret", nil, zap.NewNop(),
+		WithEndpoint(oauth1.Endpoint{AuthorizeURL: "http://sandbox/users/auth"}),
+	)
+
+	// 指定しなかった URL は本番の既定値のまま
+	assert.Equal(t, "http://sandbox/users/auth", manager.config.Endpoint.AuthorizeURL)
+	assert.Equal(t, DefaultEndpoint.RequestTokenURL, manager.config.Endpoint.RequestTokenURL)
+	assert.Equal(t, DefaultEndpoint.AccessTokenURL, manager.config.Endpoint.AccessTokenURL)
+}
+
+func TestFileTokenStorage_CheckWritable(t *testing.T) {
+	t.Run("書き込み可能", func(t *testing.T) {
+		dir := t.TempDir()
+		storage, err := NewFileTokenStorage(filepath.Join(dir, "nested", "tokens.json"), "")
+		require.NoError(t, err)
+
+		require.NoError(t, storage.CheckWritable())
+
+		// 確認用の一時ファイルは残らない
+		entries, err := os.ReadDir(filepath.Join(dir, "nested"))
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("親がファイルでディレクトリを作れない", func(t *testing.T) {
+		parent := filepath.Join(t.TempDir(), "not-a-dir")
+		require.NoError(t, os.WriteFile(parent, nil, 0600))
+
+		storage, err := NewFileTokenStorage(filepath.Join(parent, "tokens.json"), "")
+		require.NoError(t, err)
+
+		err = storage.CheckWritable()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "not writable")
+	})
+
+	t.Run("読み取り専用ディレクトリ", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root はパーミッションを無視するため再現できない")
+		}
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0500))
+		t.Cleanup(func() { os.Chmod(dir, 0700) })
+
+		storage, err := NewFileTokenStorage(filepath.Join(dir, "tokens.json"), "")
+		require.NoError(t, err)
+		assert.Error(t, storage.CheckWritable())
+	})
+}
+
+func TestFileTokenStorage_Fallback(t *testing.T) {
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "mount", "tokens.json")
+	fallback := filepath.Join(dir, "local", "tokens.json")
+	key := "12345678901234567890123456789012"
+
+	t.Run("主パスがなくても予備パスから読める", func(t *testing.T) {
+		seed, err := NewFileTokenStorage(fallback, key)
+		require.NoError(t, err)
+		require.NoError(t, seed.Save(&OAuthTokens{Token: "token", TokenSecret: "secret"}))
+
+		storage, err := NewFileTokenStorage(primary, key, fallback)
+		require.NoError(t, err)
+		tokens, err := storage.Load()
+		require.NoError(t, err)
+		assert.Equal(t, &OAuthTokens{Token: "token", TokenSecret: "secret"}, tokens)
+	})
+
+	t.Run("保存は書けるすべてのパスへ", func(t *testing.T) {
+		// 主パスの親がファイルで書けない
+		unavailable := filepath.Join(dir, "not-a-dir")
+		require.NoError(t, os.WriteFile(unavailable, nil, 0600))
+		storage, err := NewFileTokenStorage(filepath.Join(unavailable, "tokens.json"), key, primary, fallback)
+		require.NoError(t, err)
+
+		require.NoError(t, storage.CheckWritable())
+		// 一部のパスに書けなかったことは ErrPartialWrite で報告される
+		assert.ErrorIs(t, storage.Save(&OAuthTokens{Token: "new", TokenSecret: "new-secret"}), ErrPartialWrite)
+		for _, path := range []string{primary, fallback} {
+			single, err := NewFileTokenStorage(path, key)
+			require.NoError(t, err)
+			tokens, err := single.Load()
+			require.NoError(t, err, path)
+			assert.Equal(t, "new", tokens.Token, path)
+		}
+
+		// 書けないパスは削除もできず報告されるが、他のパスからは消える
+		assert.Error(t, storage.Clear())
+		reachable, err := NewFileTokenStorage(primary, key, fallback)
+		require.NoError(t, err)
+		_, err = reachable.Load()
+		assert.ErrorIs(t, err, ErrTokenNotFound)
+	})
+
+	t.Run("より新しく書かれた予備パスを優先する", func(t *testing.T) {
+		// 主パスが使えない間に再認可され、予備パスにだけ新しいトークンがある
+		stale, err := NewFileTokenStorage(primary, key)
+		require.NoError(t, err)
+		require.NoError(t, stale.Save(&OAuthTokens{Token: "stale", TokenSecret: "stale-secret"}))
+		fresh, err := NewFileTokenStorage(fallback, key)
+		require.NoError(t, err)
+		require.NoError(t, fresh.Save(&OAuthTokens{Token: "fresh", TokenSecret: "fresh-secret"}))
+		old := time.Now().Add(-time.Hour)
+		require.NoError(t, os.Chtimes(primary, old, old))
+
+		storage, err := NewFileTokenStorage(primary, key, fallback)
+		require.NoError(t, err)
+		tokens, err := storage.Load()
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", tokens.Token)
+
+		raw, err := storage.LoadRaw()
+		require.NoError(t, err)
+		want, err := os.ReadFile(fallback)
+		require.NoError(t, err)
+		assert.Equal(t, want, raw)
+		require.NoError(t, storage.Clear())
+	})
+
+	t.Run("どのパスにも書けなければ失敗", func(t *testing.T) {
+		unavailable := filepath.Join(dir, "not-a-dir")
+		storage, err := NewFileTokenStorage(filepath.Join(unavailable, "a.json"), "", filepath.Join(unavailable, "b.json"))
+		require.NoError(t, err)
+
+		assert.Error(t, storage.CheckWritable())
+		assert.Error(t, storage.Save(&OAuthTokens{Token: "token"}))
+	})
+}
@@ -2,40 +2,231 @@ package metrics
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
 )
 
-type Aggregator struct{}
+// Period layouts of hourly and daily bucket keys
+const (
+	HourLayout = "2006-01-02 15:00:00"
+	DayLayout  = "2006-01-02"
+)
+
+// DefaultProjectionMinDays is the first day of the month projections are
+// made on (see WithProjectionMinDays)
+const DefaultProjectionMinDays = 3
+
+// Modes are the Zaim transaction modes the aggregator understands
+var Modes = []string{"payment", "income", "transfer"}
+
+type Aggregator struct {
+	location *time.Location
+	now      func() time.Time
+	modes    map[string]bool // nil means all modes
+
+	// Category filter of GetTodayTotal (nil include = all categories)
+	todayInclude map[int]bool
+	todayExclude map[int]bool
+
+	// Monthly budgets in JPY (0 / nil = none), see BudgetRemaining
+	monthlyBudget   int
+	categoryBudgets map[int]int
+
+	// projectionMinDays is the first day of the month ProjectMonthTotal
+	// extrapolates from
+	projectionMinDays int
+}
+
+// AggregatorOption customizes an Aggregator
+type AggregatorOption func(*Aggregator)
+
+// WithLocation sets the time zone used to bucket transactions
+// Defaults to Asia/Tokyo (with a fixed UTC+9 fallback when tzdata is missing)
+func WithLocation(location *time.Location) AggregatorOption {
+	return func(a *Aggregator) {
+		if location != nil {
+			a.location = location
+		}
+	}
+}
+
+// WithClock overrides the clock used for "today" and "this month" (for tests)
+func WithClock(now func() time.Time) AggregatorOption {
+	return func(a *Aggregator) {
+		a.now = now
+	}
+}
+
+// WithModes restricts aggregation to the given modes (see ParseModes)
+// An empty list keeps all modes
+func WithModes(modes ...string) AggregatorOption {
+	return func(a *Aggregator) {
+		if len(modes) == 0 {
+			a.modes = nil
+			return
+		}
+		a.modes = make(map[string]bool, len(modes))
+		for _, mode := range modes {
+			a.modes[mode] = true
+		}
+	}
+}
+
+// WithTodayCategories limits GetTodayTotal to the include categories (empty =
+// all) minus the exclude categories, e.g. to leave rent out of daily spend
+func WithTodayCategories(include, exclude []int) AggregatorOption {
+	return func(a *Aggregator) {
+		a.todayInclude = categorySet(include)
+		a.todayExclude = categorySet(exclude)
+	}
+}
+
+// WithMonthlyBudget sets the overall monthly budget (0 = none) and per-category
+// budgets, both in JPY
+func WithMonthlyBudget(total int, byCategory map[int]int) AggregatorOption {
+	return func(a *Aggregator) {
+		a.monthlyBudget = total
+		a.categoryBudgets = byCategory
+	}
+}
+
+// WithProjectionMinDays skips ProjectMonthTotal until this many days of the
+// month have started, when a single purchase would dominate the projection
+// Values below 1 project from the first day
+func WithProjectionMinDays(days int) AggregatorOption {
+	return func(a *Aggregator) {
+		a.projectionMinDays = days
+	}
+}
+
+func categorySet(ids []int) map[int]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// ParseCategoryIDs parses Zaim category IDs such as ["101", "102"]
+func ParseCategoryIDs(values []string) ([]int, error) {
+	ids := make([]int, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid category ID %q", value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseModes parses a comma-separated mode list such as "payment,income"
+// An empty string selects all modes; unknown modes are an error
+func ParseModes(value string) ([]string, error) {
+	var modes []string
+	for _, mode := range strings.Split(value, ",") {
+		mode = strings.TrimSpace(mode)
+		if mode == "" {
+			continue
+		}
+		if !isKnownMode(mode) {
+			return nil, fmt.Errorf("unknown mode %q (valid: %s)", mode, strings.Join(Modes, ", "))
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+func isKnownMode(mode string) bool {
+	for _, known := range Modes {
+		if mode == known {
+			return true
+		}
+	}
+	return false
+}
 
-func NewAggregator() *Aggregator {
-	return &Aggregator{}
+// IncludesMode reports whether transactions of the given mode are aggregated
+func (a *Aggregator) IncludesMode(mode string) bool {
+	return a.modes == nil || a.modes[mode]
+}
+
+func NewAggregator(opts ...AggregatorOption) *Aggregator {
+	a := &Aggregator{now: time.Now, projectionMinDays: DefaultProjectionMinDays}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.location == nil {
+		a.location = zaim.LoadLocation(zap.NewNop())
+	}
+	return a
+}
+
+// BucketKey identifies an aggregation bucket: one period in one currency
+// Amounts in different currencies are never summed together
+type BucketKey struct {
+	Period   string // "2006-01-02 15:00:00" for hours, "2006-01-02" for days
+	Currency string
 }
 
 type HourlyMetrics struct {
 	Hour         time.Time
+	Currency     string
 	PaymentCount int
-	PaymentTotal int
+	PaymentTotal float64
 	IncomeCount  int
-	IncomeTotal  int
+	IncomeTotal  float64
 }
 
 type DailyMetrics struct {
 	Date         time.Time
+	Currency     string
 	PaymentCount int
-	PaymentTotal int
+	PaymentTotal float64
 	IncomeCount  int
-	IncomeTotal  int
+	IncomeTotal  float64
+}
+
+// AveragePayment returns the mean payment amount for the hour.
+// ok is false when there were no payments, so callers can skip the sample.
+func (m *HourlyMetrics) AveragePayment() (avg float64, ok bool) {
+	return averageAmount(m.PaymentTotal, m.PaymentCount)
+}
+
+// AveragePayment returns the mean payment amount for the day.
+// ok is false when there were no payments, so callers can skip the sample.
+func (m *DailyMetrics) AveragePayment() (avg float64, ok bool) {
+	return averageAmount(m.PaymentTotal, m.PaymentCount)
+}
+
+func averageAmount(total float64, count int) (float64, bool) {
+	if count == 0 {
+		return 0, false
+	}
+	return total / float64(count), true
 }
 
-func (a *Aggregator) AggregateByHour(transactions []zaim.Transaction) map[string]*HourlyMetrics {
-	metrics := make(map[string]*HourlyMetrics)
-	location, _ := time.LoadLocation("Asia/Tokyo")
+func (a *Aggregator) AggregateByHour(transactions []zaim.Transaction) map[BucketKey]*HourlyMetrics {
+	metrics := make(map[BucketKey]*HourlyMetrics)
+	location := a.location
 
 	for _, tx := range transactions {
-		// Parse created timestamp
-		createdTime, err := time.ParseInLocation("2006-01-02 15:04:05", tx.Created, location)
+		if !a.IncludesMode(tx.Mode) {
+			continue
+		}
+
+		// Parse created timestamp; unparseable rows are reported by
+		// CountUnparseableTimestamps
+		createdTime, err := zaim.ParseTimestamp(tx.Created, location)
 		if err != nil {
 			continue
 		}
@@ -49,99 +240,629 @@ func (a *Aggregator) AggregateByHour(transactions []zaim.Transaction) map[string
 			0, 0, 0, location,
 		)
 
-		key := hour.Format("2006-01-02 15:00:00")
+		key := BucketKey{Period: hour.Format(HourLayout), Currency: tx.CurrencyCode()}
 		if _, exists := metrics[key]; !exists {
-			metrics[key] = &HourlyMetrics{Hour: hour}
+			metrics[key] = &HourlyMetrics{Hour: hour, Currency: key.Currency}
 		}
 
 		switch tx.Mode {
 		case "payment":
 			metrics[key].PaymentCount++
-			metrics[key].PaymentTotal += tx.Amount
+			metrics[key].PaymentTotal += tx.AmountValue()
 		case "income":
 			metrics[key].IncomeCount++
-			metrics[key].IncomeTotal += tx.Amount
+			metrics[key].IncomeTotal += tx.AmountValue()
 		}
 	}
 
 	return metrics
 }
 
-func (a *Aggregator) AggregateByDay(transactions []zaim.Transaction) map[string]*DailyMetrics {
-	metrics := make(map[string]*DailyMetrics)
-	location, _ := time.LoadLocation("Asia/Tokyo")
+// CountUnparseableTimestamps returns how many transactions AggregateByHour
+// skips because their created timestamp matches no known format
+func (a *Aggregator) CountUnparseableTimestamps(transactions []zaim.Transaction) int {
+	count := 0
+	for _, tx := range transactions {
+		if !a.IncludesMode(tx.Mode) {
+			continue
+		}
+		if _, err := zaim.ParseTimestamp(tx.Created, a.location); err != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// FillEmptyHours adds zero buckets to hourly for every hour from the start of
+// this month to the current hour, for JPY and each currency already present,
+// so hourly series have no gaps. hourly is modified and returned
+func (a *Aggregator) FillEmptyHours(hourly map[BucketKey]*HourlyMetrics) map[BucketKey]*HourlyMetrics {
+	currencies := map[string]bool{zaim.DefaultCurrency: true}
+	for key := range hourly {
+		currencies[key.Currency] = true
+	}
+
+	now := a.now().In(a.location)
+	current := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, a.location)
+	for hour := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, a.location); !hour.After(current); hour = hour.Add(time.Hour) {
+		period := hour.Format(HourLayout)
+		for currency := range currencies {
+			key := BucketKey{Period: period, Currency: currency}
+			if _, exists := hourly[key]; !exists {
+				hourly[key] = &HourlyMetrics{Hour: hour, Currency: currency}
+			}
+		}
+	}
+	return hourly
+}
+
+// HoursSince drops the buckets of hours before start, e.g. last month's hours
+// still in the cache right after the month rolls over
+func HoursSince(hourly map[BucketKey]*HourlyMetrics, start time.Time) map[BucketKey]*HourlyMetrics {
+	for key, metrics := range hourly {
+		if metrics.Hour.Before(start) {
+			delete(hourly, key)
+		}
+	}
+	return hourly
+}
+
+// LatestHours keeps only the buckets of the most recent hours (across currencies)
+// Non-positive hours keep every bucket
+func LatestHours(hourly map[BucketKey]*HourlyMetrics, hours int) map[BucketKey]*HourlyMetrics {
+	periods := make(map[string]bool)
+	for key := range hourly {
+		periods[key.Period] = true
+	}
+	if hours <= 0 || len(periods) <= hours {
+		return hourly
+	}
+
+	// Periods are formatted "2006-01-02 15:00:00", so string order is time order
+	sorted := make([]string, 0, len(periods))
+	for period := range periods {
+		sorted = append(sorted, period)
+	}
+	sort.Strings(sorted)
+	cutoff := sorted[len(sorted)-hours]
+
+	latest := make(map[BucketKey]*HourlyMetrics)
+	for key, metrics := range hourly {
+		if key.Period >= cutoff {
+			latest[key] = metrics
+		}
+	}
+	return latest
+}
+
+func (a *Aggregator) AggregateByDay(transactions []zaim.Transaction) map[BucketKey]*DailyMetrics {
+	metrics := make(map[BucketKey]*DailyMetrics)
+	location := a.location
 
 	for _, tx := range transactions {
+		if !a.IncludesMode(tx.Mode) {
+			continue
+		}
+
 		// Parse date
 		date, err := time.ParseInLocation("2006-01-02", tx.Date, location)
 		if err != nil {
 			continue
 		}
 
-		key := date.Format("2006-01-02")
+		key := BucketKey{Period: date.Format(DayLayout), Currency: tx.CurrencyCode()}
 		if _, exists := metrics[key]; !exists {
-			metrics[key] = &DailyMetrics{Date: date}
+			metrics[key] = &DailyMetrics{Date: date, Currency: key.Currency}
 		}
 
 		switch tx.Mode {
 		case "payment":
 			metrics[key].PaymentCount++
-			metrics[key].PaymentTotal += tx.Amount
+			metrics[key].PaymentTotal += tx.AmountValue()
 		case "income":
 			metrics[key].IncomeCount++
-			metrics[key].IncomeTotal += tx.Amount
+			metrics[key].IncomeTotal += tx.AmountValue()
 		}
 	}
 
 	return metrics
 }
 
-func (a *Aggregator) GetTodayTotal(transactions []zaim.Transaction) int {
-	location, _ := time.LoadLocation("Asia/Tokyo")
-	today := time.Now().In(location).Format("2006-01-02")
+// TrailingDailyAverage returns the mean daily payment total per currency over
+// the trailing days ending today. Days without payments count as zero; when the
+// fetched window starts later than that (e.g. early in the month) only the days
+// since windowStart are averaged
+func (a *Aggregator) TrailingDailyAverage(daily map[BucketKey]*DailyMetrics, days int, windowStart time.Time) map[string]float64 {
+	averages := make(map[string]float64)
+	if days <= 0 || len(daily) == 0 {
+		return averages
+	}
+
+	today := a.now().In(a.location)
+	end := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, a.location)
+	start := end.AddDate(0, 0, -(days - 1))
 
-	total := 0
+	windowStart = windowStart.In(a.location)
+	windowStart = time.Date(windowStart.Year(), windowStart.Month(), windowStart.Day(), 0, 0, 0, 0, a.location)
+	if windowStart.After(start) {
+		start = windowStart
+	}
+	if start.After(end) {
+		return averages
+	}
+
+	totals := make(map[string]float64)
+	for key, metrics := range daily {
+		date, err := time.ParseInLocation(DayLayout, key.Period, a.location)
+		if err != nil || date.Before(start) || date.After(end) {
+			continue
+		}
+		totals[key.Currency] += metrics.PaymentTotal
+	}
+
+	// Step by calendar day so a DST shift does not shorten the window
+	available := 0
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		available++
+	}
+	for currency, total := range totals {
+		averages[currency] = total / float64(available)
+	}
+	return averages
+}
+
+// GetTodayTotal returns today's payment total per currency, limited to the
+// categories selected by WithTodayCategories
+// JPY is always present (0 when nothing was spent) so the gauge never disappears
+func (a *Aggregator) GetTodayTotal(transactions []zaim.Transaction) map[string]float64 {
+	today := a.now().In(a.location).Format("2006-01-02")
+
+	totals := map[string]float64{zaim.DefaultCurrency: 0}
+	for _, tx := range transactions {
+		if tx.Date == today && tx.Mode == "payment" && a.IncludesMode(tx.Mode) && a.countsToday(tx.CategoryID) {
+			totals[tx.CurrencyCode()] += tx.AmountValue()
+		}
+	}
+
+	return totals
+}
+
+// countsToday reports whether a category passes the today-total filter
+func (a *Aggregator) countsToday(categoryID int) bool {
+	if a.todayInclude != nil && !a.todayInclude[categoryID] {
+		return false
+	}
+	return !a.todayExclude[categoryID]
+}
+
+// GetTodayMaxPayment returns today's largest payment per currency
+// Currencies without payments today are absent; ties keep the earliest transaction
+func (a *Aggregator) GetTodayMaxPayment(transactions []zaim.Transaction) map[string]zaim.Transaction {
+	today := a.now().In(a.location).Format("2006-01-02")
+
+	largest := make(map[string]zaim.Transaction)
+	for _, tx := range transactions {
+		if tx.Date != today || tx.Mode != "payment" || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+		currency := tx.CurrencyCode()
+		if current, ok := largest[currency]; !ok || tx.AmountValue() > current.AmountValue() {
+			largest[currency] = tx
+		}
+	}
+
+	return largest
+}
+
+// LatestTransaction returns the most recently created transaction and its
+// created time. ok is false when no transaction has a parseable timestamp;
+// ties keep the transaction listed last
+func (a *Aggregator) LatestTransaction(transactions []zaim.Transaction) (latest zaim.Transaction, created time.Time, ok bool) {
 	for _, tx := range transactions {
-		if tx.Date == today && tx.Mode == "payment" {
-			total += tx.Amount
+		if !a.IncludesMode(tx.Mode) {
+			continue
+		}
+		createdTime, err := zaim.ParseTimestamp(tx.Created, a.location)
+		if err != nil {
+			continue
+		}
+		if !ok || !createdTime.Before(created) {
+			latest, created, ok = tx, createdTime, true
 		}
 	}
+	return latest, created, ok
+}
+
+// GenreKey identifies a genre bucket in one currency
+type GenreKey struct {
+	GenreID  int
+	Currency string
+}
 
-	return total
+type GenreMetrics struct {
+	GenreID      int
+	CategoryID   int
+	Currency     string
+	PaymentCount int
+	PaymentTotal float64
 }
 
-func (a *Aggregator) GeneratePrometheusMetrics(hourlyMetrics map[string]*HourlyMetrics, todayTotal int) string {
+// AggregateByGenre totals payments per genre (the finer level under category)
+// Transactions without a genre are skipped
+func (a *Aggregator) AggregateByGenre(transactions []zaim.Transaction) map[GenreKey]*GenreMetrics {
+	metrics := make(map[GenreKey]*GenreMetrics)
+
+	for _, tx := range transactions {
+		if tx.Mode != "payment" || tx.GenreID == 0 || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+
+		key := GenreKey{GenreID: tx.GenreID, Currency: tx.CurrencyCode()}
+		if _, exists := metrics[key]; !exists {
+			metrics[key] = &GenreMetrics{GenreID: tx.GenreID, CategoryID: tx.CategoryID, Currency: key.Currency}
+		}
+		metrics[key].PaymentCount++
+		metrics[key].PaymentTotal += tx.AmountValue()
+	}
+
+	return metrics
+}
+
+// CategoryKey identifies a category bucket; amounts are never summed across currencies
+type CategoryKey struct {
+	CategoryID int
+	Currency   string
+}
+
+// AggregateIncomeByCategory totals income per category (salary, refunds, ...)
+// Income without a category is skipped
+func (a *Aggregator) AggregateIncomeByCategory(transactions []zaim.Transaction) map[CategoryKey]float64 {
+	totals := make(map[CategoryKey]float64)
+
+	for _, tx := range transactions {
+		if tx.Mode != "income" || tx.CategoryID == 0 || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+		totals[CategoryKey{CategoryID: tx.CategoryID, Currency: tx.CurrencyCode()}] += tx.AmountValue()
+	}
+
+	return totals
+}
+
+// AccountKey identifies a payment account bucket; amounts are never summed across currencies
+type AccountKey struct {
+	AccountID int
+	Currency  string
+}
+
+// AggregateByAccount totals payments per source account (from_account_id)
+// Payments without an account are skipped
+func (a *Aggregator) AggregateByAccount(transactions []zaim.Transaction) map[AccountKey]float64 {
+	totals := make(map[AccountKey]float64)
+
+	for _, tx := range transactions {
+		if tx.Mode != "payment" || tx.FromAccountID == 0 || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+		totals[AccountKey{AccountID: tx.FromAccountID, Currency: tx.CurrencyCode()}] += tx.AmountValue()
+	}
+
+	return totals
+}
+
+// CompileNamePatterns combines patterns (each a regex; plain keywords match
+// as substrings) into one expression matching any of them. Empty entries are
+// ignored; no patterns returns nil
+func CompileNamePatterns(patterns []string) (*regexp.Regexp, error) {
+	var parts []string
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+		parts = append(parts, "(?:"+pattern+")")
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile(strings.Join(parts, "|"))
+}
+
+// ExcludeByName drops transactions whose name matches pattern and returns the
+// remaining transactions and the number dropped
+func ExcludeByName(transactions []zaim.Transaction, pattern *regexp.Regexp) ([]zaim.Transaction, int) {
+	if pattern == nil {
+		return transactions, 0
+	}
+
+	kept := make([]zaim.Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if pattern.MatchString(tx.Name) {
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	return kept, len(transactions) - len(kept)
+}
+
+// TagKey identifies a comment tag bucket; amounts are never summed across currencies
+type TagKey struct {
+	Tag      string
+	Currency string
+}
+
+// ExtractTags returns the tags pattern finds in comment
+// The first capture group is used as the tag when present, otherwise the whole match
+func ExtractTags(pattern *regexp.Regexp, comment string) []string {
+	var tags []string
+	for _, match := range pattern.FindAllStringSubmatch(comment, -1) {
+		tag := match[0]
+		if len(match) > 1 {
+			tag = match[1]
+		}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// AggregateByTag totals payments per comment tag matched by pattern
+// A payment with several tags counts toward each of them; untagged payments are skipped.
+// At most maxTags distinct tags are kept (in order of first appearance) to bound
+// cardinality; the number of dropped tags is returned
+func (a *Aggregator) AggregateByTag(transactions []zaim.Transaction, pattern *regexp.Regexp, maxTags int) (map[TagKey]float64, int) {
+	totals := make(map[TagKey]float64)
+	kept := make(map[string]bool)
+	dropped := make(map[string]bool)
+
+	for _, tx := range transactions {
+		if tx.Mode != "payment" || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+
+		for _, tag := range ExtractTags(pattern, tx.Comment) {
+			if !kept[tag] {
+				if len(kept) >= maxTags {
+					dropped[tag] = true
+					continue
+				}
+				kept[tag] = true
+			}
+			totals[TagKey{Tag: tag, Currency: tx.CurrencyCode()}] += tx.AmountValue()
+		}
+	}
+
+	return totals, len(dropped)
+}
+
+// MonthBalance holds the current month's totals for one currency
+type MonthBalance struct {
+	Currency     string
+	IncomeTotal  float64
+	PaymentTotal float64
+
+	// TransferTotal is the volume moved between own accounts. A transfer
+	// leaves one account and enters another, so it nets to zero and is not
+	// part of Balance
+	TransferTotal float64
+}
+
+// Balance returns income minus payments; negative means overspending
+func (b *MonthBalance) Balance() float64 {
+	return b.IncomeTotal - b.PaymentTotal
+}
+
+// GetMonthBalance totals income and payments dated in the current month per currency
+// Transfers move money between own accounts: they only add to TransferTotal
+// JPY is always present so the gauges never disappear
+func (a *Aggregator) GetMonthBalance(transactions []zaim.Transaction) map[string]*MonthBalance {
+	month := a.now().In(a.location).Format("2006-01")
+
+	balances := map[string]*MonthBalance{
+		zaim.DefaultCurrency: {Currency: zaim.DefaultCurrency},
+	}
+	for _, tx := range transactions {
+		if !a.inMonth(tx, month) || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+
+		currency := tx.CurrencyCode()
+		balance, exists := balances[currency]
+		if !exists {
+			balance = &MonthBalance{Currency: currency}
+			balances[currency] = balance
+		}
+
+		switch tx.Mode {
+		case "payment":
+			balance.PaymentTotal += tx.AmountValue()
+		case "income":
+			balance.IncomeTotal += tx.AmountValue()
+		case "transfer":
+			balance.TransferTotal += tx.AmountValue()
+		}
+	}
+
+	return balances
+}
+
+// AccountFlow is the money moved through one account this month
+type AccountFlow struct {
+	Payment     float64 // paid from the account
+	Income      float64 // received into the account
+	TransferIn  float64
+	TransferOut float64
+}
+
+// Net returns how much the account's balance changed: money in minus money out
+func (f *AccountFlow) Net() float64 {
+	return f.Income + f.TransferIn - f.Payment - f.TransferOut
+}
+
+// AggregateAccountFlows totals this month's payments (from_account_id),
+// income (to_account_id) and transfers (both) per account and currency
+// Transactions without an account land under AccountID 0, so the Net of all
+// keys of a currency is the overall change: transfers between own accounts
+// cancel out and it equals income minus payments
+func (a *Aggregator) AggregateAccountFlows(transactions []zaim.Transaction) map[AccountKey]*AccountFlow {
+	month := a.now().In(a.location).Format("2006-01")
+
+	flows := make(map[AccountKey]*AccountFlow)
+	flow := func(accountID int, currency string) *AccountFlow {
+		key := AccountKey{AccountID: accountID, Currency: currency}
+		f, ok := flows[key]
+		if !ok {
+			f = &AccountFlow{}
+			flows[key] = f
+		}
+		return f
+	}
+	for _, tx := range transactions {
+		if !a.inMonth(tx, month) || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+
+		currency := tx.CurrencyCode()
+		switch tx.Mode {
+		case "payment":
+			flow(tx.FromAccountID, currency).Payment += tx.AmountValue()
+		case "income":
+			flow(tx.ToAccountID, currency).Income += tx.AmountValue()
+		case "transfer":
+			flow(tx.FromAccountID, currency).TransferOut += tx.AmountValue()
+			flow(tx.ToAccountID, currency).TransferIn += tx.AmountValue()
+		}
+	}
+
+	return flows
+}
+
+// ProjectMonthTotal extrapolates a month-to-date total linearly to the whole
+// month: total / days elapsed × days in the month, on the calendar of the
+// aggregator's time zone. Today counts as elapsed. ok is false before the
+// configured minimum days
+func (a *Aggregator) ProjectMonthTotal(monthToDate float64) (projected float64, ok bool) {
+	now := a.now().In(a.location)
+	elapsed := now.Day()
+	if elapsed < a.projectionMinDays {
+		return 0, false
+	}
+	// Day 0 of the next month is the last day of this one
+	daysInMonth := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, a.location).Day()
+	return monthToDate / float64(elapsed) * float64(daysInMonth), true
+}
+
+// BudgetAll is the BudgetRemaining key of the overall monthly budget
+const BudgetAll = 0
+
+// BudgetRemaining returns each configured budget minus the JPY payments dated
+// in the current month, keyed by category ID (BudgetAll for the overall budget)
+// Values go negative when over budget; unconfigured budgets are absent
+func (a *Aggregator) BudgetRemaining(transactions []zaim.Transaction) map[int]int {
+	remaining := make(map[int]int, len(a.categoryBudgets)+1)
+	if a.monthlyBudget > 0 {
+		remaining[BudgetAll] = a.monthlyBudget
+	}
+	for categoryID, budget := range a.categoryBudgets {
+		remaining[categoryID] = budget
+	}
+	if len(remaining) == 0 || !a.IncludesMode("payment") {
+		return remaining
+	}
+
+	month := a.now().In(a.location).Format("2006-01")
+	for _, tx := range transactions {
+		if tx.Mode != "payment" || tx.CurrencyCode() != zaim.DefaultCurrency || !a.inMonth(tx, month) {
+			continue
+		}
+		if a.monthlyBudget > 0 {
+			remaining[BudgetAll] -= tx.Amount
+		}
+		if _, ok := a.categoryBudgets[tx.CategoryID]; ok {
+			remaining[tx.CategoryID] -= tx.Amount
+		}
+	}
+
+	return remaining
+}
+
+func (a *Aggregator) GeneratePrometheusMetrics(hourlyMetrics map[BucketKey]*HourlyMetrics, todayTotals map[string]float64) string {
 	output := "# HELP zaim_payment_amount Total payment amount per hour\n"
 	output += "# TYPE zaim_payment_amount gauge\n"
 
-	for hour, metrics := range hourlyMetrics {
-		output += fmt.Sprintf("zaim_payment_amount{hour=\"%s\"} %d\n", hour, metrics.PaymentTotal)
+	for key, metrics := range hourlyMetrics {
+		output += fmt.Sprintf("zaim_payment_amount{hour=\"%s\",currency=\"%s\"} %g\n", key.Period, key.Currency, metrics.PaymentTotal)
 	}
 
 	output += "\n# HELP zaim_payment_count Number of payments per hour\n"
 	output += "# TYPE zaim_payment_count gauge\n"
 
-	for hour, metrics := range hourlyMetrics {
-		output += fmt.Sprintf("zaim_payment_count{hour=\"%s\"} %d\n", hour, metrics.PaymentCount)
+	for key, metrics := range hourlyMetrics {
+		output += fmt.Sprintf("zaim_payment_count{hour=\"%s\",currency=\"%s\"} %d\n", key.Period, key.Currency, metrics.PaymentCount)
 	}
 
 	output += "\n# HELP zaim_income_amount Total income amount per hour\n"
 	output += "# TYPE zaim_income_amount gauge\n"
 
-	for hour, metrics := range hourlyMetrics {
-		output += fmt.Sprintf("zaim_income_amount{hour=\"%s\"} %d\n", hour, metrics.IncomeTotal)
+	for key, metrics := range hourlyMetrics {
+		output += fmt.Sprintf("zaim_income_amount{hour=\"%s\",currency=\"%s\"} %g\n", key.Period, key.Currency, metrics.IncomeTotal)
 	}
 
 	output += "\n# HELP zaim_income_count Number of income transactions per hour\n"
 	output += "# TYPE zaim_income_count gauge\n"
 
-	for hour, metrics := range hourlyMetrics {
-		output += fmt.Sprintf("zaim_income_count{hour=\"%s\"} %d\n", hour, metrics.IncomeCount)
+	for key, metrics := range hourlyMetrics {
+		output += fmt.Sprintf("zaim_income_count{hour=\"%s\",currency=\"%s\"} %d\n", key.Period, key.Currency, metrics.IncomeCount)
 	}
 
 	output += "\n# HELP zaim_today_total_amount Today's total spending\n"
 	output += "# TYPE zaim_today_total_amount gauge\n"
-	output += fmt.Sprintf("zaim_today_total_amount %d\n", todayTotal)
+	for currency, total := range todayTotals {
+		output += fmt.Sprintf("zaim_today_total_amount{currency=\"%s\"} %g\n", currency, total)
+	}
 
 	return output
-}
\ No newline at end of file
+}
+
+// CountActiveCategories returns the number of distinct categories with at
+// least one payment in the current month (across all currencies)
+func (a *Aggregator) CountActiveCategories(transactions []zaim.Transaction) int {
+	month := a.now().In(a.location).Format("2006-01")
+
+	categories := make(map[int]bool)
+	for _, tx := range transactions {
+		if tx.Mode != "payment" || tx.CategoryID == 0 || !a.inMonth(tx, month) || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+		categories[tx.CategoryID] = true
+	}
+
+	return len(categories)
+}
+
+// CountReceipts returns how many of the current month's payments have a
+// receipt attached (non-zero receipt_id) and how many do not
+func (a *Aggregator) CountReceipts(transactions []zaim.Transaction) (withReceipt, withoutReceipt int) {
+	month := a.now().In(a.location).Format("2006-01")
+
+	for _, tx := range transactions {
+		if tx.Mode != "payment" || !a.inMonth(tx, month) || !a.IncludesMode(tx.Mode) {
+			continue
+		}
+		if tx.ReceiptID != 0 {
+			withReceipt++
+		} else {
+			withoutReceipt++
+		}
+	}
+
+	return withReceipt, withoutReceipt
+}
+
+// inMonth reports whether the transaction date falls in month ("2006-01")
+func (a *Aggregator) inMonth(tx zaim.Transaction, month string) bool {
+	return len(tx.Date) >= len(month) && tx.Date[:len(month)] == month
+}
@@ -0,0 +1,450 @@
+package metrics
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+)
+
+func TestAggregator_SeparatesCurrencies(t *testing.T) {
+	aggregator := NewAggregator()
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:05:00", Amount: 1000},
+		{ID: 2, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:20:00", Amount: 500, Currency: "JPY"},
+		{ID: 3, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:45:00", Amount: 25, Currency: "USD"},
+	}
+
+	hourly := aggregator.AggregateByHour(transactions)
+	require.Len(t, hourly, 2)
+
+	// currency_code 未設定は JPY として扱う
+	jpy := hourly[BucketKey{Period: "2024-01-15 10:00:00", Currency: "JPY"}]
+	require.NotNil(t, jpy)
+	assert.Equal(t, 1500.0, jpy.PaymentTotal)
+	assert.Equal(t, 2, jpy.PaymentCount)
+
+	usd := hourly[BucketKey{Period: "2024-01-15 10:00:00", Currency: "USD"}]
+	require.NotNil(t, usd)
+	assert.Equal(t, 25.0, usd.PaymentTotal)
+	assert.Equal(t, 1, usd.PaymentCount)
+
+	daily := aggregator.AggregateByDay(transactions)
+	require.Len(t, daily, 2)
+	assert.Equal(t, 1500.0, daily[BucketKey{Period: "2024-01-15", Currency: "JPY"}].PaymentTotal)
+	assert.Equal(t, 25.0, daily[BucketKey{Period: "2024-01-15", Currency: "USD"}].PaymentTotal)
+}
+
+// fixedClock はテスト用の固定時刻（JST 2024-01-20 12:00）を返す
+func fixedClock() time.Time {
+	return time.Date(2024, 1, 20, 12, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+}
+
+func TestAggregator_GetMonthBalance(t *testing.T) {
+	aggregator := NewAggregator(WithClock(fixedClock))
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "income", Date: "2024-01-05", Amount: 250000},
+		{ID: 2, Mode: "income", Date: "2024-01-18", Amount: 3000},
+		{ID: 3, Mode: "payment", Date: "2024-01-10", Amount: 80000},
+		{ID: 4, Mode: "payment", Date: "2024-01-20", Amount: 1200},
+		// 振替は収支に含めない
+		{ID: 5, Mode: "transfer", Date: "2024-01-12", Amount: 50000},
+		// 前月分は含めない
+		{ID: 6, Mode: "payment", Date: "2023-12-31", Amount: 9999},
+	}
+
+	balances := aggregator.GetMonthBalance(transactions)
+	jpy := balances["JPY"]
+	require.NotNil(t, jpy)
+
+	assert.Equal(t, 253000.0, jpy.IncomeTotal)
+	assert.Equal(t, 81200.0, jpy.PaymentTotal)
+	assert.Equal(t, 253000.0-81200, jpy.Balance())
+	assert.Equal(t, 50000.0, jpy.TransferTotal)
+}
+
+func TestAggregator_GetMonthBalanceEmpty(t *testing.T) {
+	balances := NewAggregator(WithClock(fixedClock)).GetMonthBalance(nil)
+
+	// 取引がなくても JPY は 0 で存在する
+	require.Contains(t, balances, "JPY")
+	assert.Equal(t, 0.0, balances["JPY"].Balance())
+}
+
+func TestAggregator_AggregateByAccount(t *testing.T) {
+	aggregator := NewAggregator()
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", FromAccountID: 1, Amount: 800},
+		{ID: 2, Mode: "payment", FromAccountID: 1, Amount: 200},
+		{ID: 3, Mode: "payment", FromAccountID: 2, Amount: 1500},
+		{ID: 4, Mode: "payment", FromAccountID: 2, Amount: 10, Currency: "USD"},
+		// 収入・振替と口座未設定は対象外
+		{ID: 5, Mode: "income", ToAccountID: 1, Amount: 100000},
+		{ID: 6, Mode: "transfer", FromAccountID: 1, ToAccountID: 2, Amount: 5000},
+		{ID: 7, Mode: "payment", Amount: 300},
+	}
+
+	assert.Equal(t, map[AccountKey]float64{
+		{AccountID: 1, Currency: "JPY"}: 1000,
+		{AccountID: 2, Currency: "JPY"}: 1500,
+		{AccountID: 2, Currency: "USD"}: 10,
+	}, aggregator.AggregateByAccount(transactions))
+}
+
+func TestAggregator_AggregateIncomeByCategory(t *testing.T) {
+	aggregator := NewAggregator()
+	transactions := []zaim.Transaction{
+		// 給与 (11) と臨時収入 (12)
+		{ID: 1, Mode: "income", CategoryID: 11, Amount: 250000},
+		{ID: 2, Mode: "income", CategoryID: 12, Amount: 3000},
+		{ID: 3, Mode: "income", CategoryID: 12, Amount: 1200},
+		// 支出のカテゴリは混ざらない
+		{ID: 4, Mode: "payment", CategoryID: 11, Amount: 800},
+		{ID: 5, Mode: "payment", CategoryID: 101, Amount: 1500},
+		// カテゴリ未設定は対象外
+		{ID: 6, Mode: "income", Amount: 100},
+	}
+
+	assert.Equal(t, map[CategoryKey]float64{
+		{CategoryID: 11, Currency: "JPY"}: 250000,
+		{CategoryID: 12, Currency: "JPY"}: 4200,
+	}, aggregator.AggregateIncomeByCategory(transactions))
+}
+
+func TestAggregator_AggregateByGenre(t *testing.T) {
+	aggregator := NewAggregator()
+	transactions := []zaim.Transaction{
+		// 同じカテゴリ (101: 食費) の異なるジャンル
+		{ID: 1, Mode: "payment", CategoryID: 101, GenreID: 10101, Amount: 800},
+		{ID: 2, Mode: "payment", CategoryID: 101, GenreID: 10101, Amount: 200},
+		{ID: 3, Mode: "payment", CategoryID: 101, GenreID: 10102, Amount: 1500},
+		// 収入とジャンル未設定は対象外
+		{ID: 4, Mode: "income", CategoryID: 11, GenreID: 0, Amount: 100000},
+		{ID: 5, Mode: "payment", Amount: 300},
+	}
+
+	genres := aggregator.AggregateByGenre(transactions)
+	require.Len(t, genres, 2)
+
+	groceries := genres[GenreKey{GenreID: 10101, Currency: "JPY"}]
+	require.NotNil(t, groceries)
+	assert.Equal(t, 1000.0, groceries.PaymentTotal)
+	assert.Equal(t, 2, groceries.PaymentCount)
+	assert.Equal(t, 101, groceries.CategoryID)
+
+	diningOut := genres[GenreKey{GenreID: 10102, Currency: "JPY"}]
+	require.NotNil(t, diningOut)
+	assert.Equal(t, 1500.0, diningOut.PaymentTotal)
+	assert.Equal(t, 101, diningOut.CategoryID)
+}
+
+func TestAggregator_GetTodayTotalCategories(t *testing.T) {
+	const rent, food, hobby = 201, 101, 301
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-20", CategoryID: rent, Amount: 80000},
+		{ID: 2, Mode: "payment", Date: "2024-01-20", CategoryID: food, Amount: 1200},
+		{ID: 3, Mode: "payment", Date: "2024-01-20", CategoryID: hobby, Amount: 3000},
+	}
+
+	t.Run("既定は全カテゴリ", func(t *testing.T) {
+		totals := NewAggregator(WithClock(fixedClock)).GetTodayTotal(transactions)
+		assert.Equal(t, 84200.0, totals["JPY"])
+	})
+
+	t.Run("家賃を除外", func(t *testing.T) {
+		aggregator := NewAggregator(WithClock(fixedClock), WithTodayCategories(nil, []int{rent}))
+		assert.Equal(t, 4200.0, aggregator.GetTodayTotal(transactions)["JPY"])
+	})
+
+	t.Run("指定カテゴリのみ、除外が優先", func(t *testing.T) {
+		aggregator := NewAggregator(WithClock(fixedClock), WithTodayCategories([]int{food, hobby}, []int{hobby}))
+		assert.Equal(t, 1200.0, aggregator.GetTodayTotal(transactions)["JPY"])
+	})
+}
+
+func TestParseCategoryIDs(t *testing.T) {
+	ids, err := ParseCategoryIDs([]string{"101", " 201"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{101, 201}, ids)
+
+	_, err = ParseCategoryIDs([]string{"rent"})
+	assert.ErrorContains(t, err, "rent")
+}
+
+func TestParseModes(t *testing.T) {
+	t.Run("空文字列は全モード", func(t *testing.T) {
+		modes, err := ParseModes("")
+		require.NoError(t, err)
+		assert.Empty(t, modes)
+		assert.True(t, NewAggregator(WithModes(modes...)).IncludesMode("transfer"))
+	})
+
+	t.Run("カンマ区切りと空白を許容", func(t *testing.T) {
+		modes, err := ParseModes(" payment, income ")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"payment", "income"}, modes)
+
+		aggregator := NewAggregator(WithModes(modes...))
+		assert.True(t, aggregator.IncludesMode("income"))
+		assert.False(t, aggregator.IncludesMode("transfer"))
+	})
+
+	t.Run("不明なモードはエラー", func(t *testing.T) {
+		_, err := ParseModes("payment,refund")
+		assert.ErrorContains(t, err, "refund")
+	})
+}
+
+func TestAggregator_AggregateByTagCapsCardinality(t *testing.T) {
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", Amount: 100, Comment: "#a"},
+		{ID: 2, Mode: "payment", Amount: 200, Comment: "#b"},
+		{ID: 3, Mode: "payment", Amount: 300, Comment: "#c #a"},
+		{ID: 4, Mode: "income", Amount: 400, Comment: "#a"},
+	}
+
+	totals, dropped := NewAggregator().AggregateByTag(transactions, regexp.MustCompile(`#(\w+)`), 2)
+
+	// 上限を超えたタグ（c）は捨てられ、既存タグへの加算は続く
+	assert.Equal(t, map[TagKey]float64{
+		{Tag: "a", Currency: "JPY"}: 400,
+		{Tag: "b", Currency: "JPY"}: 200,
+	}, totals)
+	assert.Equal(t, 1, dropped)
+}
+
+func TestAggregator_CountActiveCategories(t *testing.T) {
+	aggregator := NewAggregator(WithClock(fixedClock))
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-05", CategoryID: 101, Amount: 800},
+		{ID: 2, Mode: "payment", Date: "2024-01-10", CategoryID: 101, Amount: 1200}, // 同じカテゴリは 1 回だけ数える
+		{ID: 3, Mode: "payment", Date: "2024-01-12", CategoryID: 102, Amount: 3000},
+		{ID: 4, Mode: "payment", Date: "2024-01-18", CategoryID: 105, Amount: 25, Currency: "USD"},
+		// 収入・前月の支出は対象外
+		{ID: 5, Mode: "income", Date: "2024-01-15", CategoryID: 11, Amount: 300000},
+		{ID: 6, Mode: "payment", Date: "2023-12-28", CategoryID: 107, Amount: 500},
+	}
+
+	assert.Equal(t, 3, aggregator.CountActiveCategories(transactions))
+}
+
+func TestAggregator_TrailingDailyAverage(t *testing.T) {
+	aggregator := NewAggregator(WithClock(fixedClock))
+	jst := fixedClock().Location()
+	monthStart := time.Date(2024, 1, 1, 0, 0, 0, 0, jst)
+
+	t.Run("10 日分のデータから直近 7 日の平均", func(t *testing.T) {
+		// 2024-01-11〜20 に 100, 200, ..., 1000 円（1/15 は支出なし＝0 円として数える）
+		var transactions []zaim.Transaction
+		for i := 0; i < 10; i++ {
+			if i == 4 {
+				transactions = append(transactions, zaim.Transaction{ID: int64(i + 1), Mode: "income", Date: "2024-01-15", Amount: 9999})
+				continue
+			}
+			date := time.Date(2024, 1, 11+i, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+			transactions = append(transactions, zaim.Transaction{ID: int64(i + 1), Mode: "payment", Date: date, Amount: (i + 1) * 100})
+		}
+
+		averages := aggregator.TrailingDailyAverage(aggregator.AggregateByDay(transactions), 7, monthStart)
+
+		// 1/14〜1/20: 400 + 0 + 600 + 700 + 800 + 900 + 1000 = 4400 → 4400 / 7
+		assert.InDelta(t, 4400.0/7, averages["JPY"], 1e-9)
+	})
+
+	t.Run("取得期間が 7 日未満なら期間の日数で平均", func(t *testing.T) {
+		transactions := []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-18", Amount: 300},
+			{ID: 2, Mode: "payment", Date: "2024-01-20", Amount: 600},
+		}
+
+		averages := aggregator.TrailingDailyAverage(aggregator.AggregateByDay(transactions), 7, time.Date(2024, 1, 18, 0, 0, 0, 0, jst))
+
+		// 1/18〜1/20 の 3 日間
+		assert.InDelta(t, 300.0, averages["JPY"], 1e-9)
+	})
+
+	t.Run("期間の初日に取引がなくても初日から数える", func(t *testing.T) {
+		transactions := []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-18", Amount: 300},
+			{ID: 2, Mode: "payment", Date: "2024-01-20", Amount: 600},
+		}
+
+		averages := aggregator.TrailingDailyAverage(aggregator.AggregateByDay(transactions), 7, time.Date(2024, 1, 16, 0, 0, 0, 0, jst))
+
+		// 1/16〜1/20 の 5 日間（最初の取引日 1/18 からではない）
+		assert.InDelta(t, 180.0, averages["JPY"], 1e-9)
+	})
+
+	t.Run("夏時間の切り替えをまたいでも暦日で数える", func(t *testing.T) {
+		newYork, err := time.LoadLocation("America/New_York")
+		if err != nil {
+			t.Skip("タイムゾーンデータがない")
+		}
+		dstAggregator := NewAggregator(WithLocation(newYork), WithClock(func() time.Time {
+			return time.Date(2024, 3, 12, 12, 0, 0, 0, newYork)
+		}))
+		transactions := []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-03-09", Amount: 400},
+			{ID: 2, Mode: "payment", Date: "2024-03-12", Amount: 400},
+		}
+
+		averages := dstAggregator.TrailingDailyAverage(dstAggregator.AggregateByDay(transactions), 7, time.Date(2024, 3, 9, 0, 0, 0, 0, newYork))
+
+		// 3/10 は 23 時間だが 3/9〜3/12 は 4 日
+		assert.InDelta(t, 200.0, averages["JPY"], 1e-9)
+	})
+
+	t.Run("データなし", func(t *testing.T) {
+		assert.Empty(t, aggregator.TrailingDailyAverage(nil, 7, monthStart))
+	})
+}
+
+func TestCompileNamePatterns(t *testing.T) {
+	t.Run("未設定なら nil", func(t *testing.T) {
+		pattern, err := CompileNamePatterns(nil)
+		require.NoError(t, err)
+		assert.Nil(t, pattern)
+	})
+
+	t.Run("キーワードと正規表現のいずれかに一致", func(t *testing.T) {
+		pattern, err := CompileNamePatterns([]string{"調整", "", `^テスト\d+$`})
+		require.NoError(t, err)
+		assert.True(t, pattern.MatchString("残高調整"))
+		assert.True(t, pattern.MatchString("テスト12"))
+		assert.False(t, pattern.MatchString("ランチ"))
+	})
+
+	t.Run("不正な正規表現はエラー", func(t *testing.T) {
+		_, err := CompileNamePatterns([]string{"("})
+		assert.Error(t, err)
+	})
+}
+
+func TestAggregator_FillEmptyHours(t *testing.T) {
+	aggregator := NewAggregator(WithClock(fixedClock))
+	hourly := aggregator.AggregateByHour([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-20", Created: "2024-01-20 10:30:00", Amount: 1200},
+		{ID: 2, Mode: "payment", Date: "2024-01-20", Created: "2024-01-20 10:40:00", Amount: 5, Currency: "USD"},
+	})
+
+	filled := aggregator.FillEmptyHours(hourly)
+
+	// 1/1 00:00 から 1/20 12:00 まで、JPY と USD の両方
+	hours := 19*24 + 13
+	assert.Len(t, filled, 2*hours)
+	assert.Equal(t, 1200.0, filled[BucketKey{Period: "2024-01-20 10:00:00", Currency: "JPY"}].PaymentTotal)
+
+	empty := filled[BucketKey{Period: "2024-01-01 00:00:00", Currency: "USD"}]
+	require.NotNil(t, empty)
+	assert.Zero(t, empty.PaymentTotal)
+	assert.NotContains(t, filled, BucketKey{Period: "2024-01-20 13:00:00", Currency: "JPY"})
+}
+
+func TestHoursSince(t *testing.T) {
+	aggregator := NewAggregator(WithLocation(time.UTC))
+	hourly := aggregator.AggregateByHour([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-31", Created: "2024-01-31 23:10:00", Amount: 1000},
+		{ID: 2, Mode: "payment", Date: "2024-02-01", Created: "2024-02-01 00:10:00", Amount: 500},
+	})
+
+	kept := HoursSince(hourly, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+	require.Len(t, kept, 1)
+	assert.Equal(t, 500.0, kept[BucketKey{Period: "2024-02-01 00:00:00", Currency: "JPY"}].PaymentTotal)
+}
+
+func TestAggregator_BudgetRemaining(t *testing.T) {
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-05", CategoryID: 101, Amount: 15000},
+		{ID: 2, Mode: "payment", Date: "2024-01-18", CategoryID: 102, Amount: 5000},
+		{ID: 3, Mode: "payment", Date: "2023-12-28", CategoryID: 101, Amount: 9000},
+		{ID: 4, Mode: "payment", Date: "2024-01-10", CategoryID: 101, Amount: 30, Currency: "USD"},
+		{ID: 5, Mode: "income", Date: "2024-01-25", Amount: 250000},
+	}
+
+	// 未設定なら何も返さない
+	assert.Empty(t, NewAggregator(WithClock(fixedClock)).BudgetRemaining(transactions))
+
+	aggregator := NewAggregator(WithClock(fixedClock), WithMonthlyBudget(50000, map[int]int{101: 10000, 103: 3000}))
+	remaining := aggregator.BudgetRemaining(transactions)
+	assert.Equal(t, map[int]int{
+		BudgetAll: 30000,
+		101:       -5000, // 予算超過は負になる
+		103:       3000,
+	}, remaining)
+}
+
+func TestAggregator_ProjectMonthTotal(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	clockAt := func(t time.Time) AggregatorOption { return WithClock(func() time.Time { return t }) }
+
+	t.Run("30 日の月の 10 日目", func(t *testing.T) {
+		aggregator := NewAggregator(WithLocation(jst), clockAt(time.Date(2024, 4, 10, 18, 0, 0, 0, jst)))
+		projected, ok := aggregator.ProjectMonthTotal(30000)
+		require.True(t, ok)
+		// 30000 / 10 × 30
+		assert.Equal(t, 90000.0, projected)
+	})
+
+	t.Run("日付はタイムゾーンの暦で数える", func(t *testing.T) {
+		// UTC では 2 月 28 日だが JST では閏年の 2 月 29 日（29 日の月の 29 日目）
+		aggregator := NewAggregator(WithLocation(jst), clockAt(time.Date(2024, 2, 28, 16, 0, 0, 0, time.UTC)))
+		projected, ok := aggregator.ProjectMonthTotal(29000)
+		require.True(t, ok)
+		assert.Equal(t, 29000.0, projected)
+	})
+
+	t.Run("最低日数に満たなければ出さない", func(t *testing.T) {
+		aggregator := NewAggregator(WithLocation(jst), clockAt(time.Date(2024, 4, 2, 12, 0, 0, 0, jst)))
+		_, ok := aggregator.ProjectMonthTotal(5000)
+		assert.False(t, ok, "既定は 3 日目から")
+
+		aggregator = NewAggregator(WithLocation(jst), clockAt(time.Date(2024, 4, 2, 12, 0, 0, 0, jst)), WithProjectionMinDays(0))
+		projected, ok := aggregator.ProjectMonthTotal(5000)
+		require.True(t, ok)
+		assert.Equal(t, 75000.0, projected)
+	})
+}
+
+func TestAggregator_UnparseableTimestamps(t *testing.T) {
+	aggregator := NewAggregator()
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:05:00", Amount: 1000},
+		{ID: 2, Mode: "payment", Date: "2024-01-15", Created: "15/01/2024 10:20", Amount: 500},
+	}
+
+	hourly := aggregator.AggregateByHour(transactions)
+	require.Len(t, hourly, 1)
+	assert.Equal(t, 1000.0, hourly[BucketKey{Period: "2024-01-15 10:00:00", Currency: "JPY"}].PaymentTotal)
+
+	// 解釈できない行は黙って消えず件数に現れる
+	assert.Equal(t, 1, aggregator.CountUnparseableTimestamps(transactions))
+}
+
+func TestAggregator_LatestTransaction(t *testing.T) {
+	transactions := []zaim.Transaction{
+		{ID: 1, Mode: "payment", Created: "2024-01-20 18:30:00"},
+		{ID: 2, Mode: "income", Created: "2024-01-20 19:00:00"},
+		{ID: 3, Mode: "payment", Created: "2024-01-20 09:00:00"},
+		{ID: 4, Mode: "payment", Created: "2024-01-20 18:30:00"},
+		{ID: 5, Mode: "payment", Created: "not a time"},
+	}
+
+	t.Run("同時刻なら後ろの取引", func(t *testing.T) {
+		latest, created, ok := NewAggregator(WithLocation(time.UTC), WithModes("payment")).LatestTransaction(transactions)
+		require.True(t, ok)
+		assert.Equal(t, int64(4), latest.ID)
+		assert.Equal(t, time.Date(2024, 1, 20, 18, 30, 0, 0, time.UTC), created)
+	})
+
+	t.Run("対象外のモードと解釈できない時刻は無視", func(t *testing.T) {
+		latest, _, ok := NewAggregator(WithLocation(time.UTC)).LatestTransaction(transactions)
+		require.True(t, ok)
+		assert.Equal(t, int64(2), latest.ID)
+
+		_, _, ok = NewAggregator().LatestTransaction(transactions[4:])
+		assert.False(t, ok)
+	})
+}
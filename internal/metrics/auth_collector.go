@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AuthChecker reports whether Zaim OAuth credentials are available
+// Implemented by auth.Manager
+type AuthChecker interface {
+	IsAuthenticated() bool
+}
+
+// AuthCollector exports zaim_authenticated on every scrape
+// Registered independently of the Zaim collector so the series is present
+// even when the exporter is not authenticated or fetches are failing
+type AuthCollector struct {
+	checker AuthChecker
+	desc    *prometheus.Desc
+}
+
+func NewAuthCollector(checker AuthChecker) *AuthCollector {
+	return &AuthCollector{
+		checker: checker,
+		desc: prometheus.NewDesc(
+			"zaim_authenticated",
+			"Whether the exporter holds Zaim OAuth credentials (1 = authenticated)",
+			nil, nil,
+		),
+	}
+}
+
+func (c *AuthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *AuthCollector) Collect(ch chan<- prometheus.Metric) {
+	value := 0.0
+	if c.checker.IsAuthenticated() {
+		value = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, value)
+}
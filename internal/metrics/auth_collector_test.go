@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"go.uber.org/zap"
+)
+
+func TestAuthCollector_FlipsAfterReset(t *testing.T) {
+	tokenStorage, err := auth.NewFileTokenStorage(filepath.Join(t.TempDir(), "tokens.json"), "")
+	require.NoError(t, err)
+	authManager := auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop())
+	collector := NewAuthCollector(authManager)
+
+	// 未認証
+	assert.Equal(t, 0.0, testutil.ToFloat64(collector))
+
+	// 認証済み
+	require.NoError(t, tokenStorage.Save(&auth.OAuthTokens{Token: "token", TokenSecret: "secret"}))
+	assert.Equal(t, 1.0, testutil.ToFloat64(collector))
+
+	// リセット後は 0 に戻る
+	require.NoError(t, authManager.ResetAuth())
+	assert.Equal(t, 0.0, testutil.ToFloat64(collector))
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BuildInfo identifies the running exporter build
+// Values are injected into package main via -ldflags
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+}
+
+// NewBuildInfoCollector exports zaim_exporter_build_info, always 1,
+// following the common Prometheus build-info pattern
+func NewBuildInfoCollector(info BuildInfo) prometheus.Collector {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zaim_exporter_build_info",
+		Help: "Build information of the running exporter (always 1)",
+	}, []string{"version", "commit"})
+	gauge.WithLabelValues(info.Version, info.Commit).Set(1)
+	return gauge
+}
@@ -2,21 +2,180 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
 	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultCacheDuration is how long fetched transactions are reused across scrapes
+	DefaultCacheDuration = 5 * time.Minute
+
+	// DefaultMinRefreshInterval is the floor between Zaim API fetches,
+	// whatever the cache duration, to stay clear of the API rate limit
+	DefaultMinRefreshInterval = 30 * time.Second
+
+	// DefaultMaxFailureBackoff caps how far consecutive fetch failures stretch
+	// the time between fetches (see WithFailureBackoff)
+	DefaultMaxFailureBackoff = time.Hour
+
+	// DefaultDataHardExpiry is how long the last good data keeps being served
+	// while fetches fail (see WithDataHardExpiry)
+	DefaultDataHardExpiry = 24 * time.Hour
+
+	// DefaultBackfillSpacing is the pause between backfill requests, keeping
+	// the first start well under the Zaim API rate limit
+	DefaultBackfillSpacing = 2 * time.Second
+
+	// DefaultBackfillConcurrency is how many backfill months are fetched at
+	// once; kept low to stay within Zaim's rate limits
+	DefaultBackfillConcurrency = 2
+
+	// DefaultBackfillRefreshInterval is how often the backfilled months are
+	// fetched again, so edits to earlier months show up without a restart
+	DefaultBackfillRefreshInterval = 24 * time.Hour
+
+	// trailingAverageDays is the window of zaim_payment_7day_avg_amount
+	trailingAverageDays = 7
+
+	// DefaultMaxCommentTags caps the distinct values of the tag label
+	DefaultMaxCommentTags = 20
+
+	// flightKey is the singleflight key shared by scrape loads and refreshes
+	flightKey = "transactions"
 )
 
 type ZaimCollector struct {
 	client        zaim.TransactionFetcher
 	aggregator    *Aggregator
 	logger        *zap.Logger
+	ctx           context.Context // bounds fetches made during scrapes; cancelled by Close
+	cancel        context.CancelFunc
 	mu            sync.RWMutex
 	cache         *metricsCache
 	cacheDuration time.Duration
+	flight        singleflight.Group // shares one fetch between cache misses and refreshes
+
+	// refreshing is set while Run keeps the cache current; scrapes then serve
+	// the cache past its duration instead of fetching themselves
+	refreshing atomic.Bool
+
+	// minRefreshInterval is the floor between fetches (0 = no floor)
+	minRefreshInterval time.Duration
+
+	// Differences between consecutive fetches, exported as
+	// zaim_transactions_changed_total / zaim_transactions_new_total
+	transactionsChanged atomic.Uint64
+	transactionsNew     atomic.Uint64
+
+	// Self-instrumentation of Collect, exported as zaim_collect_duration_seconds
+	// and zaim_scrape_cache_hit
+	collectDuration prometheus.Histogram
+	scrapeCacheHit  atomic.Bool // the last scrape was served without fetching
+
+	// Fetch outcome reported by Status
+	statusMu      sync.Mutex
+	lastSuccess   time.Time
+	lastError     error
+	lastAttempt   time.Time // start of the minimum refresh interval
+	tokenRejected bool      // last fetch failed with 401; exported as zaim_token_valid
+	failures      int       // consecutive failed fetches, reset by a success
+
+	// maxBackoff caps the failure backoff (0 disables it)
+	maxBackoff time.Duration
+
+	// hardExpiry is the age after which cached data is no longer served on
+	// failures (0 = never)
+	hardExpiry time.Duration
+
+	// onUnauthorized run in order when Zaim starts rejecting the access token
+	onUnauthorized []func()
+
+	// Randomized delay before the first fetch (startupJitter = 0 disables)
+	startupJitter time.Duration
+	warmAt        time.Time // scrapes before this get no Zaim data
+
+	// Genre breakdown (opt-in to control cardinality)
+	genreMetrics bool
+
+	// names labels the genre and category breakdowns
+	names               *CategoryResolver
+	nameRefreshInterval time.Duration
+
+	// Account breakdown (opt-in to control cardinality)
+	accountMetrics bool
+	accountMu      sync.Mutex
+	accountNames   map[int]string // fetched once per process
+	accountTriedAt time.Time      // last fetch attempt, to throttle retries
+
+	// accountSplit enables the per-account monthly flows and net worth change
+	accountSplit bool
+
+	// bucketTimestamps stamps hourly/daily samples with their bucket time
+	bucketTimestamps bool
+
+	// dailySeries emits per-day amount/count gauges next to the hourly ones
+	dailySeries bool
+
+	// staleThreshold marks data stale when the last success is older (0 = 2x cache duration)
+	staleThreshold time.Duration
+
+	// zeroFillHours emits zero-valued hourly series for hours without transactions
+	zeroFillHours bool
+
+	// hourlyWindow drops hourly buckets before the active window (see windowStart)
+	hourlyWindow bool
+
+	// maxHours caps the hourly series to the most recent hours (0 = all)
+	maxHours int
+
+	// fetchWindow selects the fetched date range when the client supports it
+	fetchWindow zaim.FetchWindow
+
+	// Prior months fetched in the background (opt-in)
+	backfillMonths  int
+	backfillSpacing time.Duration
+	// backfillConcurrency caps the backfill requests in flight
+	backfillConcurrency int
+	// backfillRefresh is the pause between backfill passes (0 = backfill once)
+	backfillRefresh time.Duration
+	backfillOnce    sync.Once
+	backfillMu      sync.RWMutex
+	backfillData    map[string][]zaim.Transaction // by month (YYYY-MM)
+
+	// excludeNames drops transactions by name before aggregation (nil = none)
+	excludeNames *regexp.Regexp
+
+	// amountScale multiplies amounts per currency code (missing = 1)
+	amountScale map[string]float64
+	// amountRoundTo rounds exported amounts to the nearest multiple (0 = exact)
+	amountRoundTo float64
+
+	// paymentCounter backs zaim_payment_amount_total (nil disables)
+	paymentCounter *PaymentCounter
+
+	// Comment tag breakdown (opt-in, nil pattern disables)
+	tagPattern *regexp.Regexp
+	maxTags    int
+
+	// Background goroutines (refresh/poll loop, backfill) waited for by Close
+	lifecycleMu sync.Mutex
+	closed      bool
+	background  sync.WaitGroup
 }
 
 type metricsCache struct {
@@ -24,13 +183,504 @@ type metricsCache struct {
 	timestamp time.Time
 }
 
-func NewZaimCollector(client zaim.TransactionFetcher, aggregator *Aggregator, logger *zap.Logger) *ZaimCollector {
-	return &ZaimCollector{
+// CollectorOption customizes a ZaimCollector
+type CollectorOption func(*ZaimCollector)
+
+// WithCacheDuration sets how long fetched transactions are cached
+// Non-positive values keep the default
+func WithCacheDuration(d time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		if d > 0 {
+			c.cacheDuration = d
+		}
+	}
+}
+
+// WithMinRefreshInterval sets the minimum time between fetches; scrapes in
+// between are served from the (possibly stale) cache. Zero disables the
+// floor, negative values keep the default
+func WithMinRefreshInterval(d time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		if d >= 0 {
+			c.minRefreshInterval = d
+		}
+	}
+}
+
+// WithGenreMetrics enables zaim_payment_amount_by_genre and
+// zaim_income_amount_by_category
+// Names come from /home/genre and /home/category when the client supports
+// them, cached as set by WithNameRefreshInterval
+func WithGenreMetrics(enabled bool) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.genreMetrics = enabled
+	}
+}
+
+// WithNameRefreshInterval sets how long genre and category names are cached
+// (see CategoryResolver). Non-positive values use DefaultNameRefreshInterval
+func WithNameRefreshInterval(d time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.nameRefreshInterval = d
+	}
+}
+
+// WithAccountMetrics enables zaim_payment_amount_by_account
+// Account names are fetched once from /home/account when the client supports it
+func WithAccountMetrics(enabled bool) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.accountMetrics = enabled
+	}
+}
+
+// WithAccountSplit enables the zaim_account_month_* series, splitting this
+// month's payments, income and transfers by linked account (from/to
+// account), and zaim_total_net_worth_change, their sum across accounts
+// Transactions without an account are only part of the total
+func WithAccountSplit(enabled bool) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.accountSplit = enabled
+	}
+}
+
+// WithDailyMetrics enables zaim_daily_payment_amount/_count and
+// zaim_daily_income_amount/_count, one series per day and currency: about 24
+// times fewer series than the hourly metrics for month-view dashboards
+func WithDailyMetrics(enabled bool) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.dailySeries = enabled
+	}
+}
+
+// WithBucketTimestamps stamps hourly and daily samples with the start of their
+// bucket instead of the scrape time. Prometheus rejects samples too far in the
+// past (outside the TSDB head), so only enable this with a short fetch window
+func WithBucketTimestamps(enabled bool) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.bucketTimestamps = enabled
+	}
+}
+
+// WithStaleThreshold sets the age of the last successful fetch after which
+// zaim_data_stale is 1. Non-positive values use twice the cache duration
+func WithStaleThreshold(d time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.staleThreshold = d
+	}
+}
+
+// WithZeroFillHours emits hourly metrics with zero values for every hour of
+// the month without transactions, so graphs show zeros instead of gaps
+// This adds up to 744 series per currency and metric; combine with
+// WithMaxHours to bound it
+func WithZeroFillHours(enabled bool) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.zeroFillHours = enabled
+	}
+}
+
+// WithHourlyWindow drops hourly buckets before the active window, so last
+// month's hours disappear when the month rolls over (enabled by default).
+// Disable it for data not dated around the clock, such as fixture files
+func WithHourlyWindow(enabled bool) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.hourlyWindow = enabled
+	}
+}
+
+// WithMaxHours emits hourly metrics only for the most recent hours, bounding
+// series growth over the month. Non-positive values emit every hour
+func WithMaxHours(hours int) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.maxHours = hours
+	}
+}
+
+// WithFetchWindow fetches a rolling window (e.g. the last 30 days) instead of
+// the current month. Clients that cannot fetch arbitrary ranges ignore it
+func WithFetchWindow(window zaim.FetchWindow) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.fetchWindow = window
+	}
+}
+
+// WithCommentTags enables zaim_tagged_payment_amount for tags pattern finds in
+// transaction comments (e.g. `#(\w+)`). maxTags caps the distinct tags exported;
+// non-positive values use DefaultMaxCommentTags
+func WithCommentTags(pattern *regexp.Regexp, maxTags int) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.tagPattern = pattern
+		if maxTags > 0 {
+			c.maxTags = maxTags
+		}
+	}
+}
+
+// WithBaseContext sets the context used for fetches made during scrapes
+// Cancelling it (e.g. on shutdown) aborts in-flight Zaim requests
+func WithBaseContext(ctx context.Context) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.ctx = ctx
+	}
+}
+
+// WithBackfill fetches the given number of months before the current one in
+// the background after the first successful fetch (again every
+// WithBackfillRefreshInterval), pausing spacing before
+// each request of a worker (non-positive uses DefaultBackfillSpacing; see
+// WithBackfillConcurrency). Requires a client that can fetch arbitrary ranges
+func WithBackfill(months int, spacing time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.backfillMonths = months
+		if spacing > 0 {
+			c.backfillSpacing = spacing
+		}
+	}
+}
+
+// WithBackfillRefreshInterval fetches the backfilled months again every
+// interval, replacing the earlier copies. Zero backfills only once; negative
+// values are ignored
+func WithBackfillRefreshInterval(interval time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		if interval >= 0 {
+			c.backfillRefresh = interval
+		}
+	}
+}
+
+// WithBackfillConcurrency sets how many backfill months are fetched in
+// parallel (non-positive uses DefaultBackfillConcurrency)
+func WithBackfillConcurrency(n int) CollectorOption {
+	return func(c *ZaimCollector) {
+		if n > 0 {
+			c.backfillConcurrency = n
+		}
+	}
+}
+
+// WithExcludeNames drops transactions whose name matches pattern before
+// aggregation (see CompileNamePatterns). A nil pattern excludes nothing
+func WithExcludeNames(pattern *regexp.Regexp) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.excludeNames = pattern
+	}
+}
+
+// WithAmountScale multiplies exported amounts by a per-currency factor, e.g.
+// {"USD": 0.01} for accounts recorded in cents. Unlisted currencies are
+// exported as is
+func WithAmountScale(scale map[string]float64) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.amountScale = scale
+	}
+}
+
+// WithAmountRounding rounds exported amounts (after WithAmountScale) to the
+// nearest multiple of step, e.g. 100 turns 1234 into 1200, so shared
+// dashboards do not reveal exact spending. Non-positive steps disable it
+func WithAmountRounding(step float64) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.amountRoundTo = max(step, 0)
+	}
+}
+
+// ParseAmountScale parses a comma-separated list of CURRENCY=factor pairs
+// such as "USD=0.01,EUR=0.01". An empty value returns nil
+func ParseAmountScale(value string) (map[string]float64, error) {
+	var scale map[string]float64
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		currency, factor, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid amount scale %q (want CURRENCY=factor)", pair)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(factor), 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("invalid amount scale factor for %s: %q", currency, factor)
+		}
+		if scale == nil {
+			scale = make(map[string]float64)
+		}
+		scale[strings.ToUpper(strings.TrimSpace(currency))] = f
+	}
+	return scale, nil
+}
+
+// WithPaymentCounter emits zaim_payment_amount_total from counter
+// Share one counter across collectors so re-authentication keeps the total
+func WithPaymentCounter(counter *PaymentCounter) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.paymentCounter = counter
+	}
+}
+
+// WithFailureBackoff stretches the time between fetches while Zaim keeps
+// failing: after n consecutive failures the next fetch waits the cache
+// duration times 2^(n-1), capped at max, serving the last good data meanwhile
+// A success resets it. Zero disables the backoff; negative values keep the default
+func WithFailureBackoff(max time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		if max >= 0 {
+			c.maxBackoff = max
+		}
+	}
+}
+
+// WithDataHardExpiry sets how old the last successfully fetched data may get
+// while fetches fail before Collect stops serving it; until then a failed
+// refresh exports the previous data together with zaim_error. Zero serves it
+// indefinitely; negative values keep the default
+func WithDataHardExpiry(d time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		if d >= 0 {
+			c.hardExpiry = d
+		}
+	}
+}
+
+// WithStartupJitter delays the first fetch by a random duration up to max, so a
+// fleet restarted together does not hit Zaim at once. Until then scrapes get
+// no Zaim data and Status reports the collector as warming
+func WithStartupJitter(max time.Duration) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.startupJitter = max
+	}
+}
+
+// WithUnauthorizedHandler adds a callback run (in its own goroutine) when a
+// fetch is first rejected with 401, e.g. to clear the revoked token
+// Handlers run in the order added; a 401 streak triggers them once
+func WithUnauthorizedHandler(fn func()) CollectorOption {
+	return func(c *ZaimCollector) {
+		c.onUnauthorized = append(c.onUnauthorized, fn)
+	}
+}
+
+func NewZaimCollector(client zaim.TransactionFetcher, aggregator *Aggregator, logger *zap.Logger, opts ...CollectorOption) *ZaimCollector {
+	c := &ZaimCollector{
 		client:        client,
 		aggregator:    aggregator,
 		logger:        logger,
-		cacheDuration: 5 * time.Minute,
+		ctx:           context.Background(),
+		cacheDuration: DefaultCacheDuration,
+		maxTags:       DefaultMaxCommentTags,
+
+		minRefreshInterval: DefaultMinRefreshInterval,
+		maxBackoff:         DefaultMaxFailureBackoff,
+		hardExpiry:         DefaultDataHardExpiry,
+
+		backfillSpacing:     DefaultBackfillSpacing,
+		backfillConcurrency: DefaultBackfillConcurrency,
+		backfillRefresh:     DefaultBackfillRefreshInterval,
+		hourlyWindow:        true,
+
+		collectDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "zaim_collect_duration_seconds",
+			Help:    "Time spent in Collect, including the Zaim fetch on cache misses",
+			Buckets: []float64{.005, .01, .05, .1, .5, 1, 2.5, 5, 10, 30},
+		}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.ctx, c.cancel = context.WithCancel(c.ctx)
+	c.names = NewCategoryResolver(client, c.nameRefreshInterval, logger)
+	if c.startupJitter > 0 {
+		c.warmAt = c.aggregator.now().Add(rand.N(c.startupJitter))
+	}
+	c.warnIfBelowFloor(c.cacheDuration)
+	return c
+}
+
+// warnIfBelowFloor logs when the cache duration cannot take effect because
+// fetches are limited by minRefreshInterval
+func (c *ZaimCollector) warnIfBelowFloor(d time.Duration) {
+	if d < c.minRefreshInterval {
+		c.logger.Warn("cache duration is below the minimum refresh interval; Zaim is fetched at most once per interval",
+			zap.Duration("cache_duration", d),
+			zap.Duration("min_refresh_interval", c.minRefreshInterval))
+	}
+}
+
+// SetCacheDuration changes the cache duration of a running collector
+// The current cache entry is kept and judged against the new duration
+func (c *ZaimCollector) SetCacheDuration(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	c.warnIfBelowFloor(d)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cacheDuration = d
+}
+
+// Run refreshes the cached transactions in the background once per cache
+// duration until ctx is cancelled or Close is called, so scrapes are served from memory
+// instead of waiting on the Zaim API. While it runs, scrapes keep serving the
+// cache after it expires (until the hard expiry) rather than fetching
+func (c *ZaimCollector) Run(ctx context.Context) {
+	ctx, done, ok := c.startBackground(ctx)
+	if !ok {
+		return
+	}
+	defer done()
+
+	c.refreshing.Store(true)
+	defer c.refreshing.Store(false)
+
+	if !c.waitStartupJitter(ctx) {
+		return
+	}
+
+	for {
+		if err := c.refresh(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Error("background refresh failed", zap.Error(err))
+		}
+
+		c.mu.RLock()
+		interval := max(c.cacheDuration, c.minRefreshInterval)
+		c.mu.RUnlock()
+		interval = max(interval, c.backoffRemaining())
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.logger.Debug("background refresh stopped")
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Close stops the collector's background loops and in-flight fetches and
+// waits for them to exit. Later scrapes are served from the last cached data
+// without contacting Zaim. Close is safe to call more than once
+func (c *ZaimCollector) Close() {
+	c.lifecycleMu.Lock()
+	c.closed = true
+	c.lifecycleMu.Unlock()
+
+	c.cancel()
+	c.background.Wait()
+}
+
+// isClosed reports whether Close has been called
+func (c *ZaimCollector) isClosed() bool {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	return c.closed
+}
+
+// startBackground registers a background goroutine with Close. The returned
+// context is also cancelled by Close; call done when the goroutine exits
+// ok is false once the collector is closed
+func (c *ZaimCollector) startBackground(ctx context.Context) (_ context.Context, done func(), ok bool) {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	if c.closed {
+		return ctx, nil, false
 	}
+	c.background.Add(1)
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(c.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		c.background.Done()
+	}, true
+}
+
+// filter merges in the backfilled months and drops transactions excluded by
+// name, as Collect does before aggregating
+func (c *ZaimCollector) filter(transactions []zaim.Transaction) []zaim.Transaction {
+	transactions = c.withBackfill(transactions)
+	if c.excludeNames != nil {
+		transactions, _ = ExcludeByName(transactions, c.excludeNames)
+	}
+	return transactions
+}
+
+// windowCount is zaim_transaction_count: the fetched transactions (the
+// current fetch window, without backfilled months) not excluded by name
+func (c *ZaimCollector) windowCount(transactions []zaim.Transaction) int {
+	if c.excludeNames == nil {
+		return len(transactions)
+	}
+	kept, _ := ExcludeByName(transactions, c.excludeNames)
+	return len(kept)
+}
+
+// hourlyMetrics aggregates the hourly buckets (within the active window
+// unless disabled), applying zero filling and the hour limit
+func (c *ZaimCollector) hourlyMetrics(transactions []zaim.Transaction) map[BucketKey]*HourlyMetrics {
+	hourly := c.aggregator.AggregateByHour(transactions)
+	if c.hourlyWindow {
+		hourly = HoursSince(hourly, c.windowStart())
+	}
+	if c.zeroFillHours {
+		hourly = c.aggregator.FillEmptyHours(hourly)
+	}
+	return LatestHours(hourly, c.maxHours)
+}
+
+// windowStart returns the start of the active window: the fetch window,
+// extended to the first backfilled month, on the aggregator's clock
+func (c *ZaimCollector) windowStart() time.Time {
+	now := c.aggregator.now().In(c.aggregator.location)
+	start, _ := c.fetchWindow.Range(now)
+	if c.backfillMonths > 0 {
+		if backfillStart, _ := zaim.MonthRange(now, c.backfillMonths); backfillStart.Before(start) {
+			start = backfillStart
+		}
+	}
+	return start
+}
+
+// waitStartupJitter sleeps until the startup jitter has elapsed
+// It returns false when ctx is cancelled first
+func (c *ZaimCollector) waitStartupJitter(ctx context.Context) bool {
+	delay := c.warmAt.Sub(c.aggregator.now())
+	if delay <= 0 {
+		return true
+	}
+
+	c.logger.Info("delaying first fetch", zap.Duration("delay", delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// refresh fetches transactions and replaces the cache
+// The fetch runs without holding the lock so scrapes keep using the old data
+func (c *ZaimCollector) refresh(ctx context.Context) error {
+	// A scrape already fetching is joined rather than repeated
+	_, err, _ := c.flight.Do(flightKey, func() (any, error) {
+		transactions, err := c.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.storeCacheLocked(transactions)
+		c.mu.Unlock()
+
+		c.logger.Debug("refreshed cached transactions", zap.Int("count", len(transactions)))
+		return transactions, nil
+	})
+	return err
 }
 
 func (c *ZaimCollector) Describe(ch chan<- *prometheus.Desc) {
@@ -38,94 +688,984 @@ func (c *ZaimCollector) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *ZaimCollector) Collect(ch chan<- prometheus.Metric) {
-	ctx := context.Background()
+	// Observed before export, so the current scrape is already counted.
+	// Compare with zaim_scrape_cache_hit: slow hits are aggregation-bound,
+	// slow misses API-bound
+	start := time.Now()
+	defer func() {
+		c.collectDuration.Observe(time.Since(start).Seconds())
+		ch <- c.collectDuration
+		cacheHit := 0.0
+		if c.scrapeCacheHit.Load() {
+			cacheHit = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("zaim_scrape_cache_hit", "Whether the most recent scrape was served from the cache without fetching from Zaim", nil, nil),
+			prometheus.GaugeValue,
+			cacheHit,
+		)
+	}()
+
+	ctx := c.ctx
 	transactions, err := c.getTransactions(ctx)
+
+	c.statusMu.Lock()
+	tokenValid := 1.0
+	if c.tokenRejected {
+		tokenValid = 0
+	}
+	c.statusMu.Unlock()
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("zaim_token_valid", "Whether Zaim accepted the access token on the last fetch (0 = re-authentication needed)", nil, nil),
+		prometheus.GaugeValue,
+		tokenValid,
+	)
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("zaim_transactions_changed_total", "Transactions whose updated time changed between consecutive fetches (edits)", nil, nil),
+		prometheus.CounterValue,
+		float64(c.transactionsChanged.Load()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("zaim_transactions_new_total", "Transactions not present in the previous fetch", nil, nil),
+		prometheus.CounterValue,
+		float64(c.transactionsNew.Load()),
+	)
+	if reporter, ok := c.client.(zaim.APICallReporter); ok {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("zaim_api_calls_total", "Requests sent to the Zaim API by this collector", nil, nil),
+			prometheus.CounterValue,
+			float64(reporter.APICalls()),
+		)
+	}
+	if reporter, ok := c.client.(zaim.RateLimitReporter); ok {
+		if count, total, enabled := reporter.RateLimitWaits(); enabled {
+			ch <- prometheus.MustNewConstSummary(
+				prometheus.NewDesc("zaim_rate_limit_wait_seconds", "Time Zaim requests waited for the client-side rate limit", nil, nil),
+				count,
+				total.Seconds(),
+				nil,
+			)
+		}
+	}
+	if reporter, ok := c.client.(zaim.ClockSkewReporter); ok {
+		if skew, measured := reporter.ClockSkew(); measured {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_exporter_time_skew_seconds", "Local clock minus the Date of the last Zaim API response (positive = local clock ahead)", nil, nil),
+				prometheus.GaugeValue,
+				skew.Seconds(),
+			)
+		}
+	}
+
+	if errors.Is(err, errWarming) {
+		return
+	}
+
+	// Exported on failures too, so one simple rule alerts on stale data
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("zaim_data_stale", "Whether the last successful fetch is older than the stale threshold (1 = stale)", nil, nil),
+		prometheus.GaugeValue,
+		c.dataStale(),
+	)
+	if age, ok := c.dataAge(); ok {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("zaim_data_age_seconds", "Seconds since the exported data was last fetched successfully", nil, nil),
+			prometheus.GaugeValue,
+			age.Seconds(),
+		)
+	}
+
+	// Separates "nothing spent" (success with zero transactions) from a failed fetch
+	fetchSuccess := 1.0
+	if err != nil {
+		fetchSuccess = 0
+	}
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("zaim_fetch_success", "Whether the last fetch from Zaim succeeded (1), even if it returned no transactions", nil, nil),
+		prometheus.GaugeValue,
+		fetchSuccess,
+	)
+
+	// A failed refresh still exports the last good data (if not hard-expired)
 	if err != nil {
 		c.logger.Error("failed to get transactions", zap.Error(err))
 		ch <- prometheus.MustNewConstMetric(
 			prometheus.NewDesc("zaim_error", "Error fetching data from Zaim API", []string{"type"}, nil),
 			prometheus.GaugeValue,
 			1,
-			"api_error",
+			errorType(err),
 		)
-		return
+		if transactions == nil {
+			return
+		}
 	}
 
-	// Aggregate metrics
-	hourlyMetrics := c.aggregator.AggregateByHour(transactions)
-	todayTotal := c.aggregator.GetTodayTotal(transactions)
+	count := c.windowCount(transactions)
+	transactions = c.withBackfill(transactions)
 
-	// Export hourly payment metrics
-	for hour, metrics := range hourlyMetrics {
-		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc("zaim_payment_amount", "Total payment amount per hour", []string{"hour"}, nil),
-			prometheus.GaugeValue,
-			float64(metrics.PaymentTotal),
-			hour,
-		)
+	// Drop excluded transactions (e.g. adjustments) before any aggregation
+	if c.excludeNames != nil {
+		var excluded int
+		transactions, excluded = ExcludeByName(transactions, c.excludeNames)
 		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc("zaim_payment_count", "Number of payments per hour", []string{"hour"}, nil),
+			prometheus.NewDesc("zaim_excluded_transaction_count", "Transactions dropped by the name exclusion filter", nil, nil),
 			prometheus.GaugeValue,
-			float64(metrics.PaymentCount),
-			hour,
+			float64(excluded),
 		)
+	}
+
+	// Explicit 0 when Zaim returned nothing (e.g. early in the month)
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc("zaim_transaction_count", "Transactions in the current fetch window (0 when the fetch succeeded but returned none)", nil, nil),
+		prometheus.GaugeValue,
+		float64(count),
+	)
+
+	// Export the newest transaction so new entries can be seen flowing in
+	if latest, created, ok := c.aggregator.LatestTransaction(transactions); ok {
 		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc("zaim_income_amount", "Total income amount per hour", []string{"hour"}, nil),
+			prometheus.NewDesc("zaim_latest_transaction_timestamp", "Unix timestamp of the most recently created transaction", nil, nil),
 			prometheus.GaugeValue,
-			float64(metrics.IncomeTotal),
-			hour,
+			float64(created.Unix()),
 		)
 		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc("zaim_income_count", "Number of income transactions per hour", []string{"hour"}, nil),
+			prometheus.NewDesc("zaim_latest_transaction_info", "Name and mode of the most recently created transaction (always 1)", []string{"name", "mode"}, nil),
 			prometheus.GaugeValue,
-			float64(metrics.IncomeCount),
-			hour,
+			1,
+			latest.Name, latest.Mode,
 		)
 	}
 
-	// Export today's total
+	// Aggregate metrics
 	ch <- prometheus.MustNewConstMetric(
-		prometheus.NewDesc("zaim_today_total_amount", "Today's total spending", nil, nil),
+		prometheus.NewDesc("zaim_unparseable_timestamp_count", "Transactions left out of hourly metrics because their created timestamp could not be parsed", nil, nil),
 		prometheus.GaugeValue,
-		float64(todayTotal),
+		float64(c.aggregator.CountUnparseableTimestamps(transactions)),
 	)
+	hourlyMetrics := c.hourlyMetrics(transactions)
+	dailyMetrics := c.aggregator.AggregateByDay(transactions)
+	todayTotals := c.aggregator.GetTodayTotal(transactions)
+	monthBalances := c.aggregator.GetMonthBalance(transactions)
+
+	includePayment := c.aggregator.IncludesMode("payment")
+	includeIncome := c.aggregator.IncludesMode("income")
+	includeTransfer := c.aggregator.IncludesMode("transfer")
+
+	// Export hourly payment/income metrics
+	for key, metrics := range hourlyMetrics {
+		if includePayment {
+			ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_payment_amount", "Total payment amount per hour", []string{"hour", "currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(metrics.PaymentTotal, key.Currency),
+				key.Period, key.Currency,
+			), key.Period, HourLayout)
+			ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_payment_count", "Number of payments per hour", []string{"hour", "currency"}, nil),
+				prometheus.GaugeValue,
+				float64(metrics.PaymentCount),
+				key.Period, key.Currency,
+			), key.Period, HourLayout)
+		}
+		if includeIncome {
+			ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_income_amount", "Total income amount per hour", []string{"hour", "currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(metrics.IncomeTotal, key.Currency),
+				key.Period, key.Currency,
+			), key.Period, HourLayout)
+			ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_income_count", "Number of income transactions per hour", []string{"hour", "currency"}, nil),
+				prometheus.GaugeValue,
+				float64(metrics.IncomeCount),
+				key.Period, key.Currency,
+			), key.Period, HourLayout)
+		}
+	}
+
+	// Export per-day payment/income metrics
+	if c.dailySeries {
+		for key, metrics := range dailyMetrics {
+			if includePayment {
+				ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_daily_payment_amount", "Total payment amount per day", []string{"date", "currency"}, nil),
+					prometheus.GaugeValue,
+					c.scaleAmount(metrics.PaymentTotal, key.Currency),
+					key.Period, key.Currency,
+				), key.Period, DayLayout)
+				ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_daily_payment_count", "Number of payments per day", []string{"date", "currency"}, nil),
+					prometheus.GaugeValue,
+					float64(metrics.PaymentCount),
+					key.Period, key.Currency,
+				), key.Period, DayLayout)
+			}
+			if includeIncome {
+				ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_daily_income_amount", "Total income amount per day", []string{"date", "currency"}, nil),
+					prometheus.GaugeValue,
+					c.scaleAmount(metrics.IncomeTotal, key.Currency),
+					key.Period, key.Currency,
+				), key.Period, DayLayout)
+				ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_daily_income_count", "Number of income transactions per day", []string{"date", "currency"}, nil),
+					prometheus.GaugeValue,
+					float64(metrics.IncomeCount),
+					key.Period, key.Currency,
+				), key.Period, DayLayout)
+			}
+		}
+	}
+
+	if includePayment {
+		// Export the cumulative payment counter (see PaymentCounter for reset semantics)
+		if c.paymentCounter != nil {
+			c.paymentCounter.Observe(transactions, c.windowStart(), c.aggregator.now().In(c.aggregator.location))
+			for currency, total := range c.paymentCounter.Totals() {
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_payment_amount_total", "Cumulative payment amount, counting each transaction once", []string{"currency"}, nil),
+					prometheus.CounterValue,
+					c.scaleAmount(total, currency),
+					currency,
+				)
+			}
+		}
+
+		// Export daily average payment amount (days without payments are skipped)
+		for key, metrics := range dailyMetrics {
+			avg, ok := metrics.AveragePayment()
+			if !ok {
+				continue
+			}
+			ch <- c.bucketTimestamp(prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_payment_avg_amount", "Average payment amount per day", []string{"day", "currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(avg, key.Currency),
+				key.Period, key.Currency,
+			), key.Period, DayLayout)
+		}
+
+		// Export payment breakdown by genre
+		if c.genreMetrics {
+			for key, metrics := range c.aggregator.AggregateByGenre(transactions) {
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_payment_amount_by_genre", "Total payment amount per genre", []string{"genre_id", "genre", "currency"}, nil),
+					prometheus.GaugeValue,
+					c.scaleAmount(metrics.PaymentTotal, key.Currency),
+					strconv.Itoa(key.GenreID), c.names.NameForGenre(ctx, key.GenreID), key.Currency,
+				)
+			}
+		}
+
+		// Export payment breakdown by source account
+		if c.accountMetrics {
+			accountNames := c.getAccountNames(ctx)
+			for key, total := range c.aggregator.AggregateByAccount(transactions) {
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_payment_amount_by_account", "Total payment amount per source account", []string{"account_id", "account", "currency"}, nil),
+					prometheus.GaugeValue,
+					c.scaleAmount(total, key.Currency),
+					strconv.Itoa(key.AccountID), accountNames[key.AccountID], key.Currency,
+				)
+			}
+		}
+
+		// Export payment totals per comment tag
+		if c.tagPattern != nil {
+			tagTotals, dropped := c.aggregator.AggregateByTag(transactions, c.tagPattern, c.maxTags)
+			if dropped > 0 {
+				c.logger.Warn("comment tags over the limit were dropped",
+					zap.Int("max_tags", c.maxTags),
+					zap.Int("dropped", dropped))
+			}
+			for key, total := range tagTotals {
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_tagged_payment_amount", "Total payment amount per comment tag", []string{"tag", "currency"}, nil),
+					prometheus.GaugeValue,
+					c.scaleAmount(total, key.Currency),
+					key.Tag, key.Currency,
+				)
+			}
+		}
+
+		// Export today's total per currency
+		for currency, total := range todayTotals {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_today_total_amount", "Today's total spending", []string{"currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(total, currency),
+				currency,
+			)
+		}
+
+		// Export today's largest payment per currency (skipped when there is none)
+		for currency, tx := range c.aggregator.GetTodayMaxPayment(transactions) {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_today_max_payment_amount", "Largest single payment today", []string{"name", "currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(tx.AmountValue(), currency),
+				tx.Name, currency,
+			)
+		}
+	}
+
+	// Export how many categories were spent in this month and the smoothed daily spend
+	if includePayment {
+		for currency, avg := range c.aggregator.TrailingDailyAverage(dailyMetrics, trailingAverageDays, c.windowStart()) {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_payment_7day_avg_amount", "Mean daily payment total over the trailing 7 days", []string{"currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(avg, currency),
+				currency,
+			)
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("zaim_active_category_count", "Number of distinct categories with payments this month", nil, nil),
+			prometheus.GaugeValue,
+			float64(c.aggregator.CountActiveCategories(transactions)),
+		)
+
+		withReceipt, withoutReceipt := c.aggregator.CountReceipts(transactions)
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("zaim_month_transactions_with_receipt", "Payments this month with a receipt attached", nil, nil),
+			prometheus.GaugeValue,
+			float64(withReceipt),
+		)
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("zaim_month_transactions_without_receipt", "Payments this month without a receipt attached", nil, nil),
+			prometheus.GaugeValue,
+			float64(withoutReceipt),
+		)
+	}
+
+	// Export the month-end payment total at the current pace
+	if includePayment {
+		for currency, balance := range monthBalances {
+			if projected, ok := c.aggregator.ProjectMonthTotal(balance.PaymentTotal); ok {
+				ch <- prometheus.MustNewConstMetric(
+					prometheus.NewDesc("zaim_projected_month_total_amount", "This month's payments extrapolated linearly to the end of the month", []string{"currency"}, nil),
+					prometheus.GaugeValue,
+					c.scaleAmount(projected, currency),
+					currency,
+				)
+			}
+		}
+	}
+
+	// Export what is left of the configured monthly budgets
+	if includePayment {
+		for categoryID, remaining := range c.aggregator.BudgetRemaining(transactions) {
+			category := "all"
+			if categoryID != BudgetAll {
+				category = strconv.Itoa(categoryID)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_budget_remaining_amount", "Monthly budget minus payments this month (negative when over budget)", []string{"category_id", "currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(float64(remaining), zaim.DefaultCurrency),
+				category, zaim.DefaultCurrency,
+			)
+		}
+	}
+
+	// Export income breakdown by category, under the same flag as the
+	// payment genre breakdown
+	if includeIncome && c.genreMetrics {
+		for key, total := range c.aggregator.AggregateIncomeByCategory(transactions) {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_income_amount_by_category", "Total income amount per category", []string{"category_id", "category", "currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(total, key.Currency),
+				strconv.Itoa(key.CategoryID), c.names.NameForCategory(ctx, key.CategoryID), key.Currency,
+			)
+		}
+	}
+
+	// Export current month income/payment totals and balance per currency
+	// The balance needs both sides, so it is only emitted when both modes are enabled
+	for currency, balance := range monthBalances {
+		if includeIncome {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_month_income_total", "Total income this month", []string{"currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(balance.IncomeTotal, currency),
+				currency,
+			)
+		}
+		if includePayment {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_month_payment_total", "Total payments this month", []string{"currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(balance.PaymentTotal, currency),
+				currency,
+			)
+		}
+		if includeIncome && includePayment {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_month_balance_amount", "Income minus payments this month (transfers excluded)", []string{"currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(balance.Balance(), currency),
+				currency,
+			)
+		}
+		if includeTransfer {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc("zaim_month_transfer_total", "Total moved between own accounts this month (not part of the balance)", []string{"currency"}, nil),
+				prometheus.GaugeValue,
+				c.scaleAmount(balance.TransferTotal, currency),
+				currency,
+			)
+		}
+	}
+
+	if c.accountSplit {
+		c.collectAccountFlows(ctx, ch, transactions)
+	}
 
-	// Export last update time
+	// Export the time of the last successful fetch (not the scrape time),
+	// so staleness alerts fire while scrapes are served from the cache
+	c.statusMu.Lock()
+	lastSuccess := c.lastSuccess
+	c.statusMu.Unlock()
 	ch <- prometheus.MustNewConstMetric(
 		prometheus.NewDesc("zaim_last_update", "Unix timestamp of last successful update", nil, nil),
 		prometheus.GaugeValue,
-		float64(time.Now().Unix()),
+		float64(lastSuccess.UnixNano())/float64(time.Second),
 	)
 }
 
+// getTransactions returns the cached transactions, fetching when the cache
+// has expired. scrapeCacheHit records whether the call was served without
+// fetching; scrapes that wait for another scrape's fetch count as misses
 func (c *ZaimCollector) getTransactions(ctx context.Context) ([]zaim.Transaction, error) {
+	if c.warming() {
+		c.scrapeCacheHit.Store(false)
+		return nil, errWarming
+	}
+	if c.isClosed() {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		c.scrapeCacheHit.Store(c.cache != nil)
+		if c.cache == nil {
+			return nil, errClosed
+		}
+		return c.cache.data, nil
+	}
+
 	c.mu.RLock()
-	if c.cache != nil && time.Since(c.cache.timestamp) < c.cacheDuration {
+	if c.cache != nil && c.aggregator.now().Sub(c.cache.timestamp) < c.cacheDuration {
 		c.logger.Debug("using cached transactions")
 		data := c.cache.data
 		c.mu.RUnlock()
+		c.scrapeCacheHit.Store(true)
 		return data, nil
 	}
+	// The next background refresh is due; keep serving the old data meanwhile
+	if c.refreshing.Load() {
+		if data := c.lastGoodLocked(); data != nil {
+			c.mu.RUnlock()
+			c.scrapeCacheHit.Store(true)
+			return data, nil
+		}
+	}
 	c.mu.RUnlock()
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	// Concurrent cache misses share one load (and its error)
+	hit := false
+	v, err, _ := c.flight.Do(flightKey, func() (any, error) {
+		data, fetched, err := c.loadTransactions(ctx)
+		hit = !fetched
+		return data, err
+	})
+	c.scrapeCacheHit.Store(hit)
+	transactions, _ := v.([]zaim.Transaction)
+	return transactions, err
+}
 
-	// Double-check after acquiring write lock
-	if c.cache != nil && time.Since(c.cache.timestamp) < c.cacheDuration {
-		return c.cache.data, nil
+// loadTransactions refetches unless the cache was refreshed meanwhile, the
+// minimum refresh interval has not passed or fetching is backing off
+// The request runs without c.mu, so scrapes joining it and readers of the
+// cache are not blocked behind the Zaim API
+// fetched reports whether Zaim was called
+func (c *ZaimCollector) loadTransactions(ctx context.Context) (transactions []zaim.Transaction, fetched bool, err error) {
+	c.mu.RLock()
+	// Double-check: a poll may have refreshed the cache meanwhile
+	if c.cache != nil && c.aggregator.now().Sub(c.cache.timestamp) < c.cacheDuration {
+		data := c.cache.data
+		c.mu.RUnlock()
+		return data, false, nil
 	}
 
-	transactions, err := c.client.GetCurrentMonthTransactions(ctx)
+	// Too soon after the last fetch, or backing off after failures: serve
+	// stale data (or the last error)
+	c.statusMu.Lock()
+	wait := max(c.minRefreshInterval, c.failureBackoff(c.cacheDuration, c.failures))
+	tooSoon := c.aggregator.now().Sub(c.lastAttempt) < wait
+	lastError := c.lastError
+	c.statusMu.Unlock()
+	if tooSoon {
+		data := c.lastGoodLocked()
+		c.mu.RUnlock()
+		if data != nil {
+			c.logger.Debug("minimum refresh interval not reached, using stale cache")
+			return data, false, nil
+		}
+		if lastError != nil {
+			return nil, false, lastError
+		}
+	} else {
+		c.mu.RUnlock()
+	}
+
+	// On failure keep serving the last good data alongside the error
+	transactions, err = c.fetch(ctx)
 	if err != nil {
-		return nil, err
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.lastGoodLocked(), true, err
+	}
+
+	c.mu.Lock()
+	c.storeCacheLocked(transactions)
+	c.mu.Unlock()
+
+	c.logger.Info("fetched and cached transactions", zap.Int("count", len(transactions)))
+	return transactions, true, nil
+}
+
+// storeCacheLocked replaces the cache with transactions, counting the ones
+// that are new or whose Updated changed since the previous fetch; c.mu must
+// be held. The first fetch has nothing to compare against and counts nothing
+func (c *ZaimCollector) storeCacheLocked(transactions []zaim.Transaction) {
+	if c.cache != nil {
+		previous := make(map[int64]string, len(c.cache.data))
+		for _, tx := range c.cache.data {
+			previous[tx.ID] = tx.Updated
+		}
+		var changed, added uint64
+		for _, tx := range transactions {
+			updated, ok := previous[tx.ID]
+			switch {
+			case !ok:
+				added++
+			case updated != tx.Updated:
+				changed++
+			}
+		}
+		c.transactionsChanged.Add(changed)
+		c.transactionsNew.Add(added)
 	}
 
 	c.cache = &metricsCache{
 		data:      transactions,
-		timestamp: time.Now(),
+		timestamp: c.aggregator.now(),
 	}
+}
 
-	c.logger.Info("fetched and cached transactions", zap.Int("count", len(transactions)))
-	return transactions, nil
-}
\ No newline at end of file
+// lastGoodLocked returns the cached data unless it is older than the hard
+// expiry; c.mu must be held
+func (c *ZaimCollector) lastGoodLocked() []zaim.Transaction {
+	if c.cache == nil || (c.hardExpiry > 0 && c.aggregator.now().Sub(c.cache.timestamp) >= c.hardExpiry) {
+		return nil
+	}
+	return c.cache.data
+}
+
+// failureBackoff returns the minimum time between fetches after failures
+// consecutive failures: cacheDuration doubled per failure after the first,
+// capped at maxBackoff. No failures (or a disabled backoff) means no wait
+func (c *ZaimCollector) failureBackoff(cacheDuration time.Duration, failures int) time.Duration {
+	if failures == 0 || c.maxBackoff <= 0 {
+		return 0
+	}
+	backoff := cacheDuration
+	for i := 1; i < failures && backoff < c.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, c.maxBackoff)
+}
+
+// backoffRemaining returns how much longer fetches are held back by the
+// failure backoff (non-positive when a fetch may run now)
+func (c *ZaimCollector) backoffRemaining() time.Duration {
+	c.mu.RLock()
+	cacheDuration := c.cacheDuration
+	c.mu.RUnlock()
+
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	return c.failureBackoff(cacheDuration, c.failures) - c.aggregator.now().Sub(c.lastAttempt)
+}
+
+// dataAge returns the time since the last successful fetch; ok is false
+// before the first one
+func (c *ZaimCollector) dataAge() (age time.Duration, ok bool) {
+	c.statusMu.Lock()
+	lastSuccess := c.lastSuccess
+	c.statusMu.Unlock()
+
+	if lastSuccess.IsZero() {
+		return 0, false
+	}
+	return c.aggregator.now().Sub(lastSuccess), true
+}
+
+// dataStale returns 1 when the last successful fetch is older than the stale
+// threshold (or there has been none), else 0
+func (c *ZaimCollector) dataStale() float64 {
+	threshold := c.staleThreshold
+	if threshold <= 0 {
+		c.mu.RLock()
+		threshold = 2 * c.cacheDuration
+		c.mu.RUnlock()
+	}
+
+	c.statusMu.Lock()
+	lastSuccess := c.lastSuccess
+	c.statusMu.Unlock()
+
+	if lastSuccess.IsZero() || c.aggregator.now().Sub(lastSuccess) > threshold {
+		return 1
+	}
+	return 0
+}
+
+// scaleAmount applies the configured factor for currency to amount, then
+// the configured rounding
+func (c *ZaimCollector) scaleAmount(amount float64, currency string) float64 {
+	if f, ok := c.amountScale[currency]; ok {
+		amount *= f
+	}
+	if c.amountRoundTo > 0 {
+		amount = math.Round(amount/c.amountRoundTo) * c.amountRoundTo
+	}
+	return amount
+}
+
+var (
+	// errWarming is returned by getTransactions before the startup jitter elapses
+	errWarming = errors.New("collector is warming up")
+
+	// errClosed is returned by getTransactions after Close when nothing is cached
+	errClosed = errors.New("collector is closed")
+)
+
+// warming reports whether the first fetch is still held back by the startup
+// jitter and no data has been cached yet
+func (c *ZaimCollector) warming() bool {
+	if c.warmAt.IsZero() || !c.aggregator.now().Before(c.warmAt) {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cache == nil
+}
+
+// withBackfill returns transactions plus the backfilled prior months, starting
+// the backfill loop on first use. Rows already in transactions take precedence
+func (c *ZaimCollector) withBackfill(transactions []zaim.Transaction) []zaim.Transaction {
+	if c.backfillMonths <= 0 {
+		return transactions
+	}
+	c.backfillOnce.Do(func() {
+		ctx, done, ok := c.startBackground(c.ctx)
+		if !ok {
+			return
+		}
+		go func() {
+			defer done()
+			c.runBackfill(ctx)
+		}()
+	})
+
+	c.backfillMu.RLock()
+	defer c.backfillMu.RUnlock()
+	if len(c.backfillData) == 0 {
+		return transactions
+	}
+
+	seen := make(map[int64]bool, len(transactions))
+	for _, tx := range transactions {
+		seen[tx.ID] = true
+	}
+	var merged []zaim.Transaction
+	for _, month := range slices.Sorted(maps.Keys(c.backfillData)) {
+		for _, tx := range c.backfillData[month] {
+			if !seen[tx.ID] {
+				merged = append(merged, tx)
+			}
+		}
+	}
+	return append(merged, transactions...)
+}
+
+// runBackfill runs a backfill pass, then another every backfillRefresh until
+// ctx is cancelled
+func (c *ZaimCollector) runBackfill(ctx context.Context) {
+	for {
+		c.backfill(ctx)
+		if c.backfillRefresh <= 0 {
+			return
+		}
+
+		timer := time.NewTimer(c.backfillRefresh)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// backfill fetches the prior months with up to backfillConcurrency requests
+// in flight, each worker pausing backfillSpacing before its requests, and
+// publishes each month as it arrives, replacing the previous pass's copy.
+// Failed months are logged and keep their previous copy; months that have
+// left the backfill range are dropped
+func (c *ZaimCollector) backfill(ctx context.Context) {
+	fetcher, ok := c.client.(zaim.RangeFetcher)
+	if !ok {
+		c.logger.Warn("backfill requires a client that can fetch date ranges, skipping")
+		return
+	}
+
+	// Newest first, so with one worker recent history arrives first
+	now := c.aggregator.now().In(c.aggregator.location)
+	months := make(chan int, c.backfillMonths)
+	inRange := make(map[string]bool, c.backfillMonths)
+	for monthsAgo := 1; monthsAgo <= c.backfillMonths; monthsAgo++ {
+		months <- monthsAgo
+		startDate, _ := zaim.MonthRange(now, monthsAgo)
+		inRange[startDate.Format("2006-01")] = true
+	}
+	close(months)
+
+	var (
+		wg       sync.WaitGroup
+		failedMu sync.Mutex
+		failed   []string
+	)
+	for range min(c.backfillConcurrency, c.backfillMonths) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for monthsAgo := range months {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(c.backfillSpacing):
+				}
+
+				startDate, endDate := zaim.MonthRange(now, monthsAgo)
+				month := startDate.Format("2006-01")
+				transactions, err := fetcher.GetTransactions(ctx, startDate, endDate)
+				if err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					c.logger.Warn("failed to backfill month", zap.String("month", month), zap.Error(err))
+					failedMu.Lock()
+					failed = append(failed, month)
+					failedMu.Unlock()
+					continue
+				}
+
+				c.backfillMu.Lock()
+				if c.backfillData == nil {
+					c.backfillData = make(map[string][]zaim.Transaction)
+				}
+				c.backfillData[month] = transactions
+				c.backfillMu.Unlock()
+
+				c.logger.Info("backfilled month", zap.String("month", month), zap.Int("count", len(transactions)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.backfillMu.Lock()
+	maps.DeleteFunc(c.backfillData, func(month string, _ []zaim.Transaction) bool { return !inRange[month] })
+	c.backfillMu.Unlock()
+
+	if len(failed) > 0 {
+		slices.Sort(failed)
+		c.logger.Warn("backfill incomplete", zap.Strings("failed_months", failed))
+	}
+}
+
+// bucketTimestamp attaches the bucket start time to m when enabled
+func (c *ZaimCollector) bucketTimestamp(m prometheus.Metric, period, layout string) prometheus.Metric {
+	if !c.bucketTimestamps {
+		return m
+	}
+	t, err := time.ParseInLocation(layout, period, c.aggregator.location)
+	if err != nil {
+		return m
+	}
+	return prometheus.NewMetricWithTimestamp(t, m)
+}
+
+// errorType maps a fetch error to the zaim_error type label
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, zaim.ErrUnauthorized):
+		return "unauthorized"
+	case errors.Is(err, zaim.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, zaim.ErrServerError):
+		return "server_error"
+	case errors.Is(err, zaim.ErrDecode):
+		return "decode_error"
+	default:
+		return "api_error"
+	}
+}
+
+// fetch retrieves transactions for the configured fetch window and records
+// the outcome for Status
+func (c *ZaimCollector) fetch(ctx context.Context) ([]zaim.Transaction, error) {
+	var transactions []zaim.Transaction
+	var err error
+	if fetcher, ok := c.client.(zaim.RangeFetcher); ok && !c.fetchWindow.IsMonth() {
+		startDate, endDate := c.fetchWindow.Range(c.aggregator.now().In(c.aggregator.location))
+		transactions, err = fetcher.GetTransactions(ctx, startDate, endDate)
+	} else {
+		transactions, err = c.client.GetCurrentMonthTransactions(ctx)
+	}
+
+	unauthorized := errors.Is(err, zaim.ErrUnauthorized)
+
+	c.statusMu.Lock()
+	c.lastError = err
+	c.lastAttempt = c.aggregator.now()
+	if err == nil {
+		c.lastSuccess = c.aggregator.now()
+		c.failures = 0
+	} else if ctx.Err() == nil {
+		c.failures++
+	}
+	newlyRejected := unauthorized && !c.tokenRejected
+	if unauthorized || err == nil {
+		c.tokenRejected = unauthorized
+	}
+	c.statusMu.Unlock()
+
+	if newlyRejected {
+		c.logger.Warn("Zaim rejected the access token, re-authenticate via /zaim/auth")
+		if handlers := c.onUnauthorized; len(handlers) > 0 {
+			// Run outside Collect: a handler may unregister this collector
+			go func() {
+				for _, fn := range handlers {
+					fn()
+				}
+			}()
+		}
+	}
+
+	return transactions, err
+}
+
+// CollectorStatus describes the state of the registered Zaim collector
+type CollectorStatus struct {
+	Registered         bool      `json:"registered"`
+	LastSuccess        time.Time `json:"last_success,omitzero"`
+	LastError          string    `json:"last_error,omitempty"`
+	CachedTransactions int       `json:"cached_transactions"`
+	Warming            bool      `json:"warming,omitempty"`
+}
+
+// Status reports the last fetch outcome and the number of cached transactions
+func (c *ZaimCollector) Status() CollectorStatus {
+	status := CollectorStatus{Registered: true}
+
+	c.statusMu.Lock()
+	status.LastSuccess = c.lastSuccess
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	c.statusMu.Unlock()
+
+	c.mu.RLock()
+	if c.cache != nil {
+		status.CachedTransactions = len(c.cache.data)
+	}
+	c.mu.RUnlock()
+
+	status.Warming = c.warming()
+
+	return status
+}
+
+// collectAccountFlows exports this month's flows per account and the net
+// worth change summed over all of them
+func (c *ZaimCollector) collectAccountFlows(ctx context.Context, ch chan<- prometheus.Metric, transactions []zaim.Transaction) {
+	accountNames := c.getAccountNames(ctx)
+	labels := []string{"account_id", "account", "currency"}
+	descs := []struct {
+		desc  *prometheus.Desc
+		value func(*AccountFlow) float64
+	}{
+		{prometheus.NewDesc("zaim_account_month_payment_total", "Payments from the account this month", labels, nil), func(f *AccountFlow) float64 { return f.Payment }},
+		{prometheus.NewDesc("zaim_account_month_income_total", "Income into the account this month", labels, nil), func(f *AccountFlow) float64 { return f.Income }},
+		{prometheus.NewDesc("zaim_account_month_transfer_in_total", "Transfers into the account this month", labels, nil), func(f *AccountFlow) float64 { return f.TransferIn }},
+		{prometheus.NewDesc("zaim_account_month_transfer_out_total", "Transfers out of the account this month", labels, nil), func(f *AccountFlow) float64 { return f.TransferOut }},
+		{prometheus.NewDesc("zaim_account_month_net_change", "Income and transfers in minus payments and transfers out this month", labels, nil), (*AccountFlow).Net},
+	}
+
+	netWorth := map[string]float64{zaim.DefaultCurrency: 0}
+	for key, flow := range c.aggregator.AggregateAccountFlows(transactions) {
+		netWorth[key.Currency] += flow.Net()
+		if key.AccountID == 0 {
+			continue
+		}
+		for _, d := range descs {
+			ch <- prometheus.MustNewConstMetric(d.desc, prometheus.GaugeValue,
+				c.scaleAmount(d.value(flow), key.Currency),
+				strconv.Itoa(key.AccountID), accountNames[key.AccountID], key.Currency,
+			)
+		}
+	}
+
+	for currency, net := range netWorth {
+		ch <- prometheus.MustNewConstMetric(
+			prometheus.NewDesc("zaim_total_net_worth_change", "Change of all accounts combined this month (income minus payments; transfers between accounts cancel out)", []string{"currency"}, nil),
+			prometheus.GaugeValue,
+			c.scaleAmount(net, currency),
+			currency,
+		)
+	}
+}
+
+// getAccountNames returns account names, fetching them on first use
+// Failures are logged and retried no more often than nameMissRetry; metrics
+// are still emitted with an empty account label in the meantime
+func (c *ZaimCollector) getAccountNames(ctx context.Context) map[int]string {
+	c.accountMu.Lock()
+	defer c.accountMu.Unlock()
+
+	if c.accountNames != nil {
+		return c.accountNames
+	}
+
+	fetcher, ok := c.client.(zaim.AccountFetcher)
+	if !ok {
+		return nil
+	}
+
+	now := c.aggregator.now()
+	if !c.accountTriedAt.IsZero() && now.Sub(c.accountTriedAt) < nameMissRetry {
+		return nil
+	}
+	c.accountTriedAt = now
+
+	names, err := fetcher.GetAccounts(ctx)
+	if err != nil {
+		c.logger.Warn("failed to fetch account names", zap.Error(err))
+		return nil
+	}
+
+	c.accountNames = names
+	return names
+}
@@ -0,0 +1,1557 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+// gatherFamilies は独立したレジストリに collector を登録し、メトリクス名ごとに収集結果を返す
+func gatherFamilies(t *testing.T, collector prometheus.Collector) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(collector))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	result := make(map[string]*dto.MetricFamily, len(families))
+	for _, family := range families {
+		result[family.GetName()] = family
+	}
+	return result
+}
+
+// findMetric は指定ラベルの値が一致するサンプルを返す（見つからなければ nil）
+func findMetric(family *dto.MetricFamily, labelName, labelValue string) *dto.Metric {
+	if family == nil {
+		return nil
+	}
+	for _, metric := range family.GetMetric() {
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == labelName && label.GetValue() == labelValue {
+				return metric
+			}
+		}
+	}
+	return nil
+}
+
+func TestZaimCollector_PaymentAverageByDay(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 500},
+			{ID: 2, Mode: "payment", Date: "2024-01-15", Amount: 1000},
+			{ID: 3, Mode: "payment", Date: "2024-01-15", Amount: 1500},
+			// 支出のない日（収入のみ）は平均を出力しない
+			{ID: 4, Mode: "income", Date: "2024-01-16", Amount: 2000},
+		},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop())
+
+	families := gatherFamilies(t, collector)
+	family := families["zaim_payment_avg_amount"]
+	require.NotNil(t, family)
+
+	metric := findMetric(family, "day", "2024-01-15")
+	require.NotNil(t, metric)
+	assert.Equal(t, 1000.0, metric.GetGauge().GetValue())
+
+	assert.Nil(t, findMetric(family, "day", "2024-01-16"))
+	assert.Len(t, family.GetMetric(), 1)
+}
+
+func TestZaimCollector_CurrencyLabel(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:05:00", Amount: 1000},
+			{ID: 2, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:45:00", Amount: 25, Currency: "USD"},
+		},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+
+	family := gatherFamilies(t, collector)["zaim_payment_amount"]
+	require.NotNil(t, family)
+	require.Len(t, family.GetMetric(), 2)
+
+	jpy := findMetric(family, "currency", "JPY")
+	require.NotNil(t, jpy)
+	assert.Equal(t, 1000.0, jpy.GetGauge().GetValue())
+
+	usd := findMetric(family, "currency", "USD")
+	require.NotNil(t, usd)
+	assert.Equal(t, 25.0, usd.GetGauge().GetValue())
+}
+
+// genreFetcher はジャンル名の取得にも対応したモック
+type genreFetcher struct {
+	mockTransactionFetcher
+	genres     map[int]string
+	genreCalls int
+}
+
+func (f *genreFetcher) GetGenres(ctx context.Context) (map[int]string, error) {
+	f.genreCalls++
+	return f.genres, nil
+}
+
+func TestZaimCollector_GenreMetrics(t *testing.T) {
+	fetcher := &genreFetcher{
+		mockTransactionFetcher: mockTransactionFetcher{
+			transactions: []zaim.Transaction{
+				{ID: 1, Mode: "payment", CategoryID: 101, GenreID: 10101, Amount: 800},
+				{ID: 2, Mode: "payment", CategoryID: 101, GenreID: 10102, Amount: 1500},
+			},
+		},
+		genres: map[int]string{10101: "食料品", 10102: "外食"},
+	}
+
+	t.Run("無効時は出力しない", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop())
+		assert.NotContains(t, gatherFamilies(t, collector), "zaim_payment_amount_by_genre")
+	})
+
+	t.Run("有効時はジャンル名付きで出力", func(t *testing.T) {
+		fetcher.genreCalls = 0
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(), WithGenreMetrics(true))
+
+		family := gatherFamilies(t, collector)["zaim_payment_amount_by_genre"]
+		require.NotNil(t, family)
+		require.Len(t, family.GetMetric(), 2)
+
+		groceries := findMetric(family, "genre_id", "10101")
+		require.NotNil(t, groceries)
+		assert.Equal(t, 800.0, groceries.GetGauge().GetValue())
+		assert.NotNil(t, findMetric(family, "genre", "食料品"))
+		assert.NotNil(t, findMetric(family, "genre", "外食"))
+
+		// ジャンル名はプロセス内でキャッシュされる
+		gatherFamilies(t, collector)
+		assert.Equal(t, 1, fetcher.genreCalls)
+	})
+
+	t.Run("収入のカテゴリ別内訳も同じフラグで出力", func(t *testing.T) {
+		incomeFetcher := &categoryFetcher{
+			mockTransactionFetcher: mockTransactionFetcher{
+				transactions: []zaim.Transaction{
+					{ID: 1, Mode: "income", CategoryID: 11, Amount: 250000},
+					{ID: 2, Mode: "income", CategoryID: 12, Amount: 3000},
+					{ID: 3, Mode: "payment", CategoryID: 101, Amount: 800},
+				},
+			},
+			categories: map[int]string{11: "給与所得", 12: "臨時収入"},
+		}
+
+		assert.NotContains(t, gatherFamilies(t, NewZaimCollector(incomeFetcher, NewAggregator(), zap.NewNop())), "zaim_income_amount_by_category")
+
+		family := gatherFamilies(t, NewZaimCollector(incomeFetcher, NewAggregator(), zap.NewNop(), WithGenreMetrics(true)))["zaim_income_amount_by_category"]
+		require.NotNil(t, family)
+		require.Len(t, family.GetMetric(), 2)
+		salary := findMetric(family, "category_id", "11")
+		require.NotNil(t, salary)
+		assert.Equal(t, 250000.0, salary.GetGauge().GetValue())
+		assert.Equal(t, 250000.0, findMetric(family, "category", "給与所得").GetGauge().GetValue())
+		assert.Nil(t, findMetric(family, "category_id", "101"))
+	})
+}
+
+type accountFetcher struct {
+	mockTransactionFetcher
+	accounts map[int]string
+	err      error
+	calls    int
+}
+
+func (f *accountFetcher) GetAccounts(ctx context.Context) (map[int]string, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.accounts, nil
+}
+
+func TestZaimCollector_AccountMetrics(t *testing.T) {
+	fetcher := &accountFetcher{
+		mockTransactionFetcher: mockTransactionFetcher{
+			transactions: []zaim.Transaction{
+				{ID: 1, Mode: "payment", FromAccountID: 1, Amount: 800},
+				{ID: 2, Mode: "payment", FromAccountID: 2, Amount: 1500},
+				{ID: 3, Mode: "payment", FromAccountID: 2, Amount: 500},
+			},
+		},
+		accounts: map[int]string{1: "お財布", 2: "クレジットカード"},
+	}
+
+	t.Run("無効時は出力しない", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop())
+		assert.NotContains(t, gatherFamilies(t, collector), "zaim_payment_amount_by_account")
+	})
+
+	t.Run("有効時は口座ごとに独立して集計", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(), WithAccountMetrics(true))
+
+		family := gatherFamilies(t, collector)["zaim_payment_amount_by_account"]
+		require.NotNil(t, family)
+		require.Len(t, family.GetMetric(), 2)
+
+		wallet := findMetric(family, "account", "お財布")
+		require.NotNil(t, wallet)
+		assert.Equal(t, 800.0, wallet.GetGauge().GetValue())
+
+		card := findMetric(family, "account_id", "2")
+		require.NotNil(t, card)
+		assert.Equal(t, 2000.0, card.GetGauge().GetValue())
+	})
+}
+
+func TestZaimCollector_AccountNamesRetry(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &accountFetcher{err: errors.New("api error"), accounts: map[int]string{1: "お財布"}}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return now })), zap.NewNop(), WithAccountMetrics(true))
+
+	assert.Nil(t, collector.getAccountNames(context.Background()))
+	assert.Nil(t, collector.getAccountNames(context.Background()))
+	assert.Equal(t, 1, fetcher.calls, "失敗直後は再取得しない")
+
+	fetcher.err = nil
+	now = now.Add(nameMissRetry)
+	assert.Equal(t, "お財布", collector.getAccountNames(context.Background())[1])
+	assert.Equal(t, 2, fetcher.calls)
+
+	// 取得できた後はキャッシュを使う
+	now = now.Add(time.Hour)
+	collector.getAccountNames(context.Background())
+	assert.Equal(t, 2, fetcher.calls)
+}
+
+func TestZaimCollector_AccountSplit(t *testing.T) {
+	fetcher := &accountFetcher{
+		mockTransactionFetcher: mockTransactionFetcher{
+			transactions: []zaim.Transaction{
+				{ID: 1, Mode: "income", Date: "2024-01-10", ToAccountID: 1, Amount: 300000},
+				{ID: 2, Mode: "transfer", Date: "2024-01-11", FromAccountID: 1, ToAccountID: 2, Amount: 50000},
+				{ID: 3, Mode: "payment", Date: "2024-01-12", FromAccountID: 2, Amount: 8000},
+				{ID: 4, Mode: "payment", Date: "2024-01-13", FromAccountID: 3, Amount: 12000},
+				{ID: 5, Mode: "transfer", Date: "2024-01-14", FromAccountID: 1, ToAccountID: 3, Amount: 12000},
+				// 口座なしの支出は合計にだけ含まれる
+				{ID: 6, Mode: "payment", Date: "2024-01-15", Amount: 1000},
+				// 先月分は対象外
+				{ID: 7, Mode: "payment", Date: "2023-12-31", FromAccountID: 2, Amount: 9999},
+			},
+		},
+		accounts: map[int]string{1: "銀行", 2: "お財布", 3: "クレジットカード"},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop(), WithAccountSplit(true))
+	families := gatherFamilies(t, collector)
+	value := func(name, account string) float64 {
+		metric := findMetric(families[name], "account", account)
+		require.NotNil(t, metric, "%s %s", name, account)
+		return metric.GetGauge().GetValue()
+	}
+
+	t.Run("口座ごとに分割", func(t *testing.T) {
+		require.Len(t, families["zaim_account_month_net_change"].GetMetric(), 3)
+
+		assert.Equal(t, 300000.0, value("zaim_account_month_income_total", "銀行"))
+		assert.Equal(t, 62000.0, value("zaim_account_month_transfer_out_total", "銀行"))
+		assert.Equal(t, 238000.0, value("zaim_account_month_net_change", "銀行"))
+
+		assert.Equal(t, 50000.0, value("zaim_account_month_transfer_in_total", "お財布"))
+		assert.Equal(t, 8000.0, value("zaim_account_month_payment_total", "お財布"))
+		assert.Equal(t, 42000.0, value("zaim_account_month_net_change", "お財布"))
+
+		assert.Equal(t, 0.0, value("zaim_account_month_net_change", "クレジットカード"))
+	})
+
+	t.Run("純資産の変化は口座間の振替を相殺した合計", func(t *testing.T) {
+		total := findMetric(families["zaim_total_net_worth_change"], "currency", "JPY")
+		require.NotNil(t, total)
+		// 収入 300000 − 支出 (8000 + 12000 + 1000)
+		assert.Equal(t, 279000.0, total.GetGauge().GetValue())
+	})
+}
+
+func TestZaimCollector_ModesFilter(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:05:00", Amount: 1000},
+			{ID: 2, Mode: "income", Date: "2024-01-15", Created: "2024-01-15 11:00:00", Amount: 5000},
+			{ID: 3, Mode: "transfer", Date: "2024-01-15", Created: "2024-01-15 12:00:00", Amount: 300},
+		},
+	}
+	modes, err := ParseModes("payment")
+	require.NoError(t, err)
+	collector := NewZaimCollector(fetcher, NewAggregator(WithModes(modes...), WithClock(fixedClock)), zap.NewNop())
+
+	families := gatherFamilies(t, collector)
+	require.Contains(t, families, "zaim_payment_amount")
+	assert.Len(t, families["zaim_payment_amount"].GetMetric(), 1)
+
+	// 収入系のシリーズは出力されない（残高は両方そろわないと計算できないため出力しない）
+	for _, name := range []string{"zaim_income_amount", "zaim_income_count", "zaim_month_income_total", "zaim_month_balance_amount"} {
+		assert.NotContains(t, families, name)
+	}
+}
+
+func TestZaimCollector_CommentTags(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1200, Comment: "#work 打ち合わせ"},
+			{ID: 2, Mode: "payment", Date: "2024-01-15", Amount: 800, Comment: "タクシー #work #reimbursable"},
+			{ID: 3, Mode: "payment", Date: "2024-01-15", Amount: 500, Comment: "昼食"},
+		},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(), WithCommentTags(regexp.MustCompile(`#(\w+)`), 0))
+
+	family := gatherFamilies(t, collector)["zaim_tagged_payment_amount"]
+	require.NotNil(t, family)
+	// タグのない取引は出力されない
+	require.Len(t, family.GetMetric(), 2)
+
+	work := findMetric(family, "tag", "work")
+	require.NotNil(t, work)
+	assert.Equal(t, 2000.0, work.GetGauge().GetValue())
+
+	reimbursable := findMetric(family, "tag", "reimbursable")
+	require.NotNil(t, reimbursable)
+	assert.Equal(t, 800.0, reimbursable.GetGauge().GetValue())
+}
+
+// blockingFetcher はコンテキストがキャンセルされるまで応答しないモック
+type blockingFetcher struct {
+	started chan struct{}
+}
+
+func (f *blockingFetcher) GetCurrentMonthTransactions(ctx context.Context) ([]zaim.Transaction, error) {
+	select {
+	case f.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestZaimCollector_RunStopsOnCancel(t *testing.T) {
+	fetcher := &blockingFetcher{started: make(chan struct{}, 1)}
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		collector.Run(ctx)
+		close(done)
+	}()
+
+	// 取得中にキャンセルしてもループが終了する
+	select {
+	case <-fetcher.started:
+	case <-time.After(time.Second):
+		t.Fatal("background fetch did not start")
+	}
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("background loop did not exit after cancel")
+	}
+}
+
+func TestZaimCollector_RunRefreshesCache(t *testing.T) {
+	collector := NewZaimCollector(newMockFetcher(), NewAggregator(), zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go collector.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		collector.mu.RLock()
+		defer collector.mu.RUnlock()
+		return collector.cache != nil && len(collector.cache.data) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestZaimCollector_RunServesCacheAfterExpiry(t *testing.T) {
+	fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}}
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	var elapsed atomic.Int64
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return start.Add(time.Duration(elapsed.Load())) })), zap.NewNop(),
+		WithCacheDuration(time.Minute),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go collector.Run(ctx)
+	assert.Eventually(t, func() bool { return collector.Status().CachedTransactions == 1 }, time.Second, 10*time.Millisecond)
+
+	// TTL 直後、次のバックグラウンド更新までスクレイプは取得しない
+	elapsed.Store(int64(time.Minute + time.Second))
+	families := gatherFamilies(t, collector)
+	assert.Equal(t, int32(1), fetcher.calls.Load())
+	assert.Equal(t, 1.0, families["zaim_scrape_cache_hit"].GetMetric()[0].GetGauge().GetValue())
+	assert.Equal(t, 1.0, families["zaim_transaction_count"].GetMetric()[0].GetGauge().GetValue())
+}
+
+// rangeFetcher は期間指定の取得を記録するモック
+type rangeFetcher struct {
+	mockTransactionFetcher
+	start, end time.Time
+}
+
+func (f *rangeFetcher) GetTransactions(ctx context.Context, startDate, endDate time.Time) ([]zaim.Transaction, error) {
+	f.start, f.end = startDate, endDate
+	return f.transactions, nil
+}
+
+func TestZaimCollector_FetchWindow(t *testing.T) {
+	fetcher := &rangeFetcher{}
+	aggregator := NewAggregator(WithLocation(time.FixedZone("JST", 9*60*60)), WithClock(fixedClock))
+	collector := NewZaimCollector(fetcher, aggregator, zap.NewNop(), WithFetchWindow(zaim.FetchWindow{Days: 30}))
+
+	_, err := collector.getTransactions(context.Background())
+	require.NoError(t, err)
+
+	// 設定したタイムゾーンの今日（2024-01-20）から 30 日前
+	assert.Equal(t, "2023-12-21", fetcher.start.Format("2006-01-02"))
+	assert.Equal(t, "2024-01-20", fetcher.end.Format("2006-01-02"))
+}
+
+func TestZaimCollector_TodayMaxPayment(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-20", Amount: 450, Name: "コーヒー"},
+			{ID: 2, Mode: "payment", Date: "2024-01-20", Amount: 12800, Name: "ヘッドホン"},
+			{ID: 3, Mode: "payment", Date: "2024-01-20", Amount: 980, Name: "ランチ"},
+			// 前日の支出は対象外
+			{ID: 4, Mode: "payment", Date: "2024-01-19", Amount: 50000, Name: "家賃"},
+		},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+
+	family := gatherFamilies(t, collector)["zaim_today_max_payment_amount"]
+	require.NotNil(t, family)
+	require.Len(t, family.GetMetric(), 1)
+
+	metric := findMetric(family, "name", "ヘッドホン")
+	require.NotNil(t, metric)
+	assert.Equal(t, 12800.0, metric.GetGauge().GetValue())
+}
+
+func TestZaimCollector_TodayMaxPaymentSkippedWithoutPayments(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "income", Date: "2024-01-20", Amount: 300000, Name: "給与"},
+		},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+
+	assert.NotContains(t, gatherFamilies(t, collector), "zaim_today_max_payment_amount")
+}
+
+func TestZaimCollector_ActiveCategoryCount(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-05", CategoryID: 101, Amount: 800},
+			{ID: 2, Mode: "payment", Date: "2024-01-10", CategoryID: 101, Amount: 1200},
+			{ID: 3, Mode: "payment", Date: "2024-01-12", CategoryID: 102, Amount: 3000},
+			{ID: 4, Mode: "payment", Date: "2024-01-18", CategoryID: 105, Amount: 400},
+		},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+
+	family := gatherFamilies(t, collector)["zaim_active_category_count"]
+	require.NotNil(t, family)
+	require.Len(t, family.GetMetric(), 1)
+	assert.Equal(t, 3.0, family.GetMetric()[0].GetGauge().GetValue())
+}
+
+func TestZaimCollector_ReceiptCounts(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-05", Amount: 800, ReceiptID: 98765},
+			{ID: 2, Mode: "payment", Date: "2024-01-10", Amount: 1200},
+			// 収入はレシートの対象外
+			{ID: 3, Mode: "income", Date: "2024-01-12", Amount: 3000},
+		},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+
+	families := gatherFamilies(t, collector)
+	require.Contains(t, families, "zaim_month_transactions_with_receipt")
+	assert.Equal(t, 1.0, families["zaim_month_transactions_with_receipt"].GetMetric()[0].GetGauge().GetValue())
+	assert.Equal(t, 1.0, families["zaim_month_transactions_without_receipt"].GetMetric()[0].GetGauge().GetValue())
+}
+
+func TestZaimCollector_MaxHours(t *testing.T) {
+	// 2024-01-15 00:00 から 48 時間分、1 時間ごとに支出がある
+	var transactions []zaim.Transaction
+	start := time.Date(2024, 1, 15, 0, 30, 0, 0, time.UTC)
+	for i := 0; i < 48; i++ {
+		created := start.Add(time.Duration(i) * time.Hour)
+		transactions = append(transactions, zaim.Transaction{
+			ID:      int64(i + 1),
+			Mode:    "payment",
+			Date:    created.Format("2006-01-02"),
+			Created: created.Format("2006-01-02 15:04:05"),
+			Amount:  100,
+		})
+	}
+	fetcher := &mockTransactionFetcher{transactions: transactions}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop(), WithMaxHours(24))
+
+	family := gatherFamilies(t, collector)["zaim_payment_amount"]
+	require.NotNil(t, family)
+	require.Len(t, family.GetMetric(), 24)
+
+	// 直近 24 時間（1/16 の各時間）だけが残る
+	assert.NotNil(t, findMetric(family, "hour", "2024-01-16 23:00:00"))
+	assert.NotNil(t, findMetric(family, "hour", "2024-01-16 00:00:00"))
+	assert.Nil(t, findMetric(family, "hour", "2024-01-15 23:00:00"))
+}
+
+func TestZaimCollector_BucketTimestamps(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:05:00", Amount: 1000},
+		},
+	}
+
+	t.Run("既定ではタイムスタンプなし", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(WithLocation(jst), WithClock(fixedClock)), zap.NewNop())
+
+		metric := findMetric(gatherFamilies(t, collector)["zaim_payment_amount"], "hour", "2024-01-15 10:00:00")
+		require.NotNil(t, metric)
+		assert.Nil(t, metric.TimestampMs)
+	})
+
+	t.Run("有効時はバケットの開始時刻", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(WithLocation(jst), WithClock(fixedClock)), zap.NewNop(), WithBucketTimestamps(true))
+		families := gatherFamilies(t, collector)
+
+		hourly := findMetric(families["zaim_payment_amount"], "hour", "2024-01-15 10:00:00")
+		require.NotNil(t, hourly)
+		assert.Equal(t, time.Date(2024, 1, 15, 10, 0, 0, 0, jst).UnixMilli(), hourly.GetTimestampMs())
+
+		daily := findMetric(families["zaim_payment_avg_amount"], "day", "2024-01-15")
+		require.NotNil(t, daily)
+		assert.Equal(t, time.Date(2024, 1, 15, 0, 0, 0, 0, jst).UnixMilli(), daily.GetTimestampMs())
+	})
+}
+
+func TestZaimCollector_ErrorType(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&zaim.StatusError{StatusCode: 401}, "unauthorized"},
+		{&zaim.StatusError{StatusCode: 429}, "rate_limited"},
+		{&zaim.StatusError{StatusCode: 502}, "server_error"},
+		{fmt.Errorf("%w: unexpected EOF", zaim.ErrDecode), "decode_error"},
+		{errors.New("connection refused"), "api_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			collector := NewZaimCollector(&mockTransactionFetcher{err: tt.err}, NewAggregator(), zap.NewNop())
+
+			families := gatherFamilies(t, collector)
+			require.Contains(t, families, "zaim_error")
+			assert.NotNil(t, findMetric(families["zaim_error"], "type", tt.want))
+		})
+	}
+}
+
+func TestZaimCollector_TokenValid(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}
+	called := make(chan struct{}, 2)
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(),
+		WithCacheDuration(time.Nanosecond),
+		WithMinRefreshInterval(0),
+		WithUnauthorizedHandler(func() { called <- struct{}{} }),
+	)
+
+	families := gatherFamilies(t, collector)
+	require.Contains(t, families, "zaim_token_valid")
+	assert.Equal(t, 1.0, families["zaim_token_valid"].GetMetric()[0].GetGauge().GetValue())
+
+	// トークンが失効すると 401 が返り、ゲージが 0 になる
+	fetcher.err = &zaim.StatusError{StatusCode: 401}
+	families = gatherFamilies(t, collector)
+	assert.Equal(t, 0.0, families["zaim_token_valid"].GetMetric()[0].GetGauge().GetValue())
+	assert.NotNil(t, findMetric(families["zaim_error"], "type", "unauthorized"))
+
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("401 でハンドラが呼ばれない")
+	}
+
+	// 401 が続いてもハンドラは一度だけ
+	gatherFamilies(t, collector)
+	select {
+	case <-called:
+		t.Fatal("ハンドラが重複して呼ばれた")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// 401 以外のエラーでは状態を変えない
+	fetcher.err = errors.New("connection refused")
+	families = gatherFamilies(t, collector)
+	assert.Equal(t, 0.0, families["zaim_token_valid"].GetMetric()[0].GetGauge().GetValue())
+
+	// 再認証後に取得できれば 1 に戻る
+	fetcher.err = nil
+	families = gatherFamilies(t, collector)
+	assert.Equal(t, 1.0, families["zaim_token_valid"].GetMetric()[0].GetGauge().GetValue())
+}
+
+// monthFetcher は当月取得と期間指定の取得を順に記録するモック
+type monthFetcher struct {
+	mu    sync.Mutex
+	calls []string // "current" または "YYYY-MM-DD..YYYY-MM-DD"
+}
+
+func (f *monthFetcher) GetCurrentMonthTransactions(ctx context.Context) ([]zaim.Transaction, error) {
+	f.record("current")
+	return []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}}, nil
+}
+
+func (f *monthFetcher) GetTransactions(ctx context.Context, startDate, endDate time.Time) ([]zaim.Transaction, error) {
+	f.record(startDate.Format("2006-01-02") + ".." + endDate.Format("2006-01-02"))
+	return []zaim.Transaction{{ID: startDate.Unix(), Mode: "payment", Date: startDate.Format("2006-01-02"), Amount: 500}}, nil
+}
+
+func (f *monthFetcher) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *monthFetcher) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func TestZaimCollector_Backfill(t *testing.T) {
+	fetcher := &monthFetcher{}
+	aggregator := NewAggregator(WithLocation(time.FixedZone("JST", 9*60*60)), WithClock(fixedClock))
+	collector := NewZaimCollector(fetcher, aggregator, zap.NewNop(), WithBackfill(2, time.Millisecond), WithBackfillConcurrency(1))
+
+	gatherFamilies(t, collector)
+
+	// 当月 + 前 2 か月（並列数 1 なら新しい月から順に）
+	require.Eventually(t, func() bool { return len(fetcher.recorded()) == 3 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{
+		"current",
+		"2023-12-01..2023-12-31",
+		"2023-11-01..2023-11-30",
+	}, fetcher.recorded())
+
+	// 取得済みの過去月も日次メトリクスに含まれる
+	families := gatherFamilies(t, collector)
+	for _, day := range []string{"2024-01-15", "2023-12-01", "2023-11-01"} {
+		assert.NotNil(t, findMetric(families["zaim_payment_avg_amount"], "day", day), day)
+	}
+	// 取引数は取得期間（当月）だけを数える
+	assert.Equal(t, 1.0, families["zaim_transaction_count"].GetMetric()[0].GetGauge().GetValue())
+
+	// バックフィルは一度だけ
+	assert.Len(t, fetcher.recorded(), 3)
+}
+
+// editedMonthFetcher は期間指定の取得のたびに金額が変わる（過去月の編集）モック
+type editedMonthFetcher struct {
+	monthFetcher
+	rangeCalls atomic.Int32
+}
+
+func (f *editedMonthFetcher) GetTransactions(ctx context.Context, startDate, endDate time.Time) ([]zaim.Transaction, error) {
+	f.record(startDate.Format("2006-01-02") + ".." + endDate.Format("2006-01-02"))
+	n := f.rangeCalls.Add(1)
+	return []zaim.Transaction{{ID: startDate.Unix(), Mode: "payment", Date: startDate.Format("2006-01-02"), Amount: 500 * int(n)}}, nil
+}
+
+func TestZaimCollector_BackfillRefresh(t *testing.T) {
+	fetcher := &editedMonthFetcher{}
+	aggregator := NewAggregator(WithLocation(time.FixedZone("JST", 9*60*60)), WithClock(fixedClock))
+	collector := NewZaimCollector(fetcher, aggregator, zap.NewNop(),
+		WithBackfill(1, time.Millisecond),
+		WithBackfillRefreshInterval(10*time.Millisecond),
+	)
+	defer collector.Close()
+
+	gatherFamilies(t, collector)
+
+	// 再取得した過去月が前回の分を置き換える（重複して合算しない）
+	require.Eventually(t, func() bool { return fetcher.rangeCalls.Load() >= 2 }, time.Second, time.Millisecond)
+	collector.Close()
+	families := gatherFamilies(t, collector)
+	avg := findMetric(families["zaim_payment_avg_amount"], "day", "2023-12-01")
+	require.NotNil(t, avg)
+	assert.Equal(t, float64(500*fetcher.rangeCalls.Load()), avg.GetGauge().GetValue())
+}
+
+// concurrentMonthFetcher は同時に実行中の期間指定取得の最大数を記録するモック
+type concurrentMonthFetcher struct {
+	monthFetcher
+	failMonth   string // この月（YYYY-MM）の取得は失敗させる
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+}
+
+func (f *concurrentMonthFetcher) GetTransactions(ctx context.Context, startDate, endDate time.Time) ([]zaim.Transaction, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	for {
+		current := f.maxInFlight.Load()
+		if n <= current || f.maxInFlight.CompareAndSwap(current, n) {
+			break
+		}
+	}
+	// 他のワーカーと重なるよう少し待つ
+	time.Sleep(20 * time.Millisecond)
+
+	if startDate.Format("2006-01") == f.failMonth {
+		f.record("failed " + f.failMonth)
+		return nil, errors.New("API error")
+	}
+	return f.monthFetcher.GetTransactions(ctx, startDate, endDate)
+}
+
+func TestZaimCollector_BackfillConcurrency(t *testing.T) {
+	newCollector := func(fetcher *concurrentMonthFetcher) *ZaimCollector {
+		aggregator := NewAggregator(WithLocation(time.FixedZone("JST", 9*60*60)), WithClock(fixedClock))
+		return NewZaimCollector(fetcher, aggregator, zap.NewNop(),
+			WithBackfill(3, time.Millisecond),
+			WithBackfillConcurrency(2),
+		)
+	}
+
+	t.Run("並列数を超えずに全月を取得", func(t *testing.T) {
+		fetcher := &concurrentMonthFetcher{}
+		collector := newCollector(fetcher)
+
+		gatherFamilies(t, collector)
+		require.Eventually(t, func() bool { return len(fetcher.recorded()) == 4 }, time.Second, time.Millisecond)
+		assert.ElementsMatch(t, []string{
+			"current",
+			"2023-12-01..2023-12-31",
+			"2023-11-01..2023-11-30",
+			"2023-10-01..2023-10-31",
+		}, fetcher.recorded())
+		assert.Equal(t, int32(2), fetcher.maxInFlight.Load())
+
+		collector.Close()
+		families := gatherFamilies(t, collector)
+		for _, day := range []string{"2023-12-01", "2023-11-01", "2023-10-01"} {
+			assert.NotNil(t, findMetric(families["zaim_payment_avg_amount"], "day", day), day)
+		}
+	})
+
+	t.Run("失敗した月だけ欠ける", func(t *testing.T) {
+		fetcher := &concurrentMonthFetcher{failMonth: "2023-11"}
+		collector := newCollector(fetcher)
+
+		gatherFamilies(t, collector)
+		require.Eventually(t, func() bool { return len(fetcher.recorded()) == 4 }, time.Second, time.Millisecond)
+		assert.Contains(t, fetcher.recorded(), "failed 2023-11")
+
+		collector.Close()
+		families := gatherFamilies(t, collector)
+		assert.NotNil(t, findMetric(families["zaim_payment_avg_amount"], "day", "2023-12-01"))
+		assert.NotNil(t, findMetric(families["zaim_payment_avg_amount"], "day", "2023-10-01"))
+		assert.Nil(t, findMetric(families["zaim_payment_avg_amount"], "day", "2023-11-01"))
+	})
+}
+
+func TestZaimCollector_TransactionChanges(t *testing.T) {
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000, Updated: "2024-01-15 10:00:00"},
+		{ID: 2, Mode: "payment", Date: "2024-01-15", Amount: 500, Updated: "2024-01-15 11:00:00"},
+	}}
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(),
+		WithCacheDuration(time.Nanosecond),
+		WithMinRefreshInterval(0),
+	)
+	counters := func() (changed, added float64) {
+		families := gatherFamilies(t, collector)
+		return families["zaim_transactions_changed_total"].GetMetric()[0].GetCounter().GetValue(),
+			families["zaim_transactions_new_total"].GetMetric()[0].GetCounter().GetValue()
+	}
+
+	// 初回の取得は比較対象がないので数えない
+	changed, added := counters()
+	assert.Equal(t, 0.0, changed)
+	assert.Equal(t, 0.0, added)
+
+	// ID 1 を編集、ID 3 を追加、ID 2 は変更なし
+	fetcher.transactions = []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1200, Updated: "2024-01-16 09:00:00"},
+		{ID: 2, Mode: "payment", Date: "2024-01-15", Amount: 500, Updated: "2024-01-15 11:00:00"},
+		{ID: 3, Mode: "payment", Date: "2024-01-16", Amount: 300, Updated: "2024-01-16 09:30:00"},
+	}
+	changed, added = counters()
+	assert.Equal(t, 1.0, changed)
+	assert.Equal(t, 1.0, added)
+
+	// 同じ内容の再取得では増えない
+	changed, added = counters()
+	assert.Equal(t, 1.0, changed)
+	assert.Equal(t, 1.0, added)
+}
+
+// rateLimitedFetcher はクライアント側レート制限の待ち時間を報告するモック
+type rateLimitedFetcher struct {
+	mockTransactionFetcher
+	count uint64
+	total time.Duration
+}
+
+func (f *rateLimitedFetcher) RateLimitWaits() (uint64, time.Duration, bool) {
+	return f.count, f.total, true
+}
+
+func TestZaimCollector_RateLimitWait(t *testing.T) {
+	fetcher := &rateLimitedFetcher{count: 3, total: 1500 * time.Millisecond}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+
+	families := gatherFamilies(t, collector)
+	require.Contains(t, families, "zaim_rate_limit_wait_seconds")
+	summary := families["zaim_rate_limit_wait_seconds"].GetMetric()[0].GetSummary()
+	assert.Equal(t, uint64(3), summary.GetSampleCount())
+	assert.Equal(t, 1.5, summary.GetSampleSum())
+
+	// 制限を持たないクライアントでは出力しない
+	plain := NewZaimCollector(&mockTransactionFetcher{}, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+	assert.NotContains(t, gatherFamilies(t, plain), "zaim_rate_limit_wait_seconds")
+}
+
+// countingFetcher は API 呼び出し回数を数えるモック
+// 1 回の取得を 1 リクエストとして zaim.APICallReporter でも報告する
+type countingFetcher struct {
+	mockTransactionFetcher
+	calls atomic.Int32
+}
+
+func (f *countingFetcher) GetCurrentMonthTransactions(ctx context.Context) ([]zaim.Transaction, error) {
+	f.calls.Add(1)
+	return f.mockTransactionFetcher.GetCurrentMonthTransactions(ctx)
+}
+
+func (f *countingFetcher) APICalls() uint64 {
+	return uint64(f.calls.Load())
+}
+
+func TestZaimCollector_MinRefreshInterval(t *testing.T) {
+	t.Run("キャッシュが短くても下限内は 1 回だけ取得", func(t *testing.T) {
+		fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+			transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+		}}
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(),
+			WithCacheDuration(time.Nanosecond),
+			WithMinRefreshInterval(time.Minute),
+		)
+
+		var families map[string]*dto.MetricFamily
+		for i := 0; i < 20; i++ {
+			families = gatherFamilies(t, collector)
+		}
+		assert.Equal(t, int32(1), fetcher.calls.Load())
+
+		// 古いキャッシュでメトリクスは出力され続ける
+		assert.Contains(t, families, "zaim_payment_avg_amount")
+		require.Contains(t, families, "zaim_api_calls_total")
+		assert.Equal(t, 1.0, families["zaim_api_calls_total"].GetMetric()[0].GetCounter().GetValue())
+	})
+
+	t.Run("失敗時も下限内は再取得しない", func(t *testing.T) {
+		fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{err: errors.New("API error")}}
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(), WithMinRefreshInterval(time.Minute))
+
+		for i := 0; i < 5; i++ {
+			families := gatherFamilies(t, collector)
+			assert.NotNil(t, findMetric(families["zaim_error"], "type", "api_error"))
+		}
+		assert.Equal(t, int32(1), fetcher.calls.Load())
+	})
+}
+
+func TestZaimCollector_APICalls(t *testing.T) {
+	t.Run("クライアントが数えたリクエスト数をそのまま出力", func(t *testing.T) {
+		fetcher := &countingFetcher{}
+		fetcher.calls.Store(3) // ページ送りなどで 1 回の取得が複数リクエストになった場合
+		families := gatherFamilies(t, NewZaimCollector(fetcher, NewAggregator(), zap.NewNop()))
+
+		require.Contains(t, families, "zaim_api_calls_total")
+		assert.Equal(t, 4.0, families["zaim_api_calls_total"].GetMetric()[0].GetCounter().GetValue())
+	})
+
+	t.Run("数えないクライアントでは出力しない", func(t *testing.T) {
+		families := gatherFamilies(t, NewZaimCollector(&mockTransactionFetcher{}, NewAggregator(), zap.NewNop()))
+		assert.NotContains(t, families, "zaim_api_calls_total")
+	})
+}
+
+// gatedFetcher は release が閉じられるまで取得を止めるモック
+// entered は止まる前に数えた取得の開始回数
+type gatedFetcher struct {
+	countingFetcher
+	entered atomic.Int32
+	release chan struct{}
+}
+
+func (f *gatedFetcher) GetCurrentMonthTransactions(ctx context.Context) ([]zaim.Transaction, error) {
+	f.entered.Add(1)
+	<-f.release
+	return f.countingFetcher.GetCurrentMonthTransactions(ctx)
+}
+
+func newGatedFetcher() *gatedFetcher {
+	return &gatedFetcher{
+		countingFetcher: countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+			transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+		}},
+		release: make(chan struct{}),
+	}
+}
+
+// scrapeConcurrently は n 回のスクレイプを並行に始め、取得した zaim_transaction_count の数を返す関数を返す
+func scrapeConcurrently(t *testing.T, collector *ZaimCollector, n int) func() int {
+	t.Helper()
+	var (
+		wg     sync.WaitGroup
+		served atomic.Int32
+	)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(collector)
+			families, err := registry.Gather()
+			if err != nil {
+				return
+			}
+			for _, family := range families {
+				if family.GetName() == "zaim_transaction_count" {
+					served.Add(1)
+				}
+			}
+		}()
+	}
+	return func() int {
+		wg.Wait()
+		return int(served.Load())
+	}
+}
+
+func TestZaimCollector_ConcurrentCacheMiss(t *testing.T) {
+	const scrapes = 10
+	fetcher := newGatedFetcher()
+	// 取得を共有しなければ、キャッシュのない間に来たスクレイプがそれぞれ取得を始める
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(),
+		WithMinRefreshInterval(0),
+	)
+
+	wait := scrapeConcurrently(t, collector, scrapes)
+	require.Eventually(t, func() bool { return fetcher.entered.Load() > 0 }, time.Second, time.Millisecond)
+	// 残りのスクレイプが実行中の取得に合流する時間を与える
+	time.Sleep(20 * time.Millisecond)
+	close(fetcher.release)
+
+	assert.Equal(t, scrapes, wait())
+	assert.Equal(t, int32(1), fetcher.entered.Load())
+	assert.Equal(t, int32(1), fetcher.calls.Load())
+}
+
+func TestZaimCollector_RefreshSharesScrapeFetch(t *testing.T) {
+	fetcher := newGatedFetcher()
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(),
+		WithMinRefreshInterval(0),
+	)
+
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- collector.refresh(context.Background()) }()
+	require.Eventually(t, func() bool { return fetcher.entered.Load() > 0 }, time.Second, time.Millisecond)
+
+	// 更新中のキャッシュミスは更新の取得を待って同じ結果を使う
+	wait := scrapeConcurrently(t, collector, 3)
+	time.Sleep(20 * time.Millisecond)
+	close(fetcher.release)
+
+	require.NoError(t, <-refreshed)
+	assert.Equal(t, 3, wait())
+	assert.Equal(t, int32(1), fetcher.entered.Load())
+}
+
+func TestZaimCollector_EmptyMonth(t *testing.T) {
+	t.Run("取引 0 件の成功は失敗と区別できる", func(t *testing.T) {
+		collector := NewZaimCollector(&mockTransactionFetcher{}, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+		families := gatherFamilies(t, collector)
+
+		require.Contains(t, families, "zaim_fetch_success")
+		assert.Equal(t, 1.0, families["zaim_fetch_success"].GetMetric()[0].GetGauge().GetValue())
+		require.Contains(t, families, "zaim_transaction_count")
+		assert.Equal(t, 0.0, families["zaim_transaction_count"].GetMetric()[0].GetGauge().GetValue())
+		assert.NotContains(t, families, "zaim_error")
+	})
+
+	t.Run("取得失敗は 0", func(t *testing.T) {
+		collector := NewZaimCollector(&mockTransactionFetcher{err: errors.New("API error")}, NewAggregator(), zap.NewNop())
+		families := gatherFamilies(t, collector)
+
+		require.Contains(t, families, "zaim_fetch_success")
+		assert.Equal(t, 0.0, families["zaim_fetch_success"].GetMetric()[0].GetGauge().GetValue())
+		assert.NotContains(t, families, "zaim_transaction_count")
+		assert.Contains(t, families, "zaim_error")
+	})
+}
+
+func TestZaimCollector_LatestTransaction(t *testing.T) {
+	t.Run("作成日時が最新の取引を出力する", func(t *testing.T) {
+		// 並び順や日付ではなく created で判定する
+		fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Name: "ランチ", Date: "2024-01-20", Created: "2024-01-20 12:00:00", Amount: 1000},
+			{ID: 2, Mode: "income", Name: "給与", Date: "2024-01-15", Created: "2024-01-20 18:30:00", Amount: 300000},
+			{ID: 3, Mode: "payment", Name: "コーヒー", Date: "2024-01-20", Created: "2024-01-20 09:00:00", Amount: 500},
+		}}
+		collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock), WithLocation(time.UTC)), zap.NewNop())
+		families := gatherFamilies(t, collector)
+
+		require.Contains(t, families, "zaim_latest_transaction_timestamp")
+		want := time.Date(2024, 1, 20, 18, 30, 0, 0, time.UTC)
+		assert.Equal(t, float64(want.Unix()), families["zaim_latest_transaction_timestamp"].GetMetric()[0].GetGauge().GetValue())
+
+		info := findMetric(families["zaim_latest_transaction_info"], "name", "給与")
+		require.NotNil(t, info)
+		assert.Len(t, families["zaim_latest_transaction_info"].GetMetric(), 1)
+		assert.Equal(t, 1.0, info.GetGauge().GetValue())
+		assert.NotNil(t, findMetric(families["zaim_latest_transaction_info"], "mode", "income"))
+	})
+
+	t.Run("取引がなければ出力しない", func(t *testing.T) {
+		collector := NewZaimCollector(&mockTransactionFetcher{}, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+		families := gatherFamilies(t, collector)
+
+		assert.NotContains(t, families, "zaim_latest_transaction_timestamp")
+		assert.NotContains(t, families, "zaim_latest_transaction_info")
+	})
+}
+
+func TestZaimCollector_CollectDuration(t *testing.T) {
+	fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}}
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop())
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(collector))
+	gather := func() map[string]*dto.MetricFamily {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		byName := make(map[string]*dto.MetricFamily, len(families))
+		for _, family := range families {
+			byName[family.GetName()] = family
+		}
+		return byName
+	}
+
+	families := gather()
+	require.Contains(t, families, "zaim_collect_duration_seconds")
+	samples := families["zaim_collect_duration_seconds"].GetMetric()[0].GetHistogram().GetSampleCount()
+	assert.GreaterOrEqual(t, samples, uint64(1))
+	require.Contains(t, families, "zaim_scrape_cache_hit")
+
+	// 2 回目はキャッシュから返り、サンプルが 1 つ増える
+	families = gather()
+	assert.Equal(t, samples+1, families["zaim_collect_duration_seconds"].GetMetric()[0].GetHistogram().GetSampleCount())
+	assert.Equal(t, 1.0, families["zaim_scrape_cache_hit"].GetMetric()[0].GetGauge().GetValue())
+	assert.Equal(t, int32(1), fetcher.calls.Load())
+
+	t.Run("取得したスクレイプはミス", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(), WithCacheDuration(time.Nanosecond), WithMinRefreshInterval(0))
+		families := gatherFamilies(t, collector)
+		assert.Equal(t, 0.0, families["zaim_scrape_cache_hit"].GetMetric()[0].GetGauge().GetValue())
+	})
+}
+
+func TestZaimCollector_StartupJitter(t *testing.T) {
+	const jitter = 30 * time.Second
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	t.Run("初回取得がジッタ上限内だけ遅れる", func(t *testing.T) {
+		fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+			transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+		}}
+		collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return start })), zap.NewNop(),
+			WithStartupJitter(jitter),
+		)
+		delay := collector.warmAt.Sub(start)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.Less(t, delay, jitter)
+
+		// 待ち時間を短くして、経過するまで取得しないことを確かめる
+		collector.warmAt = start.Add(100 * time.Millisecond)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go collector.Run(ctx)
+
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(t, int32(0), fetcher.calls.Load())
+		assert.Eventually(t, func() bool { return fetcher.calls.Load() == 1 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("ウォームアップ中のスクレイプは Zaim を呼ばない", func(t *testing.T) {
+		fetcher := &countingFetcher{}
+		now := start
+		collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return now })), zap.NewNop(),
+			WithStartupJitter(jitter),
+		)
+		// 乱数に依らずウォームアップ中にする
+		collector.warmAt = start.Add(time.Second)
+
+		families := gatherFamilies(t, collector)
+		assert.Equal(t, int32(0), fetcher.calls.Load())
+		assert.Contains(t, families, "zaim_token_valid")
+		assert.NotContains(t, families, "zaim_error")
+		assert.True(t, collector.Status().Warming)
+
+		now = collector.warmAt
+		gatherFamilies(t, collector)
+		assert.Equal(t, int32(1), fetcher.calls.Load())
+		assert.False(t, collector.Status().Warming)
+	})
+}
+
+func TestZaimCollector_ExcludeNames(t *testing.T) {
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-20", Name: "残高調整", Amount: 50000},
+			{ID: 2, Mode: "payment", Date: "2024-01-20", Name: "ランチ", Amount: 1000},
+		},
+	}
+	pattern, err := CompileNamePatterns([]string{"調整"})
+	require.NoError(t, err)
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop(), WithExcludeNames(pattern))
+
+	families := gatherFamilies(t, collector)
+
+	// 一致した取引は合計から除外され、件数として出力される
+	today := findMetric(families["zaim_today_total_amount"], "currency", "JPY")
+	require.NotNil(t, today)
+	assert.Equal(t, 1000.0, today.GetGauge().GetValue())
+
+	require.Contains(t, families, "zaim_excluded_transaction_count")
+	assert.Equal(t, 1.0, families["zaim_excluded_transaction_count"].GetMetric()[0].GetGauge().GetValue())
+
+	// 既定（フィルタなし）では件数メトリクスは出力しない
+	assert.NotContains(t, gatherFamilies(t, NewZaimCollector(fetcher, NewAggregator(), zap.NewNop())), "zaim_excluded_transaction_count")
+}
+
+func TestZaimCollector_FractionalAmounts(t *testing.T) {
+	var money zaim.MoneyData
+	require.NoError(t, json.Unmarshal([]byte(`{"money":[
+		{"id":1,"mode":"payment","date":"2024-01-20","amount":10.50,"currency_code":"USD"},
+		{"id":2,"mode":"payment","date":"2024-01-20","amount":2.25,"currency_code":"USD"}
+	]}`), &money))
+	collector := NewZaimCollector(&mockTransactionFetcher{transactions: money.Money}, NewAggregator(WithClock(fixedClock)), zap.NewNop())
+
+	families := gatherFamilies(t, collector)
+
+	// 端数は切り捨てられず合計される
+	today := findMetric(families["zaim_today_total_amount"], "currency", "USD")
+	require.NotNil(t, today)
+	assert.Equal(t, 12.75, today.GetGauge().GetValue())
+
+	month := findMetric(families["zaim_month_payment_total"], "currency", "USD")
+	require.NotNil(t, month)
+	assert.Equal(t, 12.75, month.GetGauge().GetValue())
+}
+
+func TestZaimCollector_LastUpdateTracksFetches(t *testing.T) {
+	fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}}
+	lastUpdate := func(collector *ZaimCollector) float64 {
+		t.Helper()
+		family := gatherFamilies(t, collector)["zaim_last_update"]
+		require.NotNil(t, family)
+		return family.GetMetric()[0].GetGauge().GetValue()
+	}
+
+	t.Run("キャッシュ利用中は更新時刻が変わらない", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop())
+
+		first := lastUpdate(collector)
+		time.Sleep(5 * time.Millisecond)
+		assert.Equal(t, first, lastUpdate(collector))
+		assert.InDelta(t, float64(time.Now().Unix()), first, 5)
+	})
+
+	t.Run("実際に取得すると更新時刻が進む", func(t *testing.T) {
+		collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(),
+			WithCacheDuration(time.Nanosecond),
+			WithMinRefreshInterval(0),
+		)
+
+		first := lastUpdate(collector)
+		time.Sleep(5 * time.Millisecond)
+		assert.Greater(t, lastUpdate(collector), first)
+	})
+}
+
+func TestZaimCollector_AmountScale(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:00:00", Amount: 1050, Currency: "USD"},
+		{ID: 2, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 11:00:00", Amount: 1000},
+	}}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return now })), zap.NewNop(),
+		WithAmountScale(map[string]float64{"USD": 0.01}),
+	)
+
+	families := gatherFamilies(t, collector)
+
+	usd := findMetric(families["zaim_payment_amount"], "currency", "USD")
+	require.NotNil(t, usd)
+	assert.Equal(t, 10.5, usd.GetGauge().GetValue())
+
+	// 設定のない通貨はそのまま
+	jpy := findMetric(families["zaim_payment_amount"], "currency", "JPY")
+	require.NotNil(t, jpy)
+	assert.Equal(t, 1000.0, jpy.GetGauge().GetValue())
+
+	// 件数はスケールしない
+	count := findMetric(families["zaim_payment_count"], "currency", "USD")
+	require.NotNil(t, count)
+	assert.Equal(t, 1.0, count.GetGauge().GetValue())
+
+	month := findMetric(families["zaim_month_payment_total"], "currency", "USD")
+	require.NotNil(t, month)
+	assert.Equal(t, 10.5, month.GetGauge().GetValue())
+}
+
+func TestZaimCollector_AmountRounding(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:00:00", Amount: 1234},
+		{ID: 2, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 11:00:00", Amount: 123456, Currency: "USD"},
+	}}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return now })), zap.NewNop(),
+		WithAmountScale(map[string]float64{"USD": 0.01}),
+		WithAmountRounding(100),
+	)
+
+	families := gatherFamilies(t, collector)
+
+	jpy := findMetric(families["zaim_payment_amount"], "currency", "JPY")
+	require.NotNil(t, jpy)
+	assert.Equal(t, 1200.0, jpy.GetGauge().GetValue())
+
+	// スケール後の値を丸める
+	usd := findMetric(families["zaim_payment_amount"], "currency", "USD")
+	require.NotNil(t, usd)
+	assert.Equal(t, 1200.0, usd.GetGauge().GetValue())
+
+	// 件数は丸めない
+	count := findMetric(families["zaim_payment_count"], "currency", "JPY")
+	require.NotNil(t, count)
+	assert.Equal(t, 1.0, count.GetGauge().GetValue())
+}
+
+func TestParseAmountScale(t *testing.T) {
+	scale, err := ParseAmountScale(" usd=0.01, EUR=0.01 ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"USD": 0.01, "EUR": 0.01}, scale)
+
+	scale, err = ParseAmountScale("")
+	require.NoError(t, err)
+	assert.Nil(t, scale)
+
+	for _, value := range []string{"USD", "USD=abc", "USD=0", "USD=-1"} {
+		_, err := ParseAmountScale(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestZaimCollector_ZeroFillHours(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 30, 0, 0, time.UTC)
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:00:00", Amount: 1000},
+	}}
+	aggregator := NewAggregator(WithLocation(time.UTC), WithClock(func() time.Time { return now }))
+
+	families := gatherFamilies(t, NewZaimCollector(fetcher, aggregator, zap.NewNop()))
+	assert.Nil(t, findMetric(families["zaim_payment_amount"], "hour", "2024-01-15 11:00:00"))
+
+	families = gatherFamilies(t, NewZaimCollector(fetcher, aggregator, zap.NewNop(), WithZeroFillHours(true)))
+	empty := findMetric(families["zaim_payment_amount"], "hour", "2024-01-15 11:00:00")
+	require.NotNil(t, empty)
+	assert.Equal(t, 0.0, empty.GetGauge().GetValue())
+	assert.Equal(t, 1000.0, findMetric(families["zaim_payment_amount"], "hour", "2024-01-15 10:00:00").GetGauge().GetValue())
+}
+
+func TestZaimCollector_DataStale(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}}}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return now })), zap.NewNop(),
+		WithCacheDuration(5*time.Minute),
+	)
+
+	stale := func() float64 {
+		families := gatherFamilies(t, collector)
+		require.Contains(t, families, "zaim_data_stale")
+		return families["zaim_data_stale"].GetMetric()[0].GetGauge().GetValue()
+	}
+	assert.Equal(t, 0.0, stale())
+
+	// キャッシュ期間の 2 倍以内はまだ新しい（以降の取得は失敗させる）
+	fetcher.err = errors.New("API error")
+	now = now.Add(10 * time.Minute)
+	assert.Equal(t, 0.0, stale())
+
+	now = now.Add(time.Second)
+	assert.Equal(t, 1.0, stale())
+}
+
+func TestZaimCollector_TransferNetsToZero(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	aggregator := NewAggregator(WithClock(func() time.Time { return now }))
+	base := []zaim.Transaction{
+		{ID: 1, Mode: "income", Date: "2024-01-05", Amount: 250000},
+		{ID: 2, Mode: "payment", Date: "2024-01-10", Amount: 80000},
+	}
+	value := func(families map[string]*dto.MetricFamily, name string) float64 {
+		m := findMetric(families[name], "currency", "JPY")
+		require.NotNil(t, m, name)
+		return m.GetGauge().GetValue()
+	}
+
+	before := gatherFamilies(t, NewZaimCollector(&mockTransactionFetcher{transactions: base}, aggregator, zap.NewNop()))
+
+	// 口座間の振替を追加
+	withTransfer := append(base, zaim.Transaction{ID: 3, Mode: "transfer", Date: "2024-01-12", Amount: 50000, FromAccountID: 1, ToAccountID: 2})
+	after := gatherFamilies(t, NewZaimCollector(&mockTransactionFetcher{transactions: withTransfer}, aggregator, zap.NewNop()))
+
+	assert.Equal(t, value(before, "zaim_month_balance_amount"), value(after, "zaim_month_balance_amount"))
+	assert.Equal(t, 170000.0, value(after, "zaim_month_balance_amount"))
+	assert.Equal(t, 0.0, value(before, "zaim_month_transfer_total"))
+	assert.Equal(t, 50000.0, value(after, "zaim_month_transfer_total"))
+}
+
+func TestZaimCollector_MonthRollover(t *testing.T) {
+	now := time.Date(2024, 1, 31, 23, 30, 0, 0, time.UTC)
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-31", Created: "2024-01-31 22:00:00", Amount: 1000},
+	}}
+	aggregator := NewAggregator(WithLocation(time.UTC), WithClock(func() time.Time { return now }))
+	collector := NewZaimCollector(fetcher, aggregator, zap.NewNop(), WithCacheDuration(time.Hour))
+
+	families := gatherFamilies(t, collector)
+	require.NotNil(t, findMetric(families["zaim_payment_amount"], "hour", "2024-01-31 22:00:00"))
+
+	// 月が替わってもキャッシュには 1 月の行が残っているが、系列は出さない
+	now = time.Date(2024, 2, 1, 0, 30, 0, 0, time.UTC)
+	families = gatherFamilies(t, collector)
+	assert.Nil(t, findMetric(families["zaim_payment_amount"], "hour", "2024-01-31 22:00:00"))
+	assert.Nil(t, findMetric(families["zaim_payment_count"], "hour", "2024-01-31 22:00:00"))
+}
+
+func TestZaimCollector_HourlyWindowDisabled(t *testing.T) {
+	// フィクスチャのように現在時刻と離れた日付のデータ
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:00:00", Amount: 1000},
+	}}
+	aggregator := NewAggregator(WithLocation(time.UTC))
+
+	families := gatherFamilies(t, NewZaimCollector(fetcher, aggregator, zap.NewNop()))
+	assert.Nil(t, findMetric(families["zaim_payment_amount"], "hour", "2024-01-15 10:00:00"))
+
+	families = gatherFamilies(t, NewZaimCollector(fetcher, aggregator, zap.NewNop(), WithHourlyWindow(false)))
+	assert.NotNil(t, findMetric(families["zaim_payment_amount"], "hour", "2024-01-15 10:00:00"))
+}
+
+func TestZaimCollector_BudgetRemaining(t *testing.T) {
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", CategoryID: 101, Amount: 20000},
+	}}
+
+	families := gatherFamilies(t, NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop()))
+	assert.NotContains(t, families, "zaim_budget_remaining_amount")
+
+	aggregator := NewAggregator(WithClock(fixedClock), WithMonthlyBudget(50000, map[int]int{101: 25000}))
+	families = gatherFamilies(t, NewZaimCollector(fetcher, aggregator, zap.NewNop()))
+	require.Contains(t, families, "zaim_budget_remaining_amount")
+	assert.Equal(t, 30000.0, findMetric(families["zaim_budget_remaining_amount"], "category_id", "all").GetGauge().GetValue())
+	assert.Equal(t, 5000.0, findMetric(families["zaim_budget_remaining_amount"], "category_id", "101").GetGauge().GetValue())
+}
+
+func TestZaimCollector_DailyMetrics(t *testing.T) {
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-14", Created: "2024-01-14 09:00:00", Amount: 1000},
+		{ID: 2, Mode: "payment", Date: "2024-01-14", Created: "2024-01-14 18:00:00", Amount: 500},
+		{ID: 3, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 12:00:00", Amount: 800},
+		{ID: 4, Mode: "income", Date: "2024-01-15", Created: "2024-01-15 10:00:00", Amount: 250000},
+	}}
+
+	// 既定では日次の系列は出さない
+	families := gatherFamilies(t, NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop()))
+	assert.NotContains(t, families, "zaim_daily_payment_amount")
+
+	families = gatherFamilies(t, NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop(), WithDailyMetrics(true)))
+	value := func(name, date string) float64 {
+		m := findMetric(families[name], "date", date)
+		require.NotNil(t, m, name+" "+date)
+		return m.GetGauge().GetValue()
+	}
+	assert.Equal(t, 1500.0, value("zaim_daily_payment_amount", "2024-01-14"))
+	assert.Equal(t, 2.0, value("zaim_daily_payment_count", "2024-01-14"))
+	assert.Equal(t, 800.0, value("zaim_daily_payment_amount", "2024-01-15"))
+	assert.Equal(t, 1.0, value("zaim_daily_payment_count", "2024-01-15"))
+	assert.Equal(t, 0.0, value("zaim_daily_income_amount", "2024-01-14"))
+	assert.Equal(t, 250000.0, value("zaim_daily_income_amount", "2024-01-15"))
+	assert.Equal(t, 1.0, value("zaim_daily_income_count", "2024-01-15"))
+}
+
+func TestZaimCollector_Close(t *testing.T) {
+	fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop(),
+		WithCacheDuration(5*time.Millisecond),
+		WithMinRefreshInterval(0),
+	)
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		collector.Run(context.Background())
+	}()
+	assert.Eventually(t, func() bool { return fetcher.calls.Load() >= 2 }, time.Second, time.Millisecond)
+
+	collector.Close()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Close 後もバックグラウンドループが止まらない")
+	}
+
+	// 閉じた後のスクレイプは取得せず、最後のキャッシュを返す
+	calls := fetcher.calls.Load()
+	time.Sleep(20 * time.Millisecond)
+	families := gatherFamilies(t, collector)
+	assert.Equal(t, calls, fetcher.calls.Load())
+	assert.NotContains(t, families, "zaim_error")
+	assert.Equal(t, 1000.0, findMetric(families["zaim_month_payment_total"], "currency", "JPY").GetGauge().GetValue())
+
+	// 二重に閉じても問題ない
+	collector.Close()
+
+	// 閉じた後の Run はすぐ戻る
+	collector.Run(context.Background())
+}
+
+func TestZaimCollector_CloseWithoutCache(t *testing.T) {
+	collector := NewZaimCollector(&mockTransactionFetcher{}, NewAggregator(), zap.NewNop())
+	collector.Close()
+
+	families := gatherFamilies(t, collector)
+	assert.NotNil(t, findMetric(families["zaim_error"], "type", "api_error"))
+}
+
+func TestZaimCollector_LastGoodData(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return now })), zap.NewNop(),
+		WithCacheDuration(time.Minute),
+		WithMinRefreshInterval(0),
+		WithFailureBackoff(0),
+		WithDataHardExpiry(time.Hour),
+	)
+
+	families := gatherFamilies(t, collector)
+	require.Contains(t, families, "zaim_month_payment_total")
+	assert.Equal(t, 0.0, families["zaim_data_age_seconds"].GetMetric()[0].GetGauge().GetValue())
+
+	t.Run("取得に失敗しても直前のデータを出す", func(t *testing.T) {
+		fetcher.err = errors.New("API error")
+		now = now.Add(10 * time.Minute)
+
+		families := gatherFamilies(t, collector)
+		assert.Equal(t, 1.0, findMetric(families["zaim_error"], "type", "api_error").GetGauge().GetValue())
+		assert.Equal(t, 1000.0, findMetric(families["zaim_month_payment_total"], "currency", "JPY").GetGauge().GetValue())
+		assert.Equal(t, 600.0, families["zaim_data_age_seconds"].GetMetric()[0].GetGauge().GetValue())
+	})
+
+	t.Run("失効期限を過ぎたデータは出さない", func(t *testing.T) {
+		now = now.Add(time.Hour)
+
+		families := gatherFamilies(t, collector)
+		assert.Contains(t, families, "zaim_error")
+		assert.NotContains(t, families, "zaim_month_payment_total")
+		assert.Equal(t, 1.0, families["zaim_data_stale"].GetMetric()[0].GetGauge().GetValue())
+	})
+}
+
+func TestZaimCollector_FailureBackoff(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}}
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(func() time.Time { return now })), zap.NewNop(),
+		WithCacheDuration(time.Nanosecond),
+		WithMinRefreshInterval(0),
+		WithFailureBackoff(4*time.Minute),
+	)
+	// 前回の取得から elapsed 後のスクレイプで取得したかを返す
+	fetchedAfter := func(elapsed time.Duration) bool {
+		now = now.Add(elapsed)
+		before := fetcher.calls.Load()
+		gatherFamilies(t, collector)
+		return fetcher.calls.Load() > before
+	}
+
+	require.True(t, fetchedAfter(0))
+	fetcher.err = errors.New("API error")
+	collector.SetCacheDuration(time.Minute)
+
+	// 失敗が続くたびに再取得までの間隔が倍になる（上限 4 分）
+	require.True(t, fetchedAfter(time.Minute))
+	for _, interval := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+		assert.False(t, fetchedAfter(interval-time.Second), interval)
+		assert.True(t, fetchedAfter(time.Second), interval)
+	}
+
+	// バックオフ中は直前のデータを出し続ける
+	families := gatherFamilies(t, collector)
+	assert.NotContains(t, families, "zaim_error")
+	assert.Equal(t, 1000.0, findMetric(families["zaim_month_payment_total"], "currency", "JPY").GetGauge().GetValue())
+
+	// 成功するとバックオフは解除される
+	fetcher.err = nil
+	require.True(t, fetchedAfter(4*time.Minute))
+	fetcher.err = errors.New("API error")
+	require.True(t, fetchedAfter(time.Minute))
+	assert.True(t, fetchedAfter(time.Minute))
+}
@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+// monthLayout keys the seen payments by the month of their date
+const monthLayout = "2006-01"
+
+// PaymentCounter backs zaim_payment_amount_total, a per-currency running
+// total of payments that only ever increases.
+//
+// A payment is added the first time its ID is seen in a fetch and is never
+// counted again, so the counter does not reset when the fetch window rolls
+// over to a new month. Later edits to a counted payment and deletions are
+// not reflected. Payments entered after they have left the fetch window are
+// never counted.
+//
+// On a first start (no saved state) the payments already visible are only
+// recorded as seen, so the counter starts at 0 instead of jumping by the
+// whole window, and payments dated before that month (e.g. backfilled ones)
+// are never counted. Seen IDs are kept per month and dropped once the month
+// leaves the fetch and backfill window. The state survives restarts when a
+// store is configured; without one (or if it is lost) the counter starts
+// again from 0, which Prometheus treats as a counter reset.
+type PaymentCounter struct {
+	mu     sync.Mutex
+	totals map[string]float64
+	seen   map[string]map[int64]bool  // by month (YYYY-MM)
+	legacy map[int64]bool             // flat seen IDs of an older state file, until the first Observe
+	since  string                     // first counted month; "" until seeded
+	primed bool                       // false until the first Observe of a first start
+	store  storage.PaymentTotalsStore // nil keeps the state in memory only
+	logger *zap.Logger
+}
+
+// NewPaymentCounter restores the counter from store (which may be nil)
+func NewPaymentCounter(store storage.PaymentTotalsStore, logger *zap.Logger) (*PaymentCounter, error) {
+	c := &PaymentCounter{
+		totals: make(map[string]float64),
+		seen:   make(map[string]map[int64]bool),
+		store:  store,
+		logger: logger,
+	}
+	if store == nil {
+		return c, nil
+	}
+
+	state, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for currency, total := range state.Totals {
+		c.totals[currency] = total
+	}
+	for month, ids := range state.Seen {
+		c.seen[month] = make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			c.seen[month][id] = true
+		}
+	}
+	if len(state.SeenIDs) > 0 {
+		c.legacy = make(map[int64]bool, len(state.SeenIDs))
+		for _, id := range state.SeenIDs {
+			c.legacy[id] = true
+		}
+	}
+	c.since = state.Since
+	c.primed = state.Since != "" || len(state.Seen) > 0 || len(state.SeenIDs) > 0 || len(state.Totals) > 0
+	return c, nil
+}
+
+// Observe adds payments not counted before and persists the new state
+// windowStart is the start of the fetch and backfill window (months before
+// it are pruned) and now the current time, both in the Zaim location
+func (c *PaymentCounter) Observe(transactions []zaim.Transaction, windowStart, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := now.Format(monthLayout)
+	seeding := !c.primed
+	changed := seeding || c.legacy != nil
+	if c.since == "" {
+		c.since = current
+		changed = true
+	}
+
+	for _, tx := range transactions {
+		if tx.Mode != "payment" {
+			continue
+		}
+		month := paymentMonth(tx, current)
+		if c.seen[month][tx.ID] {
+			continue
+		}
+		if c.seen[month] == nil {
+			c.seen[month] = make(map[int64]bool)
+		}
+		c.seen[month][tx.ID] = true
+		changed = true
+		// Uncounted payments still start their currency's series at 0
+		currency := tx.CurrencyCode()
+		if seeding || c.legacy[tx.ID] || month < c.since {
+			c.totals[currency] += 0
+			continue
+		}
+		c.totals[currency] += tx.AmountValue()
+	}
+	c.primed = true
+	// Every legacy ID still in the window was just moved to its month
+	c.legacy = nil
+
+	oldest := windowStart.Format(monthLayout)
+	for month := range c.seen {
+		if month < oldest {
+			delete(c.seen, month)
+			changed = true
+		}
+	}
+
+	if !changed || c.store == nil {
+		return
+	}
+	if err := c.store.Save(c.stateLocked()); err != nil {
+		// Keep counting in memory; the next change retries the save
+		c.logger.Warn("failed to persist payment totals", zap.Error(err))
+	}
+}
+
+// paymentMonth returns the month of tx's date, or current when it has none
+func paymentMonth(tx zaim.Transaction, current string) string {
+	if len(tx.Date) < len(monthLayout) {
+		return current
+	}
+	return tx.Date[:len(monthLayout)]
+}
+
+// Totals returns a copy of the running totals per currency
+func (c *PaymentCounter) Totals() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	totals := make(map[string]float64, len(c.totals))
+	for currency, total := range c.totals {
+		totals[currency] = total
+	}
+	return totals
+}
+
+func (c *PaymentCounter) stateLocked() *storage.PaymentTotals {
+	state := &storage.PaymentTotals{
+		Totals: make(map[string]float64, len(c.totals)),
+		Seen:   make(map[string][]int64, len(c.seen)),
+		Since:  c.since,
+	}
+	for currency, total := range c.totals {
+		state.Totals[currency] = total
+	}
+	for month, ids := range c.seen {
+		state.Seen[month] = slices.Sorted(maps.Keys(ids))
+	}
+	return state
+}
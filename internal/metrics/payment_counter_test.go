@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+// counterWindow は 2024-01 を当月とする取得範囲
+var (
+	counterWindowStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	counterNow         = time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+)
+
+func TestPaymentCounter_Observe(t *testing.T) {
+	counter, err := NewPaymentCounter(nil, zap.NewNop())
+	require.NoError(t, err)
+
+	// 初回は既存の取引を既知として記録するだけで加算しない
+	counter.Observe([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-10", Amount: 1000},
+		{ID: 2, Mode: "income", Date: "2024-01-10", Amount: 50000},
+	}, counterWindowStart, counterNow)
+	assert.Equal(t, map[string]float64{"JPY": 0}, counter.Totals())
+
+	// 同じ取引は再度数えず、新しい取引だけ加算される
+	counter.Observe([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-10", Amount: 1000},
+		{ID: 3, Mode: "payment", Date: "2024-01-20", Amount: 20, Currency: "USD"},
+		{ID: 4, Mode: "payment", Date: "2024-01-20", Amount: 500},
+	}, counterWindowStart, counterNow)
+	assert.Equal(t, map[string]float64{"JPY": 500, "USD": 20}, counter.Totals())
+
+	// 後から届いたバックフィル（初回より前の月）は数えない
+	counter.Observe([]zaim.Transaction{
+		{ID: 5, Mode: "payment", Date: "2023-12-05", Amount: 700},
+	}, counterWindowStart.AddDate(0, -1, 0), counterNow)
+	assert.Equal(t, 500.0, counter.Totals()["JPY"])
+
+	// 月が変わって前月分が取得範囲から外れても減らない
+	counter.Observe([]zaim.Transaction{{ID: 6, Mode: "payment", Date: "2024-02-01", Amount: 300}},
+		counterWindowStart.AddDate(0, 1, 0), counterNow.AddDate(0, 1, 0))
+	assert.Equal(t, 800.0, counter.Totals()["JPY"])
+}
+
+func TestPaymentCounter_PrunesOldMonths(t *testing.T) {
+	store := storage.NewFilePaymentTotalsStore(filepath.Join(t.TempDir(), "payment_totals.json"))
+	counter, err := NewPaymentCounter(store, zap.NewNop())
+	require.NoError(t, err)
+
+	counter.Observe([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2023-12-31", Amount: 1000},
+		{ID: 2, Mode: "payment", Date: "2024-01-10", Amount: 500},
+	}, counterWindowStart.AddDate(0, -1, 0), counterNow)
+
+	// 取得範囲から外れた月の ID は保存されない
+	counter.Observe([]zaim.Transaction{{ID: 2, Mode: "payment", Date: "2024-01-10", Amount: 500}},
+		counterWindowStart, counterNow)
+	state, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]int64{"2024-01": {2}}, state.Seen)
+	assert.Equal(t, "2024-01", state.Since)
+}
+
+func TestPaymentCounter_RestoresAfterRestart(t *testing.T) {
+	store := storage.NewFilePaymentTotalsStore(filepath.Join(t.TempDir(), "payment_totals.json"))
+
+	counter, err := NewPaymentCounter(store, zap.NewNop())
+	require.NoError(t, err)
+	counter.Observe(nil, counterWindowStart, counterNow)
+	counter.Observe([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-10", Amount: 1000},
+		{ID: 2, Mode: "payment", Date: "2024-01-11", Amount: 250},
+	}, counterWindowStart, counterNow)
+
+	// 再起動を想定して同じファイルから復元する
+	restarted, err := NewPaymentCounter(store, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"JPY": 1250}, restarted.Totals())
+
+	// 復元後も数えた取引は重複しない
+	restarted.Observe([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-10", Amount: 1000},
+		{ID: 3, Mode: "payment", Date: "2024-01-12", Amount: 100},
+	}, counterWindowStart, counterNow)
+	assert.Equal(t, 1350.0, restarted.Totals()["JPY"])
+}
+
+func TestPaymentCounter_LegacyState(t *testing.T) {
+	store := storage.NewFilePaymentTotalsStore(filepath.Join(t.TempDir(), "payment_totals.json"))
+	require.NoError(t, store.Save(&storage.PaymentTotals{Totals: map[string]float64{"JPY": 1000}, SeenIDs: []int64{1}}))
+
+	counter, err := NewPaymentCounter(store, zap.NewNop())
+	require.NoError(t, err)
+	counter.Observe([]zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-10", Amount: 1000},
+		{ID: 2, Mode: "payment", Date: "2024-01-11", Amount: 300},
+	}, counterWindowStart, counterNow)
+	assert.Equal(t, 1300.0, counter.Totals()["JPY"])
+
+	// 旧形式の一覧は月ごとの形式に移し替えられる
+	state, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, state.SeenIDs)
+	assert.Equal(t, map[string][]int64{"2024-01": {1, 2}}, state.Seen)
+}
+
+func TestZaimCollector_PaymentAmountTotal(t *testing.T) {
+	counter, err := NewPaymentCounter(nil, zap.NewNop())
+	require.NoError(t, err)
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}
+
+	// 初回起動時に見えている取引は数えず 0 から始まる
+	collector := NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop(), WithPaymentCounter(counter))
+	family := gatherFamilies(t, collector)["zaim_payment_amount_total"]
+	require.NotNil(t, family)
+	assert.Equal(t, 0.0, family.GetMetric()[0].GetCounter().GetValue())
+
+	// 新しい取引が現れると増える（再認証後の新しい collector でも継続）
+	fetcher.transactions = append(fetcher.transactions, zaim.Transaction{ID: 2, Mode: "payment", Date: "2024-01-16", Amount: 400})
+	collector = NewZaimCollector(fetcher, NewAggregator(WithClock(fixedClock)), zap.NewNop(), WithPaymentCounter(counter))
+	family = gatherFamilies(t, collector)["zaim_payment_amount_total"]
+	require.NotNil(t, family)
+	assert.Equal(t, 400.0, family.GetMetric()[0].GetCounter().GetValue())
+}
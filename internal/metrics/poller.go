@@ -0,0 +1,259 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+// Poller fetches from Zaim on a fixed interval and writes the results into
+// gauge vectors, so scrapes never fetch or aggregate and always see the
+// result of one complete poll
+//
+// It exports the hourly, daily, today and month series plus zaim_error,
+// zaim_fetch_success, zaim_transaction_count, zaim_last_update,
+// zaim_api_calls_total and the zaim_transactions_changed_total /
+// zaim_transactions_new_total counters. The optional breakdowns (genre,
+// account, tags, ...) are only available from a scraped ZaimCollector
+type Poller struct {
+	collector *ZaimCollector // fetches, caches and filters; never registered itself
+	interval  time.Duration
+
+	mu            sync.RWMutex // held while a poll rewrites the vectors
+	paymentAmount *prometheus.GaugeVec
+	paymentCount  *prometheus.GaugeVec
+	incomeAmount  *prometheus.GaugeVec
+	incomeCount   *prometheus.GaugeVec
+	paymentAvg    *prometheus.GaugeVec
+	todayTotal    *prometheus.GaugeVec
+	monthIncome   *prometheus.GaugeVec
+	monthPayment  *prometheus.GaugeVec
+	monthBalance  *prometheus.GaugeVec
+	monthTransfer *prometheus.GaugeVec
+	fetchErrors   *prometheus.GaugeVec
+	fetchSuccess  *prometheus.GaugeVec // no labels; absent until the first poll
+	txCount       *prometheus.GaugeVec // no labels; absent without data
+	lastUpdate    prometheus.Gauge
+	apiCalls      prometheus.CounterFunc // nil when the client does not count requests
+	changed       prometheus.CounterFunc
+	added         prometheus.CounterFunc
+}
+
+// NewPoller polls through collector every interval (raised to the
+// collector's minimum refresh interval). Register the Poller, not collector
+func NewPoller(collector *ZaimCollector, interval time.Duration) *Poller {
+	gaugeVec := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	}
+
+	p := &Poller{
+		collector: collector,
+		interval:  max(interval, collector.minRefreshInterval),
+
+		paymentAmount: gaugeVec("zaim_payment_amount", "Total payment amount per hour", "hour", "currency"),
+		paymentCount:  gaugeVec("zaim_payment_count", "Number of payments per hour", "hour", "currency"),
+		incomeAmount:  gaugeVec("zaim_income_amount", "Total income amount per hour", "hour", "currency"),
+		incomeCount:   gaugeVec("zaim_income_count", "Number of income transactions per hour", "hour", "currency"),
+		paymentAvg:    gaugeVec("zaim_payment_avg_amount", "Average payment amount per day", "day", "currency"),
+		todayTotal:    gaugeVec("zaim_today_total_amount", "Today's total spending", "currency"),
+		monthIncome:   gaugeVec("zaim_month_income_total", "Total income this month", "currency"),
+		monthPayment:  gaugeVec("zaim_month_payment_total", "Total payments this month", "currency"),
+		monthBalance:  gaugeVec("zaim_month_balance_amount", "Income minus payments this month (transfers excluded)", "currency"),
+		monthTransfer: gaugeVec("zaim_month_transfer_total", "Total moved between own accounts this month (not part of the balance)", "currency"),
+		fetchErrors:   gaugeVec("zaim_error", "Error fetching data from Zaim API", "type"),
+		fetchSuccess:  gaugeVec("zaim_fetch_success", "Whether the last fetch from Zaim succeeded (1), even if it returned no transactions"),
+		txCount:       gaugeVec("zaim_transaction_count", "Transactions in the current fetch window (0 when the fetch succeeded but returned none)"),
+		lastUpdate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "zaim_last_update",
+			Help: "Unix timestamp of last successful update",
+		}),
+		changed: prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "zaim_transactions_changed_total",
+			Help: "Transactions whose updated time changed between consecutive fetches (edits)",
+		}, func() float64 {
+			return float64(collector.transactionsChanged.Load())
+		}),
+		added: prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "zaim_transactions_new_total",
+			Help: "Transactions not present in the previous fetch",
+		}, func() float64 {
+			return float64(collector.transactionsNew.Load())
+		}),
+	}
+	if reporter, ok := collector.client.(zaim.APICallReporter); ok {
+		p.apiCalls = prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "zaim_api_calls_total",
+			Help: "Requests sent to the Zaim API by this collector",
+		}, func() float64 {
+			return float64(reporter.APICalls())
+		})
+	}
+	return p
+}
+
+func (p *Poller) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{
+		p.paymentAmount, p.paymentCount, p.incomeAmount, p.incomeCount,
+		p.paymentAvg, p.todayTotal,
+		p.monthIncome, p.monthPayment, p.monthBalance, p.monthTransfer,
+		p.fetchErrors, p.fetchSuccess, p.txCount, p.lastUpdate, p.changed, p.added,
+	}
+	if p.apiCalls != nil {
+		collectors = append(collectors, p.apiCalls)
+	}
+	return collectors
+}
+
+func (p *Poller) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range p.collectors() {
+		c.Describe(ch)
+	}
+}
+
+func (p *Poller) Collect(ch chan<- prometheus.Metric) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, c := range p.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Run polls immediately (after the collector's startup jitter) and then
+// every interval until ctx is cancelled or the collector is closed
+func (p *Poller) Run(ctx context.Context) {
+	ctx, done, ok := p.collector.startBackground(ctx)
+	if !ok {
+		return
+	}
+	defer done()
+
+	if !p.collector.waitStartupJitter(ctx) {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			p.collector.logger.Debug("poller stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches once and replaces the exported values
+// On failure the previous values are kept (until they pass the collector's
+// hard expiry) and zaim_error is set; polls during the collector's failure
+// backoff are skipped
+func (p *Poller) Poll(ctx context.Context) {
+	// Backing off after failures: keep the previous values and zaim_error
+	if p.collector.backoffRemaining() > 0 {
+		return
+	}
+
+	err := p.collector.refresh(ctx)
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.fetchErrors.Reset()
+	if err != nil {
+		p.collector.logger.Error("poll failed", zap.Error(err))
+		p.fetchErrors.WithLabelValues(errorType(err)).Set(1)
+		p.fetchSuccess.WithLabelValues().Set(0)
+		p.collector.mu.RLock()
+		expired := p.collector.lastGoodLocked() == nil
+		p.collector.mu.RUnlock()
+		if expired {
+			p.resetData()
+		}
+		return
+	}
+
+	p.collector.mu.RLock()
+	transactions := p.collector.cache.data
+	p.collector.mu.RUnlock()
+
+	p.fetchSuccess.WithLabelValues().Set(1)
+	p.update(p.collector.filter(transactions), p.collector.windowCount(transactions))
+}
+
+// resetData clears every transaction-derived vector; p.mu must be held
+func (p *Poller) resetData() {
+	for _, vec := range []*prometheus.GaugeVec{
+		p.paymentAmount, p.paymentCount, p.incomeAmount, p.incomeCount,
+		p.paymentAvg, p.todayTotal,
+		p.monthIncome, p.monthPayment, p.monthBalance, p.monthTransfer,
+		p.txCount,
+	} {
+		vec.Reset()
+	}
+}
+
+// update rewrites every vector from transactions and count (see
+// ZaimCollector.windowCount); p.mu must be held
+// Vectors are reset first so hours and days that dropped out disappear
+func (p *Poller) update(transactions []zaim.Transaction, count int) {
+	c := p.collector
+	includePayment := c.aggregator.IncludesMode("payment")
+	includeIncome := c.aggregator.IncludesMode("income")
+	includeTransfer := c.aggregator.IncludesMode("transfer")
+
+	p.resetData()
+	p.txCount.WithLabelValues().Set(float64(count))
+
+	for key, metrics := range c.hourlyMetrics(transactions) {
+		if includePayment {
+			p.paymentAmount.WithLabelValues(key.Period, key.Currency).Set(c.scaleAmount(metrics.PaymentTotal, key.Currency))
+			p.paymentCount.WithLabelValues(key.Period, key.Currency).Set(float64(metrics.PaymentCount))
+		}
+		if includeIncome {
+			p.incomeAmount.WithLabelValues(key.Period, key.Currency).Set(c.scaleAmount(metrics.IncomeTotal, key.Currency))
+			p.incomeCount.WithLabelValues(key.Period, key.Currency).Set(float64(metrics.IncomeCount))
+		}
+	}
+
+	if includePayment {
+		for key, metrics := range c.aggregator.AggregateByDay(transactions) {
+			if avg, ok := metrics.AveragePayment(); ok {
+				p.paymentAvg.WithLabelValues(key.Period, key.Currency).Set(c.scaleAmount(avg, key.Currency))
+			}
+		}
+		for currency, total := range c.aggregator.GetTodayTotal(transactions) {
+			p.todayTotal.WithLabelValues(currency).Set(c.scaleAmount(total, currency))
+		}
+	}
+
+	for currency, balance := range c.aggregator.GetMonthBalance(transactions) {
+		if includeIncome {
+			p.monthIncome.WithLabelValues(currency).Set(c.scaleAmount(balance.IncomeTotal, currency))
+		}
+		if includePayment {
+			p.monthPayment.WithLabelValues(currency).Set(c.scaleAmount(balance.PaymentTotal, currency))
+		}
+		if includeIncome && includePayment {
+			p.monthBalance.WithLabelValues(currency).Set(c.scaleAmount(balance.Balance(), currency))
+		}
+		if includeTransfer {
+			p.monthTransfer.WithLabelValues(currency).Set(c.scaleAmount(balance.TransferTotal, currency))
+		}
+	}
+
+	c.statusMu.Lock()
+	lastSuccess := c.lastSuccess
+	c.statusMu.Unlock()
+	p.lastUpdate.Set(float64(lastSuccess.UnixNano()) / float64(time.Second))
+}
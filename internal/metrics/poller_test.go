@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+func TestPoller_Poll(t *testing.T) {
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:00:00", Amount: 1000},
+	}}}
+	aggregator := NewAggregator(WithLocation(time.UTC), WithClock(func() time.Time { return now }))
+	// 失敗直後の再取得を確かめるためバックオフは無効
+	collector := NewZaimCollector(fetcher, aggregator, zap.NewNop(), WithMinRefreshInterval(0), WithFailureBackoff(0))
+	poller := NewPoller(collector, time.Minute)
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(poller))
+	gather := func() map[string]float64 {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		values := make(map[string]float64)
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				// ラベルは名前順（currency, hour）
+				key := family.GetName()
+				for _, label := range metric.GetLabel() {
+					key += "," + label.GetValue()
+				}
+				values[key] = metric.GetGauge().GetValue() + metric.GetCounter().GetValue()
+			}
+		}
+		return values
+	}
+
+	t.Run("ポーリング前のスクレイプは取得しない", func(t *testing.T) {
+		values := gather()
+		assert.Equal(t, int32(0), fetcher.calls.Load())
+		assert.NotContains(t, values, "zaim_fetch_success")
+	})
+
+	t.Run("最新の取得結果を反映", func(t *testing.T) {
+		poller.Poll(context.Background())
+
+		values := gather()
+		assert.Equal(t, 1000.0, values["zaim_payment_amount,JPY,2024-01-15 10:00:00"])
+		assert.Equal(t, 1.0, values["zaim_payment_count,JPY,2024-01-15 10:00:00"])
+		assert.Equal(t, 1000.0, values["zaim_month_payment_total,JPY"])
+		assert.Equal(t, 1000.0, values["zaim_today_total_amount,JPY"])
+		assert.Equal(t, 1.0, values["zaim_api_calls_total"])
+		assert.Equal(t, 1.0, values["zaim_fetch_success"])
+		assert.Equal(t, 1.0, values["zaim_transaction_count"])
+
+		// スクレイプしても取得は増えない
+		gather()
+		assert.Equal(t, int32(1), fetcher.calls.Load())
+	})
+
+	t.Run("なくなった時間帯の系列は消える", func(t *testing.T) {
+		fetcher.transactions = []zaim.Transaction{
+			{ID: 2, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 11:00:00", Amount: 500},
+		}
+		poller.Poll(context.Background())
+
+		values := gather()
+		assert.NotContains(t, values, "zaim_payment_amount,JPY,2024-01-15 10:00:00")
+		assert.Equal(t, 500.0, values["zaim_payment_amount,JPY,2024-01-15 11:00:00"])
+		assert.Equal(t, 500.0, values["zaim_month_payment_total,JPY"])
+	})
+
+	t.Run("失敗時は直前の値を保ちエラーを出す", func(t *testing.T) {
+		fetcher.err = zaim.ErrRateLimited
+		defer func() { fetcher.err = nil }()
+		poller.Poll(context.Background())
+
+		values := gather()
+		assert.Equal(t, 500.0, values["zaim_payment_amount,JPY,2024-01-15 11:00:00"])
+		assert.Equal(t, 1.0, values["zaim_error,rate_limited"])
+		assert.Equal(t, 0.0, values["zaim_fetch_success"])
+
+		fetcher.err = nil
+		poller.Poll(context.Background())
+		assert.NotContains(t, gather(), "zaim_error,rate_limited")
+	})
+}
+
+func TestPoller_TransactionCountExcludesBackfill(t *testing.T) {
+	fetcher := &monthFetcher{}
+	aggregator := NewAggregator(WithLocation(time.FixedZone("JST", 9*60*60)), WithClock(fixedClock))
+	collector := NewZaimCollector(fetcher, aggregator, zap.NewNop(),
+		WithMinRefreshInterval(0), WithBackfill(2, time.Millisecond), WithBackfillRefreshInterval(0),
+	)
+	poller := NewPoller(collector, time.Minute)
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(poller))
+
+	poller.Poll(context.Background())
+	require.Eventually(t, func() bool { return len(fetcher.recorded()) == 3 }, time.Second, time.Millisecond)
+	// バックフィル完了後のポーリングでも当月分だけを数える
+	poller.Poll(context.Background())
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var count *float64
+	for _, family := range families {
+		if family.GetName() == "zaim_transaction_count" {
+			value := family.GetMetric()[0].GetGauge().GetValue()
+			count = &value
+		}
+	}
+	require.NotNil(t, count)
+	assert.Equal(t, 1.0, *count)
+	// 過去月は集計には含まれる
+	assert.Len(t, collector.filter([]zaim.Transaction{}), 2)
+}
+
+func TestManager_WithPolling(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := NewManager(registry, zap.NewNop(),
+		WithRootContext(ctx),
+		WithPolling(time.Hour),
+		WithCollectorOptions(WithMinRefreshInterval(0)),
+	)
+
+	fetcher := &countingFetcher{mockTransactionFetcher: mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-15", Created: "2024-01-15 10:00:00", Amount: 1000},
+	}}}
+	require.NoError(t, manager.RegisterCollector(fetcher))
+
+	// 登録直後にポーリングが始まり、スクレイプでは取得しない
+	assert.Eventually(t, func() bool { return manager.Status().LastSuccess != time.Time{} }, time.Second, 10*time.Millisecond)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	assert.NotEmpty(t, families)
+	assert.Equal(t, int32(1), fetcher.calls.Load())
+
+	// 解除でポーラーも外れる
+	manager.UnregisterCollector()
+	families, err = registry.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, families)
+
+	cancel()
+	manager.Wait()
+}
+
+func TestPoller_MonthRollover(t *testing.T) {
+	now := time.Date(2024, 1, 31, 23, 30, 0, 0, time.UTC)
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-31", Created: "2024-01-31 22:00:00", Amount: 1000},
+	}}
+	aggregator := NewAggregator(WithLocation(time.UTC), WithClock(func() time.Time { return now }))
+	poller := NewPoller(NewZaimCollector(fetcher, aggregator, zap.NewNop(), WithMinRefreshInterval(0)), time.Minute)
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(poller))
+	hours := func() []string {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		var hours []string
+		for _, family := range families {
+			if family.GetName() != "zaim_payment_amount" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "hour" {
+						hours = append(hours, label.GetValue())
+					}
+				}
+			}
+		}
+		return hours
+	}
+
+	poller.Poll(context.Background())
+	assert.Equal(t, []string{"2024-01-31 22:00:00"}, hours())
+
+	// 2 月に入っても Zaim が 1 月の行を返す場合、前月の時間帯は削除される
+	now = time.Date(2024, 2, 1, 0, 30, 0, 0, time.UTC)
+	poller.Poll(context.Background())
+	assert.Empty(t, hours())
+}
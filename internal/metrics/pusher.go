@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultPushJob is the job label used for Pushgateway pushes
+	DefaultPushJob = "zaim_exporter"
+
+	// DefaultPushInterval is how often metrics are pushed
+	DefaultPushInterval = time.Minute
+)
+
+// Pusher periodically pushes everything gathered from a registry to a
+// Prometheus Pushgateway, for environments that cannot be scraped
+type Pusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+// NewPusher pushes gatherer to the Pushgateway at url under job
+// Non-positive intervals use DefaultPushInterval, an empty job DefaultPushJob
+func NewPusher(url, job string, gatherer prometheus.Gatherer, interval time.Duration, logger *zap.Logger) *Pusher {
+	if job == "" {
+		job = DefaultPushJob
+	}
+	if interval <= 0 {
+		interval = DefaultPushInterval
+	}
+	return &Pusher{
+		pusher:   push.New(url, job).Gatherer(gatherer),
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run pushes immediately and then once per interval until ctx is cancelled
+// Each push replaces the job's previous metrics on the Pushgateway
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.pusher.PushContext(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Error("failed to push metrics to pushgateway", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
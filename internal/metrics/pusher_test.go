@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPusher_Run(t *testing.T) {
+	type pushRequest struct {
+		method, path, body string
+	}
+	pushes := make(chan pushRequest, 10)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		pushes <- pushRequest{method: r.Method, path: r.URL.Path, body: string(body)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test gauge"})
+	gauge.Set(42)
+	registry.MustRegister(gauge)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewPusher(gateway.URL, "", registry, 10*time.Millisecond, zap.NewNop()).Run(ctx)
+	}()
+
+	// 起動直後に既定の job ラベルで PUT される
+	select {
+	case got := <-pushes:
+		assert.Equal(t, http.MethodPut, got.method)
+		assert.Equal(t, "/metrics/job/"+DefaultPushJob, got.path)
+		assert.Contains(t, got.body, "test_gauge")
+	case <-time.After(time.Second):
+		t.Fatal("push が行われない")
+	}
+
+	// 間隔ごとに繰り返される
+	select {
+	case <-pushes:
+	case <-time.After(time.Second):
+		t.Fatal("2 回目の push が行われない")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "キャンセル後も Run が終了しない")
+	}
+}
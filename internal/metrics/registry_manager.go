@@ -1,7 +1,9 @@
 package metrics
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
@@ -12,48 +14,160 @@ import (
 // Supports dynamic registration and unregistration of collectors
 type Manager struct {
 	mu               sync.RWMutex
-	currentCollector prometheus.Collector
+	currentCollector *ZaimCollector
+	registered       prometheus.Collector // currentCollector or its Poller
 	registerer       prometheus.Registerer
 	logger           *zap.Logger
 	aggregator       *Aggregator
+	collectorOpts    []CollectorOption
+	cacheDuration    time.Duration // overrides collectorOpts once set via SetCacheDuration
+
+	// Background refresh of the current collector (see WithBackgroundRefresh)
+	ctx               context.Context
+	backgroundRefresh bool
+	stopRefresh       context.CancelFunc
+	refreshWG         sync.WaitGroup
+
+	// pollInterval > 0 serves metrics from a Poller instead (see WithPolling)
+	pollInterval time.Duration
+}
+
+// ManagerOption customizes a Manager
+type ManagerOption func(*Manager)
+
+// WithAggregator sets the aggregator shared by every collector the manager registers
+func WithAggregator(aggregator *Aggregator) ManagerOption {
+	return func(m *Manager) {
+		m.aggregator = aggregator
+	}
+}
+
+// WithCollectorOptions sets options applied to every collector the manager registers
+func WithCollectorOptions(opts ...CollectorOption) ManagerOption {
+	return func(m *Manager) {
+		m.collectorOpts = append(m.collectorOpts, opts...)
+	}
+}
+
+// WithRootContext sets the context collectors fetch with; cancel it on
+// shutdown to stop background refresh loops and abort in-flight requests
+func WithRootContext(ctx context.Context) ManagerOption {
+	return func(m *Manager) {
+		m.ctx = ctx
+	}
+}
+
+// WithBackgroundRefresh runs each registered collector's refresh loop
+// (see ZaimCollector.Run) until it is replaced, unregistered or the root
+// context is cancelled
+func WithBackgroundRefresh(enabled bool) ManagerOption {
+	return func(m *Manager) {
+		m.backgroundRefresh = enabled
+	}
+}
+
+// WithPolling registers a Poller fetching every interval instead of the
+// collector itself, so scrapes never trigger fetches. Zero keeps scrape mode
+func WithPolling(interval time.Duration) ManagerOption {
+	return func(m *Manager) {
+		m.pollInterval = interval
+	}
 }
 
 // NewManager creates a new registry manager
 // registerer: prometheus.Registerer interface for testability
-// In production, use prometheus.DefaultRegisterer
+// In production, use the same registry that serves /metrics
 // In tests, use prometheus.NewRegistry() for isolation
-func NewManager(registerer prometheus.Registerer, logger *zap.Logger) *Manager {
-	return &Manager{
+func NewManager(registerer prometheus.Registerer, logger *zap.Logger, opts ...ManagerOption) *Manager {
+	m := &Manager{
 		registerer: registerer,
 		logger:     logger,
-		aggregator: NewAggregator(),
+		ctx:        context.Background(),
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.aggregator == nil {
+		m.aggregator = NewAggregator()
+	}
+	return m
 }
 
 // RegisterCollector registers a new Zaim collector
 // Automatically unregisters existing collector if present
 // This enables dynamic collector registration after OAuth authentication
-func (m *Manager) RegisterCollector(client zaim.TransactionFetcher) error {
+// opts apply to this collector only, after the manager's collector options
+// (e.g. WithStartupJitter for the collector created at process start)
+func (m *Manager) RegisterCollector(client zaim.TransactionFetcher, opts ...CollectorOption) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Unregister existing collector if present
 	if m.currentCollector != nil {
-		m.registerer.Unregister(m.currentCollector)
+		m.closeCurrentLocked()
+		m.registerer.Unregister(m.registered)
 		m.logger.Info("unregistered existing collector")
 	}
 
 	// Create and register new collector
-	collector := NewZaimCollector(client, m.aggregator, m.logger)
-	if err := m.registerer.Register(collector); err != nil {
+	ctx, cancel := context.WithCancel(m.ctx)
+	opts = append(append(append([]CollectorOption{}, m.collectorOpts...), opts...), WithCacheDuration(m.cacheDuration), WithBaseContext(ctx))
+	collector := NewZaimCollector(client, m.aggregator, m.logger, opts...)
+
+	var registered prometheus.Collector = collector
+	run := collector.Run
+	if m.pollInterval > 0 {
+		poller := NewPoller(collector, m.pollInterval)
+		registered, run = poller, poller.Run
+	}
+	if err := m.registerer.Register(registered); err != nil {
+		cancel()
 		return err
 	}
 
 	m.currentCollector = collector
+	m.registered = registered
+	m.stopRefresh = cancel
+	if m.backgroundRefresh || m.pollInterval > 0 {
+		m.refreshWG.Add(1)
+		go func() {
+			defer m.refreshWG.Done()
+			run(ctx)
+		}()
+	}
 	m.logger.Info("registered new Zaim collector")
 	return nil
 }
 
+// closeCurrentLocked cancels the current collector's context and closes it;
+// m.mu must be held
+func (m *Manager) closeCurrentLocked() {
+	if m.stopRefresh != nil {
+		m.stopRefresh()
+		m.stopRefresh = nil
+	}
+	if m.currentCollector != nil {
+		m.currentCollector.Close()
+	}
+}
+
+// Close stops the current collector's background loops and waits for every
+// loop to exit. The collector stays registered and keeps serving its last
+// cached data, so call it during shutdown before closing the stores
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closeCurrentLocked()
+	m.mu.Unlock()
+
+	m.Wait()
+}
+
+// Wait blocks until every background refresh loop has exited
+// Call after cancelling the root context so stores can be closed safely
+func (m *Manager) Wait() {
+	m.refreshWG.Wait()
+}
+
 // UnregisterCollector removes the current collector from the registry
 // Called during authentication reset to prevent stale metrics
 func (m *Manager) UnregisterCollector() {
@@ -61,8 +175,10 @@ func (m *Manager) UnregisterCollector() {
 	defer m.mu.Unlock()
 
 	if m.currentCollector != nil {
-		m.registerer.Unregister(m.currentCollector)
+		m.closeCurrentLocked()
+		m.registerer.Unregister(m.registered)
 		m.currentCollector = nil
+		m.registered = nil
 		m.logger.Info("unregistered collector")
 	}
 }
@@ -73,3 +189,28 @@ func (m *Manager) IsRegistered() bool {
 	defer m.mu.RUnlock()
 	return m.currentCollector != nil
 }
+
+// Status reports the current collector's state; Registered is false when
+// no collector is registered (e.g. before OAuth completes)
+func (m *Manager) Status() CollectorStatus {
+	m.mu.RLock()
+	collector := m.currentCollector
+	m.mu.RUnlock()
+
+	if collector == nil {
+		return CollectorStatus{}
+	}
+	return collector.Status()
+}
+
+// SetCacheDuration applies a new cache duration to the current collector
+// and to collectors registered later (e.g. after re-authentication)
+func (m *Manager) SetCacheDuration(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cacheDuration = d
+	if m.currentCollector != nil {
+		m.currentCollector.SetCacheDuration(d)
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
 	"go.uber.org/zap"
 )
@@ -149,3 +151,116 @@ func TestManager_MultipleUnregister(t *testing.T) {
 
 	assert.False(t, manager.IsRegistered())
 }
+
+func TestManager_SetCacheDuration(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	manager := NewManager(registry, zap.NewNop(), WithCollectorOptions(WithCacheDuration(time.Minute)))
+
+	err := manager.RegisterCollector(newMockFetcher())
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, manager.currentCollector.cacheDuration)
+
+	// 登録済みの Collector に即時反映
+	manager.SetCacheDuration(10 * time.Minute)
+	assert.Equal(t, 10*time.Minute, manager.currentCollector.cacheDuration)
+
+	// 再登録後も維持される
+	err = manager.RegisterCollector(newMockFetcher())
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, manager.currentCollector.cacheDuration)
+}
+
+func TestManager_BackgroundRefreshStopsOnRootCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	manager := NewManager(prometheus.NewRegistry(), zap.NewNop(),
+		WithRootContext(ctx),
+		WithBackgroundRefresh(true),
+	)
+	require.NoError(t, manager.RegisterCollector(newMockFetcher()))
+
+	cancel()
+	waited := make(chan struct{})
+	go func() {
+		manager.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("background refresh did not stop after root context was cancelled")
+	}
+}
+
+func TestManager_Close(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	manager := NewManager(registry, zap.NewNop(), WithBackgroundRefresh(true))
+	require.NoError(t, manager.RegisterCollector(newMockFetcher()))
+
+	closed := make(chan struct{})
+	go func() {
+		manager.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not wait for the background refresh to stop")
+	}
+
+	// 登録は残り、メトリクスは引き続き取得できる
+	assert.True(t, manager.IsRegistered())
+	_, err := registry.Gather()
+	assert.NoError(t, err)
+}
+
+func TestManager_Status(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	manager := NewManager(registry, zap.NewNop())
+
+	t.Run("未登録", func(t *testing.T) {
+		assert.Equal(t, CollectorStatus{}, manager.Status())
+	})
+
+	t.Run("取得成功後は件数と時刻を報告", func(t *testing.T) {
+		require.NoError(t, manager.RegisterCollector(newMockFetcher()))
+		_, err := registry.Gather()
+		require.NoError(t, err)
+
+		status := manager.Status()
+		assert.True(t, status.Registered)
+		assert.Equal(t, 1, status.CachedTransactions)
+		assert.False(t, status.LastSuccess.IsZero())
+		assert.Empty(t, status.LastError)
+	})
+
+	t.Run("取得失敗はエラーを報告", func(t *testing.T) {
+		require.NoError(t, manager.RegisterCollector(newErrorFetcher()))
+		_, err := registry.Gather()
+		require.NoError(t, err)
+
+		status := manager.Status()
+		assert.True(t, status.Registered)
+		assert.Zero(t, status.CachedTransactions)
+		assert.NotEmpty(t, status.LastError)
+	})
+}
+
+func TestManager_RegisterCollectorOptions(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	manager := NewManager(registry, zap.NewNop())
+
+	// 起動時の collector だけにジッタを掛ける
+	require.NoError(t, manager.RegisterCollector(newMockFetcher(), WithStartupJitter(time.Hour)))
+	manager.mu.RLock()
+	manager.currentCollector.warmAt = time.Now().Add(time.Hour)
+	manager.mu.RUnlock()
+	assert.True(t, manager.Status().Warming)
+
+	// OAuth 後に登録し直した collector は待たずに取得する
+	require.NoError(t, manager.RegisterCollector(newMockFetcher()))
+	assert.False(t, manager.Status().Warming)
+	_, err := registry.Gather()
+	require.NoError(t, err)
+	assert.Equal(t, 1, manager.Status().CachedTransactions)
+}
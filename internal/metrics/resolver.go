@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultNameRefreshInterval is how long category and genre names are cached
+	DefaultNameRefreshInterval = 24 * time.Hour
+
+	// nameMissRetry is the minimum time between fetches triggered by an
+	// unknown ID or a failed fetch, so neither refetches on every lookup
+	nameMissRetry = time.Minute
+)
+
+// CategoryResolver caches Zaim's category and genre names, refetching them
+// once per refresh interval or when an unknown ID (e.g. a newly added
+// custom category) is looked up
+// Names are only available when the client implements zaim.CategoryFetcher /
+// zaim.GenreFetcher; otherwise lookups return ""
+type CategoryResolver struct {
+	client  zaim.TransactionFetcher
+	refresh time.Duration
+	logger  *zap.Logger
+	now     func() time.Time
+
+	mu         sync.Mutex
+	categories nameCache
+	genres     nameCache
+}
+
+type nameCache struct {
+	names       map[int]string
+	fetchedAt   time.Time // last successful fetch
+	attemptedAt time.Time // last fetch, successful or not
+}
+
+// NewCategoryResolver caches names fetched through client for refresh
+// Non-positive refresh intervals use DefaultNameRefreshInterval
+func NewCategoryResolver(client zaim.TransactionFetcher, refresh time.Duration, logger *zap.Logger) *CategoryResolver {
+	if refresh <= 0 {
+		refresh = DefaultNameRefreshInterval
+	}
+	return &CategoryResolver{
+		client:  client,
+		refresh: refresh,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// NameForCategory returns the name of a category ID, or "" when unknown
+func (r *CategoryResolver) NameForCategory(ctx context.Context, id int) string {
+	fetcher, ok := r.client.(zaim.CategoryFetcher)
+	if !ok {
+		return ""
+	}
+	return r.lookup(ctx, &r.categories, id, "category", fetcher.GetCategories)
+}
+
+// NameForGenre returns the name of a genre ID, or "" when unknown
+func (r *CategoryResolver) NameForGenre(ctx context.Context, id int) string {
+	fetcher, ok := r.client.(zaim.GenreFetcher)
+	if !ok {
+		return ""
+	}
+	return r.lookup(ctx, &r.genres, id, "genre", fetcher.GetGenres)
+}
+
+// lookup refreshes cache when it is older than the refresh interval or id is
+// missing, then returns the name. Failed fetches are logged; the previous
+// names stay in use and the fetch is retried after nameMissRetry
+func (r *CategoryResolver) lookup(ctx context.Context, cache *nameCache, id int, kind string, fetch func(context.Context) (map[int]string, error)) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	name, known := cache.names[id]
+	fresh := cache.names != nil && now.Sub(cache.fetchedAt) < r.refresh
+	if (fresh && known) || (!cache.attemptedAt.IsZero() && now.Sub(cache.attemptedAt) < nameMissRetry) {
+		return name
+	}
+
+	cache.attemptedAt = now
+	names, err := fetch(ctx)
+	if err != nil {
+		r.logger.Warn("failed to fetch names", zap.String("kind", kind), zap.Error(err))
+		return name
+	}
+
+	cache.names = names
+	cache.fetchedAt = now
+	return names[id]
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// categoryFetcher はカテゴリ名・ジャンル名の取得にも対応したモック
+type categoryFetcher struct {
+	mockTransactionFetcher
+	categories     map[int]string
+	categoryCalls  int
+	genres         map[int]string
+	genreCalls     int
+	categoriesFail error
+}
+
+func (f *categoryFetcher) GetCategories(ctx context.Context) (map[int]string, error) {
+	f.categoryCalls++
+	if f.categoriesFail != nil {
+		return nil, f.categoriesFail
+	}
+	return f.categories, nil
+}
+
+func (f *categoryFetcher) GetGenres(ctx context.Context) (map[int]string, error) {
+	f.genreCalls++
+	return f.genres, nil
+}
+
+func TestCategoryResolver(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	fetcher := &categoryFetcher{
+		categories: map[int]string{101: "食費"},
+		genres:     map[int]string{10101: "食料品"},
+	}
+	resolver := NewCategoryResolver(fetcher, time.Hour, zap.NewNop())
+	resolver.now = func() time.Time { return now }
+
+	// 初回はキャッシュがないので取得する
+	assert.Equal(t, "食費", resolver.NameForCategory(ctx, 101))
+	assert.Equal(t, 1, fetcher.categoryCalls)
+	assert.Equal(t, "食料品", resolver.NameForGenre(ctx, 10101))
+	assert.Equal(t, 1, fetcher.genreCalls)
+
+	// キャッシュ済みの ID は取得しない
+	assert.Equal(t, "食費", resolver.NameForCategory(ctx, 101))
+	assert.Equal(t, 1, fetcher.categoryCalls)
+
+	// 追加されたカテゴリはキャッシュミスで取得し直す（直後の連続取得はしない）
+	fetcher.categories = map[int]string{101: "食費", 201: "推し活"}
+	assert.Empty(t, resolver.NameForCategory(ctx, 201))
+	assert.Equal(t, 1, fetcher.categoryCalls)
+
+	now = now.Add(nameMissRetry)
+	assert.Equal(t, "推し活", resolver.NameForCategory(ctx, 201))
+	assert.Equal(t, 2, fetcher.categoryCalls)
+
+	// 更新間隔を過ぎると既知の ID でも取得し直す
+	fetcher.categories = map[int]string{101: "食費・日用品", 201: "推し活"}
+	now = now.Add(time.Hour)
+	assert.Equal(t, "食費・日用品", resolver.NameForCategory(ctx, 101))
+	assert.Equal(t, 3, fetcher.categoryCalls)
+
+	// 失敗時は前回の名前を使う
+	fetcher.categoriesFail = errors.New("API error")
+	now = now.Add(time.Hour)
+	assert.Equal(t, "食費・日用品", resolver.NameForCategory(ctx, 101))
+	assert.Equal(t, 4, fetcher.categoryCalls)
+	assert.Equal(t, "食費・日用品", resolver.NameForCategory(ctx, 101))
+	assert.Equal(t, 4, fetcher.categoryCalls)
+}
+
+func TestCategoryResolver_Unsupported(t *testing.T) {
+	resolver := NewCategoryResolver(&mockTransactionFetcher{}, 0, zap.NewNop())
+	assert.Equal(t, DefaultNameRefreshInterval, resolver.refresh)
+	assert.Empty(t, resolver.NameForCategory(context.Background(), 101))
+	assert.Empty(t, resolver.NameForGenre(context.Background(), 10101))
+}
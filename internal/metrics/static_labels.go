@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// reservedLabels are the label names the exporter emits itself, which a
+// static label would collide with at scrape time: the Zaim metrics, the
+// scope label of the group ledger, the HTTP and build info metrics, and the
+// Go runtime and histogram/summary series
+var reservedLabels = []string{
+	"account", "account_id", "category", "category_id", "code", "commit",
+	"currency", "date", "day", "genre", "genre_id", "handler", "hour", "le",
+	"method", "mode", "name", "quantile", "scope", "tag", "type", "version",
+}
+
+// ParseStaticLabels parses a comma-separated list such as
+// "household=smith,env=home" into labels to attach to every metric (see
+// prometheus.WrapRegistererWith). Names must be valid Prometheus label names,
+// must not start with "__" and may appear once; an empty string yields nil
+func ParseStaticLabels(value string) (prometheus.Labels, error) {
+	var labels prometheus.Labels
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, labelValue, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid static label %q (want name=value)", pair)
+		}
+		name, labelValue = strings.TrimSpace(name), strings.TrimSpace(labelValue)
+		if !model.LabelName(name).IsValidLegacy() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("invalid static label name %q", name)
+		}
+		if slices.Contains(reservedLabels, name) {
+			return nil, fmt.Errorf("static label %q is set by the exporter", name)
+		}
+		if labelValue == "" {
+			return nil, fmt.Errorf("static label %q has an empty value", name)
+		}
+		if _, dup := labels[name]; dup {
+			return nil, fmt.Errorf("duplicate static label %q", name)
+		}
+		if labels == nil {
+			labels = prometheus.Labels{}
+		}
+		labels[name] = labelValue
+	}
+	return labels, nil
+}
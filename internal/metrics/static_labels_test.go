@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+func TestParseStaticLabels(t *testing.T) {
+	labels, err := ParseStaticLabels(" household=smith , env = home,")
+	require.NoError(t, err)
+	assert.Equal(t, prometheus.Labels{"household": "smith", "env": "home"}, labels)
+
+	labels, err = ParseStaticLabels("")
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+
+	for _, value := range []string{
+		"household",               // = がない
+		"house-hold=smith",        // 使えない文字
+		"__name__=x",              // 予約済みの接頭辞
+		"scope=home",              // エクスポーターが付けるラベル
+		"currency=JPY",            // Zaim のメトリクスのラベル
+		"le=1",                    // ヒストグラムのラベル
+		"household=",              // 空の値
+		"household=a,household=b", // 重複
+	} {
+		_, err := ParseStaticLabels(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestReservedLabels_CoverEmittedLabels(t *testing.T) {
+	fetcher := &mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Name: "ランチ", Comment: "#外食", Date: "2024-01-20", Created: "2024-01-20 12:00:00", CategoryID: 101, GenreID: 10101, FromAccountID: 1, Amount: 1000},
+		{ID: 2, Mode: "income", Date: "2024-01-15", Created: "2024-01-15 09:00:00", CategoryID: 11, ToAccountID: 1, Amount: 300000},
+		{ID: 3, Mode: "transfer", Date: "2024-01-16", Created: "2024-01-16 09:00:00", FromAccountID: 1, ToAccountID: 2, Amount: 5000},
+	}}
+	aggregator := NewAggregator(WithClock(fixedClock), WithMonthlyBudget(50000, map[int]int{101: 10000}))
+	collector := NewZaimCollector(fetcher, aggregator, zap.NewNop(),
+		WithGenreMetrics(true),
+		WithAccountMetrics(true),
+		WithAccountSplit(true),
+		WithDailyMetrics(true),
+		WithCommentTags(regexp.MustCompile(`#(\S+)`), DefaultMaxCommentTags),
+	)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		NewBuildInfoCollector(BuildInfo{Version: "dev", Commit: "none"}),
+	)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	// 出力されるラベル名がすべて静的ラベルとして拒否される
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				assert.Contains(t, reservedLabels, label.GetName(), family.GetName())
+			}
+		}
+	}
+}
+
+func TestManager_StaticLabels(t *testing.T) {
+	labels, err := ParseStaticLabels("household=smith")
+	require.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	manager := NewManager(prometheus.WrapRegistererWith(labels, registry), zap.NewNop(),
+		WithAggregator(NewAggregator(WithClock(fixedClock))),
+	)
+	require.NoError(t, manager.RegisterCollector(&mockTransactionFetcher{transactions: []zaim.Transaction{
+		{ID: 1, Mode: "payment", Date: "2024-01-20", Amount: 1000},
+	}}))
+	defer manager.UnregisterCollector()
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	var today *float64
+	for _, family := range families {
+		if family.GetName() != "zaim_today_total_amount" {
+			continue
+		}
+		metric := findMetric(family, "household", "smith")
+		require.NotNil(t, metric)
+		value := metric.GetGauge().GetValue()
+		today = &value
+	}
+	require.NotNil(t, today)
+	assert.Equal(t, 1000.0, *today)
+}
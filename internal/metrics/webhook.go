@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultWebhookTimeout bounds one webhook POST
+const DefaultWebhookTimeout = 10 * time.Second
+
+// AuthLostNotifier POSTs to a webhook (e.g. a Slack incoming webhook) when Zaim
+// stops accepting the access token. Register Notify with
+// WithUnauthorizedHandler: the collector calls it once per 401 streak
+type AuthLostNotifier struct {
+	url      string
+	hostname string
+	client   *http.Client
+	logger   *zap.Logger
+}
+
+// authLostPayload is the webhook body; text is what Slack displays
+type authLostPayload struct {
+	Text     string `json:"text"`
+	Hostname string `json:"hostname"`
+}
+
+// NewAuthLostNotifier posts to url, naming this host in the message
+func NewAuthLostNotifier(url string, logger *zap.Logger) *AuthLostNotifier {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return &AuthLostNotifier{
+		url:      url,
+		hostname: hostname,
+		client:   &http.Client{Timeout: DefaultWebhookTimeout},
+		logger:   logger,
+	}
+}
+
+// Notify sends the notification, logging rather than returning failures
+func (n *AuthLostNotifier) Notify() {
+	if err := n.send(context.Background()); err != nil {
+		n.logger.Error("failed to send auth lost webhook", zap.Error(err))
+		return
+	}
+	n.logger.Info("sent auth lost webhook")
+}
+
+func (n *AuthLostNotifier) send(ctx context.Context) error {
+	body, err := json.Marshal(authLostPayload{
+		Text:     fmt.Sprintf("zaim-prometheus-exporter on %s lost its Zaim authorization, re-authenticate via /zaim/auth", n.hostname),
+		Hostname: n.hostname,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
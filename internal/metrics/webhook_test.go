@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+func TestAuthLostNotifier(t *testing.T) {
+	var posts atomic.Int32
+	payloads := make(chan authLostPayload, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var payload authLostPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		posts.Add(1)
+		payloads <- payload
+	}))
+	defer webhook.Close()
+
+	fetcher := &mockTransactionFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1000}},
+	}
+	notifier := NewAuthLostNotifier(webhook.URL, zap.NewNop())
+	collector := NewZaimCollector(fetcher, NewAggregator(), zap.NewNop(),
+		WithCacheDuration(time.Nanosecond),
+		WithMinRefreshInterval(0),
+		WithUnauthorizedHandler(notifier.Notify),
+	)
+	gatherFamilies(t, collector)
+
+	// 認証が失われた時点で一度だけ通知する
+	fetcher.err = zaim.ErrUnauthorized
+	gatherFamilies(t, collector)
+
+	var payload authLostPayload
+	select {
+	case payload = <-payloads:
+	case <-time.After(time.Second):
+		t.Fatal("webhook が呼ばれない")
+	}
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assert.Equal(t, hostname, payload.Hostname)
+	assert.Contains(t, payload.Text, hostname)
+
+	// 401 が続いても再送しない
+	gatherFamilies(t, collector)
+	gatherFamilies(t, collector)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int32(1), posts.Load())
+
+	// 復旧後に再び失われたら新しい障害として通知する
+	fetcher.err = nil
+	gatherFamilies(t, collector)
+	fetcher.err = zaim.ErrUnauthorized
+	gatherFamilies(t, collector)
+	assert.Eventually(t, func() bool { return posts.Load() == 2 }, time.Second, 5*time.Millisecond)
+}
+
+func TestAuthLostNotifier_SendError(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer webhook.Close()
+
+	err := NewAuthLostNotifier(webhook.URL, zap.NewNop()).send(t.Context())
+	assert.EqualError(t, err, "webhook returned status 403")
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/metrics"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestServer_AuditLog(t *testing.T) {
+	zaimServer := newMockZaimOAuthServer(t, make(chan string, 1))
+
+	tokenStorage, err := auth.NewFileTokenStorage(filepath.Join(t.TempDir(), "tokens.json"), "")
+	require.NoError(t, err)
+	authManager := auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop(),
+		auth.WithEndpoint(oauth1.Endpoint{
+			RequestTokenURL: zaimServer.URL + "/request_token",
+			AuthorizeURL:    zaimServer.URL + "/authorize",
+			AccessTokenURL:  zaimServer.URL + "/access_token",
+		}))
+	requestTokenStore := storage.NewMemoryRequestTokenStore(zap.NewNop())
+	t.Cleanup(func() { requestTokenStore.Close() })
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	registry := prometheus.NewRegistry()
+	srv := NewServer(authManager, requestTokenStore, metrics.NewManager(registry, zap.NewNop()), registry, zap.New(core))
+
+	serve := func(method, target, requestID string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(requestIDHeader, requestID)
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+		return rec.Code
+	}
+	audits := func(event string) []observer.LoggedEntry {
+		return logs.FilterField(zap.String("event", event)).AllUntimed()
+	}
+
+	require.Equal(t, http.StatusFound, serve(http.MethodGet, "/zaim/auth/start", "start-1"))
+	require.Len(t, audits("auth.start"), 1)
+	assert.Equal(t, "start-1", audits("auth.start")[0].ContextMap()["request_id"])
+
+	t.Run("コールバック成功を記録し、トークンは伏せる", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, serve(http.MethodGet, "/zaim/auth/callback?oauth_token=request-token&oauth_verifier=verifier", "callback-1"))
+
+		entries := audits("auth.callback.success")
+		require.Len(t, entries, 1)
+		assert.Equal(t, zapcore.InfoLevel, entries[0].Level)
+		assert.Equal(t, map[string]interface{}{
+			"audit":         true,
+			"event":         "auth.callback.success",
+			"request_id":    "callback-1",
+			"remote_addr":   "192.0.2.1:1234",
+			"request_token": "requ...[REDACTED]",
+		}, entries[0].ContextMap())
+
+		for _, entry := range logs.AllUntimed() {
+			fields := fmt.Sprint(entry.ContextMap())
+			assert.NotContains(t, fields, "request-secret")
+			assert.NotContains(t, fields, "verifier")
+		}
+	})
+
+	t.Run("失敗は警告としてエラーとともに記録", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, serve(http.MethodGet, "/zaim/auth/callback?oauth_token=request-token", "callback-2"))
+
+		entries := audits("auth.callback.failure")
+		require.Len(t, entries, 1)
+		assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+		assert.Equal(t, "callback-2", entries[0].ContextMap()["request_id"])
+		assert.Contains(t, entries[0].ContextMap()["error"], "missing OAuth parameters")
+	})
+
+	t.Run("リセットを記録", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, serve(http.MethodPost, "/zaim/auth/reset", "reset-1"))
+		require.Len(t, audits("auth.reset"), 1)
+	})
+}
+
+func TestRedactToken(t *testing.T) {
+	assert.Equal(t, "abcd...[REDACTED]", redactToken("abcdefgh"))
+	assert.Equal(t, "[REDACTED]", redactToken("abcd"))
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// forwardedPrefixHeader is set by reverse proxies that strip a path prefix
+const forwardedPrefixHeader = "X-Forwarded-Prefix"
+
+// NormalizeBasePath returns path with a leading and no trailing slash
+// ("zaim/" → "/zaim"); "" and "/" mean no prefix
+func NormalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
+}
+
+// WithBasePath serves every route under path (e.g. "/zaim") for reverse
+// proxies that forward the full path. Links and the OAuth callback URL
+// include the prefix
+func WithBasePath(path string) Option {
+	return func(s *Server) {
+		s.basePath = NormalizeBasePath(path)
+	}
+}
+
+// externalPrefix is the path prefix clients see: X-Forwarded-Prefix when a
+// trusted proxy stripped it, otherwise the configured base path
+func (s *Server) externalPrefix(r *http.Request) string {
+	if prefix := r.Header.Get(forwardedPrefixHeader); prefix != "" && s.trustsForwarding(r) {
+		return NormalizeBasePath(prefix)
+	}
+	return s.basePath
+}
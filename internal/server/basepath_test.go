@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"go.uber.org/zap"
+)
+
+func TestNormalizeBasePath(t *testing.T) {
+	for input, want := range map[string]string{
+		"":       "",
+		"/":      "",
+		"zaim":   "/zaim",
+		"/zaim/": "/zaim",
+		"/a/b":   "/a/b",
+	} {
+		assert.Equal(t, want, NormalizeBasePath(input), input)
+	}
+}
+
+func TestServer_BasePath(t *testing.T) {
+	oauthServer := newMockZaimRequestTokenServer(t)
+	srv := newTestServer(t, prometheus.NewRegistry(), WithBasePath("/zaim/"))
+	srv.authManager = newTestAuthManagerWithEndpoint(t, oauthServer.URL)
+	srv.setupRoutes()
+
+	t.Run("ルートはプレフィックス配下に登録される", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/zaim/health", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("トップページのリンクにプレフィックスが付く", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/zaim/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `href="/zaim/zaim/auth/start"`)
+
+		// 末尾スラッシュなしはリダイレクト
+		rec = httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/zaim", nil))
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, "/zaim/", rec.Header().Get("Location"))
+	})
+
+	t.Run("コールバック URL にプレフィックスが付く", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/zaim/zaim/auth/start", nil)
+		req.Host = "home.example.com"
+		req.Header.Set("X-Forwarded-Proto", "https")
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		require.Equal(t, http.StatusFound, rec.Code)
+		assert.Equal(t, "https://home.example.com/zaim/zaim/auth/callback", <-oauthServer.callbacks)
+	})
+}
+
+func TestServer_ForwardedPrefix(t *testing.T) {
+	// プロキシがプレフィックスを除去して転送する構成
+	oauthServer := newMockZaimRequestTokenServer(t)
+	srv := newTestServer(t, prometheus.NewRegistry())
+	srv.authManager = newTestAuthManagerWithEndpoint(t, oauthServer.URL)
+	srv.setupRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/zaim/auth/start", nil)
+	req.Host = "home.example.com"
+	req.Header.Set("X-Forwarded-Prefix", "/zaim/")
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "http://home.example.com/zaim/zaim/auth/callback", <-oauthServer.callbacks)
+}
+
+// mockRequestTokenServer は受け取った oauth_callback を記録する request token エンドポイント
+type mockRequestTokenServer struct {
+	*httptest.Server
+	callbacks chan string
+}
+
+func newMockZaimRequestTokenServer(t *testing.T) *mockRequestTokenServer {
+	t.Helper()
+
+	m := &mockRequestTokenServer{callbacks: make(chan string, 1)}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.callbacks <- oauthParam(r.Header.Get("Authorization"), "oauth_callback")
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		w.Write([]byte("oauth_token=request-token&oauth_token_secret=request-secret&oauth_callback_confirmed=true"))
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// newTestAuthManagerWithEndpoint は request token の取得先を差し替えた auth.Manager を生成
+func newTestAuthManagerWithEndpoint(t *testing.T, requestTokenURL string) *auth.Manager {
+	t.Helper()
+
+	tokenStorage, err := auth.NewFileTokenStorage(filepath.Join(t.TempDir(), "tokens.json"), "")
+	require.NoError(t, err)
+	return auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop(),
+		auth.WithEndpoint(oauth1.Endpoint{RequestTokenURL: requestTokenURL}))
+}
+
+// oauthParam は Authorization ヘッダーから OAuth パラメータを取り出してデコードする
+func oauthParam(header, name string) string {
+	for _, part := range strings.Split(strings.TrimPrefix(header, "OAuth "), ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || key != name {
+			continue
+		}
+		decoded, err := url.QueryUnescape(strings.Trim(value, `"`))
+		if err != nil {
+			return ""
+		}
+		return decoded
+	}
+	return ""
+}
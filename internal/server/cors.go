@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response (seconds)
+const corsMaxAge = "600"
+
+// WithCORSAllowedOrigins allows browsers on the given origins to read the
+// JSON API endpoints. "*" allows any origin. /metrics and the OAuth redirect
+// endpoints are never exposed cross-origin
+func WithCORSAllowedOrigins(origins ...string) Option {
+	return func(s *Server) {
+		s.corsOrigins = make(map[string]bool, len(origins))
+		for _, origin := range origins {
+			if origin != "" {
+				s.corsOrigins[origin] = true
+			}
+		}
+	}
+}
+
+// handleAPI registers a read-only JSON endpoint with CORS support
+// Preflight OPTIONS requests are only routed when CORS is configured
+func (s *Server) handleAPI(r *mux.Router, path string, h http.HandlerFunc) *mux.Route {
+	methods := []string{http.MethodGet}
+	if len(s.corsOrigins) > 0 {
+		methods = append(methods, http.MethodOptions)
+	}
+	return s.handle(r, path, s.cors(h)).Methods(methods...)
+}
+
+// cors echoes allowed origins and answers preflight requests
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on Origin whether or not it is allowed, so
+		// shared caches must not serve one origin's answer to another
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && (s.corsOrigins[origin] || s.corsOrigins["*"])
+
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions {
+			if !allowed {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer_CORS(t *testing.T) {
+	srv := newTestServer(t, prometheus.NewRegistry(), WithCORSAllowedOrigins("https://ui.example.com"))
+
+	t.Run("許可されたオリジンを返す", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/zaim/auth/status", nil)
+		req.Header.Set("Origin", "https://ui.example.com")
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "https://ui.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+	})
+
+	t.Run("許可されていないオリジンにはヘッダーを付けない", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/zaim/auth/status", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+		// 許可しない応答もキャッシュが他のオリジンに返さないよう Origin で分ける
+		assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+	})
+
+	t.Run("Origin なしでも Vary を付ける", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/zaim/auth/status", nil)
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+	})
+
+	t.Run("プリフライトに応答", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/version", nil)
+		req.Header.Set("Origin", "https://ui.example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "https://ui.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, rec.Header().Get("Access-Control-Allow-Methods"), "GET")
+	})
+
+	t.Run("/metrics は対象外", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Origin", "https://ui.example.com")
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestServer_CORSDisabledByDefault(t *testing.T) {
+	srv := newTestServer(t, prometheus.NewRegistry())
+
+	req := httptest.NewRequest(http.MethodGet, "/version", nil)
+	req.Header.Set("Origin", "https://ui.example.com")
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// WithDebugEndpoints enables GET /debug/fetch. It calls the Zaim API on every
+// request, so keep it off on exporters reachable by untrusted clients
+func WithDebugEndpoints(enabled bool) Option {
+	return func(s *Server) {
+		s.debugEndpoints = enabled
+	}
+}
+
+// debugFetchResult is the JSON body of GET /debug/fetch
+type debugFetchResult struct {
+	Transactions    int       `json:"transactions"`
+	Error           *string   `json:"error"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	FetchedAt       time.Time `json:"fetched_at"`
+}
+
+// handleDebugFetch fetches the current month from Zaim with a fresh client and
+// reports the outcome inline. The collector's cache and metrics are untouched
+func (s *Server) handleDebugFetch(w http.ResponseWriter, r *http.Request) {
+	if s.newFetcher == nil {
+		http.Error(w, "Fetching is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	token, err := s.authManager.GetClient(r.Context())
+	if err != nil {
+		http.Error(w, "Not authenticated", http.StatusServiceUnavailable)
+		return
+	}
+
+	start := time.Now()
+	transactions, err := s.newFetcher(token).GetCurrentMonthTransactions(r.Context())
+	result := debugFetchResult{
+		Transactions:    len(transactions),
+		DurationSeconds: time.Since(start).Seconds(),
+		FetchedAt:       start,
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		message := err.Error()
+		result.Error = &message
+		code = http.StatusBadGateway
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(result)
+}
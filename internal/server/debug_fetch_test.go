@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+func TestServer_DebugFetch(t *testing.T) {
+	fetcher := &stubFetcher{transactions: []zaim.Transaction{{ID: 1}, {ID: 2}, {ID: 3}}}
+	newServer := func(opts ...Option) *Server {
+		tokenStorage, err := auth.NewFileTokenStorage(filepath.Join(t.TempDir(), "tokens.json"), "")
+		require.NoError(t, err)
+		require.NoError(t, tokenStorage.Save(&auth.OAuthTokens{Token: "access-token", TokenSecret: "access-secret"}))
+
+		srv := newTestServer(t, prometheus.NewRegistry(), append(opts, WithFetcherFactory(func(token *oauth1.Token) zaim.TransactionFetcher {
+			return fetcher
+		}))...)
+		srv.authManager = auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop())
+		return srv
+	}
+
+	t.Run("既定では無効", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newServer().Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fetch", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("件数とエラーなしを返す", func(t *testing.T) {
+		srv := newServer(WithDebugEndpoints(true))
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fetch", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		var result map[string]interface{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+		assert.Equal(t, 3.0, result["transactions"])
+		assert.Contains(t, result, "error")
+		assert.Nil(t, result["error"])
+		assert.Contains(t, result, "duration_seconds")
+
+		// 提供中のメトリクスには影響しない
+		assert.False(t, srv.metricsManager.IsRegistered())
+	})
+
+	t.Run("取得失敗はエラーを返す", func(t *testing.T) {
+		fetcher.err = errors.New("boom")
+		defer func() { fetcher.err = nil }()
+
+		rec := httptest.NewRecorder()
+		newServer(WithDebugEndpoints(true)).Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fetch", nil))
+
+		assert.Equal(t, http.StatusBadGateway, rec.Code)
+		var result debugFetchResult
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&result))
+		require.NotNil(t, result.Error)
+		assert.Equal(t, "boom", *result.Error)
+	})
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// httpMetrics instruments the exporter's own HTTP endpoints
+type httpMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+func newHTTPMetrics(registerer prometheus.Registerer) *httpMetrics {
+	m := &httpMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total number of HTTP requests served by the exporter",
+		}, []string{"handler", "code", "method"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests served by the exporter",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"handler", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of HTTP requests currently being served",
+		}),
+	}
+	registerer.MustRegister(m.requests, m.duration, m.inFlight)
+	return m
+}
+
+// instrument wraps h with request count, latency and in-flight metrics
+// labelled with the given handler name; a nil receiver leaves h untouched
+func (m *httpMetrics) instrument(handler string, h http.Handler) http.Handler {
+	if m == nil {
+		return h
+	}
+
+	labels := prometheus.Labels{"handler": handler}
+	return promhttp.InstrumentHandlerInFlight(m.inFlight,
+		promhttp.InstrumentHandlerDuration(m.duration.MustCurryWith(labels),
+			promhttp.InstrumentHandlerCounter(m.requests.MustCurryWith(labels), h)))
+}
+
+// handle registers a route under the base path, instrumented under its
+// unprefixed path. /metrics gets its own handler label, so scrapes never
+// mix with API traffic
+func (s *Server) handle(r *mux.Router, path string, h http.Handler) *mux.Route {
+	return r.Handle(s.basePath+path, s.httpMetrics.instrument(path, h))
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMetrics_CountsRequests(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	srv := newTestServer(t, registry, WithHTTPMetrics(registry))
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	counter := srv.httpMetrics.requests.WithLabelValues("/health", "200", "get")
+	assert.Equal(t, 2.0, testutil.ToFloat64(counter))
+	assert.Equal(t, 0.0, testutil.ToFloat64(srv.httpMetrics.inFlight))
+
+	// 同じレジストリの /metrics から公開される
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `http_requests_total{code="200",handler="/health",method="get"} 2`)
+	assert.Contains(t, rec.Body.String(), "http_request_duration_seconds_bucket")
+}
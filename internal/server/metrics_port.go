@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// WithSeparateMetrics moves /metrics (and the per-user metrics) from Router
+// to MetricsRouter, so scrapes can be served on their own port and firewalled
+// apart from the OAuth and admin endpoints
+func WithSeparateMetrics(enabled bool) Option {
+	return func(s *Server) {
+		s.separateMetrics = enabled
+	}
+}
+
+// MetricsRouter serves /metrics plus /health and the /healthz liveness
+// probe for the scrape port. It is nil unless WithSeparateMetrics is enabled
+func (s *Server) MetricsRouter() http.Handler {
+	return s.metricsHandler
+}
+
+func (s *Server) setupMetricsRouter() {
+	r := mux.NewRouter()
+	s.metricsRoutes(r)
+	s.handleAPI(r, "/health", s.handleHealth)
+	s.handleAPI(r, "/healthz", s.handleLive)
+	s.metricsHandler = s.loggingMiddleware(r)
+}
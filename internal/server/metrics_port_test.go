@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_SeparateMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test gauge"}))
+
+	t.Run("既定では MetricsRouter はない", func(t *testing.T) {
+		assert.Nil(t, newTestServer(t, prometheus.NewRegistry()).MetricsRouter())
+	})
+
+	srv := newTestServer(t, registry, WithSeparateMetrics(true))
+	require.NotNil(t, srv.MetricsRouter())
+
+	mainPort := httptest.NewServer(srv.Router())
+	defer mainPort.Close()
+	metricsPort := httptest.NewServer(srv.MetricsRouter())
+	defer metricsPort.Close()
+
+	// リダイレクトは追わず、各ポートの応答そのものを見る
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	status := func(base, path string) int {
+		t.Helper()
+		resp, err := client.Get(base + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("メトリクスはメトリクス用ポートだけ", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, status(metricsPort.URL, "/metrics"))
+		assert.Equal(t, http.StatusNotFound, status(mainPort.URL, "/metrics"))
+	})
+
+	t.Run("OAuth はメインポートだけ", func(t *testing.T) {
+		assert.NotEqual(t, http.StatusNotFound, status(mainPort.URL, "/zaim/auth/start"))
+		assert.Equal(t, http.StatusNotFound, status(metricsPort.URL, "/zaim/auth/start"))
+		assert.Equal(t, http.StatusNotFound, status(metricsPort.URL, "/"))
+	})
+
+	t.Run("ヘルスチェックは両方", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, status(metricsPort.URL, "/health"))
+		assert.Equal(t, http.StatusOK, status(mainPort.URL, "/health"))
+		assert.Equal(t, http.StatusOK, status(metricsPort.URL, "/healthz"))
+	})
+}
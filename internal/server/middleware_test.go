@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	srv := newTestServerWithLogger(t, prometheus.NewRegistry(), zap.New(core))
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	requestID := rec.Header().Get("X-Request-ID")
+	assert.NotEmpty(t, requestID)
+
+	entries := logs.FilterMessage("http request").All()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, requestID, fields["request_id"])
+	assert.Equal(t, "GET", fields["method"])
+	assert.Equal(t, "/health", fields["path"])
+	assert.Equal(t, int64(http.StatusOK), fields["status"])
+	assert.Contains(t, fields, "duration")
+}
+
+func TestLoggingMiddleware_PropagatesRequestID(t *testing.T) {
+	srv := newTestServer(t, prometheus.NewRegistry())
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Request-ID", "from-proxy")
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	assert.Equal(t, "from-proxy", rec.Header().Get("X-Request-ID"))
+}
+
+func TestLoggingMiddleware_SkipsMetrics(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	srv := newTestServerWithLogger(t, prometheus.NewRegistry(), zap.New(core))
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// スクレイプはログに出さないが、リクエスト ID は付与する
+	assert.NotEmpty(t, rec.Header().Get("X-Request-ID"))
+	assert.Equal(t, 0, logs.FilterMessage("http request").Len())
+}
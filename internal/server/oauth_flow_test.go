@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/metrics"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+// newMockZaimOAuthServer は Zaim の request token / access token エンドポイントを模倣する
+// oauth_callback は callbacks に記録する
+func newMockZaimOAuthServer(t *testing.T, callbacks chan<- string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/request_token", func(w http.ResponseWriter, r *http.Request) {
+		callbacks <- oauthParam(r.Header.Get("Authorization"), "oauth_callback")
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		w.Write([]byte("oauth_token=request-token&oauth_token_secret=request-secret&oauth_callback_confirmed=true"))
+	})
+	mux.HandleFunc("/access_token", func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if oauthParam(header, "oauth_token") != "request-token" || oauthParam(header, "oauth_verifier") != "verifier" {
+			http.Error(w, "invalid request token", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		w.Write([]byte("oauth_token=access-token&oauth_token_secret=access-secret"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestServer_OAuthFlow(t *testing.T) {
+	callbacks := make(chan string, 1)
+	zaimServer := newMockZaimOAuthServer(t, callbacks)
+
+	tokenPath := filepath.Join(t.TempDir(), "tokens.json")
+	tokenStorage, err := auth.NewFileTokenStorage(tokenPath, "")
+	require.NoError(t, err)
+	authManager := auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop(),
+		auth.WithEndpoint(oauth1.Endpoint{
+			RequestTokenURL: zaimServer.URL + "/request_token",
+			AuthorizeURL:    zaimServer.URL + "/authorize",
+			AccessTokenURL:  zaimServer.URL + "/access_token",
+		}))
+
+	requestTokenStore := storage.NewMemoryRequestTokenStore(zap.NewNop())
+	t.Cleanup(func() { requestTokenStore.Close() })
+
+	registry := prometheus.NewRegistry()
+	metricsManager := metrics.NewManager(registry, zap.NewNop())
+	srv := NewServer(authManager, requestTokenStore, metricsManager, registry, zap.NewNop(),
+		WithFetcherFactory(func(token *oauth1.Token) zaim.TransactionFetcher {
+			return &stubFetcher{}
+		}))
+	exporter := httptest.NewServer(srv.Router())
+	t.Cleanup(exporter.Close)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	ctx := context.Background()
+
+	// 認可開始: Zaim の認可画面へリダイレクトされる
+	resp, err := client.Get(exporter.URL + "/zaim/auth/start")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), zaimServer.URL+"/authorize"), location.String())
+	assert.Equal(t, "request-token", location.Query().Get("oauth_token"))
+
+	callbackURL := <-callbacks
+	assert.Equal(t, exporter.URL+"/zaim/auth/callback", callbackURL)
+
+	// request token はコールバックまでストアに保持される
+	secret, err := requestTokenStore.Get(ctx, "request-token")
+	require.NoError(t, err)
+	assert.Equal(t, "request-secret", secret)
+
+	// ユーザーが認可すると Zaim がコールバックへ戻す
+	resp, err = client.Get(callbackURL + "?oauth_token=request-token&oauth_verifier=verifier")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// access token がファイルに保存される
+	persisted, err := auth.NewFileTokenStorage(tokenPath, "")
+	require.NoError(t, err)
+	tokens, err := persisted.Load()
+	require.NoError(t, err)
+	assert.Equal(t, &auth.OAuthTokens{Token: "access-token", TokenSecret: "access-secret"}, tokens)
+
+	// 使用済みの request token は削除され、再送は失敗する
+	_, err = requestTokenStore.Get(ctx, "request-token")
+	assert.Error(t, err)
+
+	resp, err = client.Get(callbackURL + "?oauth_token=request-token&oauth_verifier=verifier")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	assert.True(t, metricsManager.Status().Registered)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies parses proxy addresses as IPs ("10.0.0.5") or CIDRs
+// ("10.0.0.0/8")
+func ParseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", value)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// WithTrustedProxies only honors Forwarded and X-Forwarded-* headers on
+// requests from these addresses (see ParseTrustedProxies), so clients
+// reaching the exporter directly cannot spoof the OAuth callback URL
+// Without it forwarding headers are trusted from any source
+func WithTrustedProxies(proxies []netip.Prefix) Option {
+	return func(s *Server) {
+		s.trustedProxies = proxies
+	}
+}
+
+// trustsForwarding reports whether r's forwarding headers may be used
+func (s *Server) trustsForwarding(r *http.Request) bool {
+	if len(s.trustedProxies) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// externalOrigin returns the scheme and host clients used to reach the
+// exporter. From trusted sources the first element of Forwarded (RFC 7239)
+// wins, then X-Forwarded-Proto / X-Forwarded-Host; X-Forwarded-Port is added
+// when the host carries no port
+func (s *Server) externalOrigin(r *http.Request) (scheme, host string) {
+	scheme = "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host = r.Host
+	if !s.trustsForwarding(r) {
+		return scheme, host
+	}
+
+	forwarded := parseForwarded(r.Header.Get("Forwarded"))
+	proto := forwarded["proto"]
+	if proto == "" {
+		proto = firstHeaderValue(r, "X-Forwarded-Proto")
+	}
+	if proto = strings.ToLower(proto); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	forwardedHost := forwarded["host"]
+	if forwardedHost == "" {
+		forwardedHost = firstHeaderValue(r, "X-Forwarded-Host")
+	}
+	if forwardedHost != "" {
+		host = forwardedHost
+		if port := firstHeaderValue(r, "X-Forwarded-Port"); port != "" && !hasPort(host) && !isDefaultPort(scheme, port) {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+		}
+	}
+
+	return scheme, host
+}
+
+// parseForwarded returns the parameters of the first (client-facing) element
+// of a Forwarded header, e.g. `for=192.0.2.60;proto=https;host="example.com"`
+// Parameter names are lowercased and quoted values unquoted
+func parseForwarded(header string) map[string]string {
+	params := make(map[string]string)
+	if header == "" {
+		return params
+	}
+
+	first, _, _ := strings.Cut(header, ",")
+	for _, pair := range strings.Split(first, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`)
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return params
+}
+
+// firstHeaderValue returns the first entry of a comma-separated header
+// (proxies chained in front of each other append their own)
+func firstHeaderValue(r *http.Request, name string) string {
+	first, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(first)
+}
+
+func hasPort(host string) bool {
+	_, _, err := net.SplitHostPort(host)
+	return err == nil
+}
+
+func isDefaultPort(scheme, port string) bool {
+	return (scheme == "http" && port == "80") || (scheme == "https" && port == "443")
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "::1"})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("::1/128"),
+	}, proxies)
+
+	_, err = ParseTrustedProxies([]string{"proxy.local"})
+	assert.Error(t, err)
+}
+
+func TestServer_CallbackURLBehindProxy(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:    "RFC 7239 Forwarded",
+			headers: map[string]string{"Forwarded": `for=198.51.100.17;proto=https;host="home.example.com", for=10.0.0.2`},
+			want:    "https://home.example.com/zaim/auth/callback",
+		},
+		{
+			name:    "Forwarded は X-Forwarded-* より優先",
+			headers: map[string]string{"Forwarded": "proto=https;host=home.example.com", "X-Forwarded-Host": "other.example.com"},
+			want:    "https://home.example.com/zaim/auth/callback",
+		},
+		{
+			name:    "X-Forwarded-Port をホストに付ける",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "home.example.com", "X-Forwarded-Port": "8443"},
+			want:    "https://home.example.com:8443/zaim/auth/callback",
+		},
+		{
+			name:    "既定ポートは付けない",
+			headers: map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "home.example.com", "X-Forwarded-Port": "443"},
+			want:    "https://home.example.com/zaim/auth/callback",
+		},
+		{
+			name:    "信頼するプロキシからのヘッダーは使う",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "10.1.2.3:54321",
+			headers: map[string]string{"Forwarded": "proto=https;host=home.example.com"},
+			want:    "https://home.example.com/zaim/auth/callback",
+		},
+		{
+			name:    "信頼しない送信元のヘッダーは無視",
+			proxies: []string{"10.0.0.0/8"},
+			remote:  "203.0.113.9:54321",
+			headers: map[string]string{
+				"Forwarded":          "proto=https;host=evil.example.com",
+				"X-Forwarded-Host":   "evil.example.com",
+				"X-Forwarded-Prefix": "/evil",
+			},
+			want: "http://exporter.local:8080/zaim/auth/callback",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, err := ParseTrustedProxies(tt.proxies)
+			require.NoError(t, err)
+
+			oauthServer := newMockZaimRequestTokenServer(t)
+			srv := newTestServer(t, prometheus.NewRegistry(), WithTrustedProxies(proxies))
+			srv.authManager = newTestAuthManagerWithEndpoint(t, oauthServer.URL)
+			srv.setupRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, "/zaim/auth/start", nil)
+			req.Host = "exporter.local:8080"
+			if tt.remote != "" {
+				req.RemoteAddr = tt.remote
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			srv.Router().ServeHTTP(rec, req)
+
+			require.Equal(t, http.StatusFound, rec.Code)
+			assert.Equal(t, tt.want, <-oauthServer.callbacks)
+		})
+	}
+}
@@ -1,30 +1,114 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/netip"
+	"time"
 
+	"github.com/dghubble/oauth1"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/metrics"
 	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
 	"go.uber.org/zap"
 )
 
+// FetcherFactory builds a transaction fetcher from an OAuth access token
+type FetcherFactory func(token *oauth1.Token) zaim.TransactionFetcher
+
 type Server struct {
 	authManager       *auth.Manager
 	requestTokenStore storage.RequestTokenStore
+	metricsManager    *metrics.Manager
+	gatherer          prometheus.Gatherer
+	newFetcher        FetcherFactory
 	logger            *zap.Logger
 	router            *mux.Router
+	handler           http.Handler
+	httpMetrics       *httpMetrics
+	buildInfo         metrics.BuildInfo
+	corsOrigins       map[string]bool // JSON API origins allowed cross-origin
+	basePath          string          // route prefix, e.g. "/zaim" ("" = none)
+	debugEndpoints    bool            // serve GET /debug/fetch
+	uiDisabled        bool            // serve JSON instead of the HTML root page
+	trustedProxies    []netip.Prefix  // sources whose forwarding headers count (nil = any)
+	adminToken        string          // bearer token for token export/import ("" = disabled)
+	separateMetrics   bool            // serve /metrics on MetricsRouter instead of Router
+	metricsHandler    http.Handler    // MetricsRouter (nil unless separateMetrics)
+
+	// accessLogSkipPaths are served without access logs (e.g. frequent scrapes)
+	accessLogSkipPaths map[string]bool
 }
 
-func NewServer(authManager *auth.Manager, requestTokenStore storage.RequestTokenStore, logger *zap.Logger) *Server {
+// Option customizes a Server
+type Option func(*Server)
+
+// WithFetcherFactory enables registering the Zaim collector right after
+// the OAuth callback succeeds, so metrics go live without a restart
+func WithFetcherFactory(factory FetcherFactory) Option {
+	return func(s *Server) {
+		s.newFetcher = factory
+	}
+}
+
+// WithHTTPMetrics instruments the server's own endpoints on registerer
+// Use the same registry that serves /metrics
+func WithHTTPMetrics(registerer prometheus.Registerer) Option {
+	return func(s *Server) {
+		s.httpMetrics = newHTTPMetrics(registerer)
+	}
+}
+
+// WithAccessLogSkipPaths replaces the paths excluded from access logging
+// Defaults to /metrics to avoid log spam from frequent scrapes
+func WithAccessLogSkipPaths(paths ...string) Option {
+	return func(s *Server) {
+		s.accessLogSkipPaths = make(map[string]bool, len(paths))
+		for _, path := range paths {
+			s.accessLogSkipPaths[path] = true
+		}
+	}
+}
+
+// WithUI enables (the default) or disables the HTML root page. When disabled,
+// GET / returns a small JSON status without markup or scripts, for headless
+// deployments
+func WithUI(enabled bool) Option {
+	return func(s *Server) {
+		s.uiDisabled = !enabled
+	}
+}
+
+// WithBuildInfo sets the build reported by GET /version
+func WithBuildInfo(info metrics.BuildInfo) Option {
+	return func(s *Server) {
+		s.buildInfo = info
+	}
+}
+
+// NewServer creates the HTTP server
+// gatherer must be the registry metricsManager registers collectors on,
+// otherwise /metrics will not expose its series
+func NewServer(authManager *auth.Manager, requestTokenStore storage.RequestTokenStore, metricsManager *metrics.Manager, gatherer prometheus.Gatherer, logger *zap.Logger, opts ...Option) *Server {
 	s := &Server{
 		authManager:       authManager,
 		requestTokenStore: requestTokenStore,
+		metricsManager:    metricsManager,
+		gatherer:          gatherer,
 		logger:            logger,
+
+		accessLogSkipPaths: map[string]bool{"/metrics": true},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 
 	s.setupRoutes()
@@ -34,39 +118,153 @@ func NewServer(authManager *auth.Manager, requestTokenStore storage.RequestToken
 func (s *Server) setupRoutes() {
 	r := mux.NewRouter()
 
-	// Prometheus metrics endpoint
-	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	// Metrics move to their own router when served on a separate port
+	if s.separateMetrics {
+		s.setupMetricsRouter()
+	} else {
+		s.metricsRoutes(r)
+	}
 
 	// OAuth endpoints
-	r.HandleFunc("/zaim/auth/status", s.handleAuthStatus).Methods("GET")
-	r.HandleFunc("/zaim/auth/start", s.handleAuthStart).Methods("GET")
-	r.HandleFunc("/zaim/auth/callback", s.handleAuthCallback).Methods("GET")
-	r.HandleFunc("/zaim/auth/reset", s.handleAuthReset).Methods("POST")
+	s.handleAPI(r, "/zaim/auth/status", s.handleAuthStatus)
+	s.handle(r, "/zaim/auth/start", http.HandlerFunc(s.handleAuthStart)).Methods("GET")
+	s.handleAPI(r, "/zaim/auth/url", s.handleAuthURL)
+	s.handle(r, "/zaim/auth/callback", http.HandlerFunc(s.handleAuthCallback)).Methods("GET")
+	s.handle(r, "/zaim/auth/reset", http.HandlerFunc(s.handleAuthReset)).Methods("POST")
+
+	// Token backup/restore, only with an admin token
+	if s.adminToken != "" {
+		s.handle(r, "/zaim/auth/export", s.requireAdmin(s.handleTokenExport)).Methods("GET")
+		s.handle(r, "/zaim/auth/import", s.requireAdmin(s.handleTokenImport)).Methods("POST")
+	}
 
 	// Health check
-	r.HandleFunc("/health", s.handleHealth).Methods("GET")
+	s.handleAPI(r, "/health", s.handleHealth)
+
+	// Kubernetes-style probes: liveness never checks dependencies, so a
+	// Redis outage makes the pod unready instead of restarting it
+	// /healthz is commonly used as a liveness probe, so it answers the same
+	s.handleAPI(r, "/livez", s.handleLive)
+	s.handleAPI(r, "/healthz", s.handleLive)
 
 	// Readiness check
-	r.HandleFunc("/ready", s.handleReady).Methods("GET")
+	s.handleAPI(r, "/ready", s.handleReady)
+	s.handleAPI(r, "/readyz", s.handleReady)
+
+	// Collector status (registration, last fetch, cache size)
+	s.handleAPI(r, "/debug/collector", s.handleCollectorStatus)
+
+	// On-demand Zaim fetch for troubleshooting (opt-in)
+	if s.debugEndpoints {
+		s.handle(r, "/debug/fetch", http.HandlerFunc(s.handleDebugFetch)).Methods("GET")
+	}
+
+	// Build information
+	s.handleAPI(r, "/version", s.handleVersion)
 
 	// Root endpoint
-	r.HandleFunc("/", s.handleRoot).Methods("GET")
+	s.handle(r, "/", http.HandlerFunc(s.handleRoot)).Methods("GET")
+	if s.basePath != "" {
+		r.Handle(s.basePath, http.RedirectHandler(s.basePath+"/", http.StatusMovedPermanently))
+	}
 
 	s.router = r
+	s.handler = s.loggingMiddleware(r)
+}
+
+// metricsRoutes registers the scrape endpoints on r
+func (s *Server) metricsRoutes(r *mux.Router) {
+	// Prometheus metrics endpoint (OpenMetrics is negotiated via the Accept
+	// header, gzip via Accept-Encoding)
+	s.handle(r, "/metrics", promhttp.HandlerFor(s.gatherer, promhttp.HandlerOpts{
+		EnableOpenMetrics:  true,
+		DisableCompression: false,
+	})).Methods("GET")
 }
 
 func (s *Server) Router() http.Handler {
-	return s.router
+	return s.handler
 }
 
+// healthCheckTimeout bounds the dependency checks of /health and /ready
+const healthCheckTimeout = 3 * time.Second
+
+// handleHealth checks the request-token store and token storage
+// Either failing makes the exporter unable to complete OAuth, so it returns 503
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	results, ok := s.checkDependencies(r.Context())
+
+	status := "healthy"
+	code := http.StatusOK
+	if !ok {
+		status = "unhealthy"
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": results,
+	})
+}
+
+// checkDependencies runs the /health checks, returning "ok" or the error per
+// check and whether all of them passed
+func (s *Server) checkDependencies(ctx context.Context) (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]error{
+		"request_token_store": s.requestTokenStore.Ping(ctx),
+		"token_storage":       s.authManager.CheckStorage(),
+	}
+
+	ok := true
+	results := make(map[string]string, len(checks))
+	for name, err := range checks {
+		if err != nil {
+			s.logger.Warn("health check failed", zap.String("check", name), zap.Error(err))
+			results[name] = err.Error()
+			ok = false
+			continue
+		}
+		results[name] = "ok"
+	}
+	return results, ok
+}
+
+// handleLive reports that the process is serving requests. It deliberately
+// checks nothing else, so dependency outages never restart the exporter
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"status": "healthy",
+		"status": "alive",
 	})
 }
 
+func (s *Server) handleCollectorStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.metricsManager.Status())
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.buildInfo)
+}
+
+// handleReady returns 503 while a dependency check fails, before OAuth has
+// completed and during the startup jitter
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if results, ok := s.checkDependencies(r.Context()); !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "not ready",
+			"reason": "dependency check failed",
+			"checks": results,
+		})
+		return
+	}
 	if !s.authManager.IsAuthenticated() {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]string{
@@ -75,6 +273,15 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
+	if s.metricsManager.Status().Warming {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "not ready",
+			"reason": "warming",
+		})
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -83,11 +290,22 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if s.uiDisabled {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"authenticated": s.authManager.IsAuthenticated(),
+			"metrics":       s.externalPrefix(r) + "/metrics",
+		})
+		return
+	}
+
 	tmpl := template.Must(template.New("index").Parse(indexHTML))
 	data := struct {
 		IsAuthenticated bool
+		Prefix          string
 	}{
 		IsAuthenticated: s.authManager.IsAuthenticated(),
+		Prefix:          s.externalPrefix(r),
 	}
 	tmpl.Execute(w, data)
 }
@@ -104,46 +322,64 @@ func (s *Server) handleAuthStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleAuthStart(w http.ResponseWriter, r *http.Request) {
-	// Build callback URL from request
-	scheme := "http"
-	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
-		scheme = "https"
+	authURL, err := s.startAuth(r)
+	if err != nil {
+		http.Error(w, "Failed to start OAuth flow", http.StatusInternalServerError)
+		return
 	}
 
-	host := r.Host
-	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
-		host = forwardedHost
+	// Redirect to Zaim authorization page
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleAuthURL starts the OAuth flow like handleAuthStart but returns the
+// authorization URL as JSON, for clients that open it themselves
+func (s *Server) handleAuthURL(w http.ResponseWriter, r *http.Request) {
+	authURL, err := s.startAuth(r)
+	if err != nil {
+		http.Error(w, "Failed to start OAuth flow", http.StatusInternalServerError)
+		return
 	}
 
-	callbackURL := fmt.Sprintf("%s://%s/zaim/auth/callback", scheme, host)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorization_url": authURL,
+	})
+}
+
+// startAuth obtains a request token, stores it for the callback and returns
+// the Zaim authorization URL
+func (s *Server) startAuth(r *http.Request) (string, error) {
+	// Build callback URL from request
+	scheme, host := s.externalOrigin(r)
+	callbackURL := fmt.Sprintf("%s://%s%s/zaim/auth/callback", scheme, host, s.externalPrefix(r))
 
 	authURL, requestToken, requestSecret, err := s.authManager.GetAuthorizationURL(callbackURL)
 	if err != nil {
-		s.logger.Error("failed to get authorization URL", zap.Error(err))
-		http.Error(w, "Failed to start OAuth flow", http.StatusInternalServerError)
-		return
+		s.auditLog(r, auditAuthStartFailure, "", fmt.Errorf("failed to get authorization URL: %w", err))
+		return "", err
 	}
 
 	// Store request token and secret temporarily
-	ctx := r.Context()
-	if err := s.requestTokenStore.Set(ctx, requestToken, requestSecret); err != nil {
-		s.logger.Error("failed to store request token", zap.Error(err))
-		http.Error(w, "Failed to store request token", http.StatusInternalServerError)
-		return
+	if err := s.requestTokenStore.Set(r.Context(), requestToken, requestSecret); err != nil {
+		s.auditLog(r, auditAuthStartFailure, requestToken, fmt.Errorf("failed to store request token: %w", err))
+		return "", err
 	}
 
-	// Redirect to Zaim authorization page
-	http.Redirect(w, r, authURL, http.StatusFound)
+	s.auditLog(r, auditAuthStart, requestToken, nil)
+	return authURL, nil
 }
 
+// readOnlyTokenMessage answers OAuth callbacks and resets that cannot change
+// an access token injected through the environment
+const readOnlyTokenMessage = "The access token is set through ZAIM_ACCESS_TOKEN / ZAIM_ACCESS_SECRET; change or unset them instead"
+
 func (s *Server) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	oauthToken := r.URL.Query().Get("oauth_token")
 	oauthVerifier := r.URL.Query().Get("oauth_verifier")
 
 	if oauthToken == "" || oauthVerifier == "" {
-		s.logger.Error("missing OAuth parameters",
-			zap.String("token", oauthToken),
-			zap.String("verifier", oauthVerifier))
+		s.auditLog(r, auditCallbackFailure, oauthToken, errors.New("missing OAuth parameters"))
 		http.Error(w, "Missing OAuth parameters", http.StatusBadRequest)
 		return
 	}
@@ -153,36 +389,70 @@ func (s *Server) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	// Retrieve request secret
 	requestSecret, err := s.requestTokenStore.Get(ctx, oauthToken)
 	if err != nil {
-		s.logger.Error("failed to get request secret", zap.Error(err))
+		s.auditLog(r, auditCallbackFailure, oauthToken, fmt.Errorf("failed to get request secret: %w", err))
 		http.Error(w, "Failed to retrieve request token", http.StatusInternalServerError)
 		return
 	}
 
 	// Exchange for access token
 	if err := s.authManager.HandleCallback(ctx, oauthToken, requestSecret, oauthVerifier); err != nil {
-		s.logger.Error("failed to handle OAuth callback", zap.Error(err))
+		s.auditLog(r, auditCallbackFailure, oauthToken, fmt.Errorf("failed to exchange request token: %w", err))
+		if errors.Is(err, auth.ErrReadOnlyTokenStorage) {
+			http.Error(w, readOnlyTokenMessage, http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to complete OAuth flow", http.StatusInternalServerError)
 		return
 	}
 
 	// Clean up request token
 	_ = s.requestTokenStore.Delete(ctx, oauthToken)
+	s.auditLog(r, auditCallbackSuccess, oauthToken, nil)
+
+	// Start collecting with the new token; the tokens are already saved,
+	// so a failure here is logged rather than failing the flow
+	if err := s.registerCollector(ctx); err != nil {
+		s.logger.Error("failed to register collector after OAuth", zap.Error(err))
+	}
 
 	// Success page
 	tmpl := template.Must(template.New("success").Parse(successHTML))
-	tmpl.Execute(w, nil)
+	tmpl.Execute(w, struct{ Prefix string }{Prefix: s.externalPrefix(r)})
+}
+
+// registerCollector builds a Zaim client from the stored access token and
+// (re)registers the metrics collector
+func (s *Server) registerCollector(ctx context.Context) error {
+	if s.newFetcher == nil {
+		return nil
+	}
+
+	token, err := s.authManager.GetClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	return s.metricsManager.RegisterCollector(s.newFetcher(token))
 }
 
 func (s *Server) handleAuthReset(w http.ResponseWriter, r *http.Request) {
 	if err := s.authManager.ResetAuth(); err != nil {
-		s.logger.Error("failed to reset auth", zap.Error(err))
+		s.auditLog(r, auditAuthResetFailure, "", fmt.Errorf("failed to reset auth: %w", err))
+		if errors.Is(err, auth.ErrReadOnlyTokenStorage) {
+			http.Error(w, readOnlyTokenMessage, http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to reset authentication", http.StatusInternalServerError)
 		return
 	}
 
+	// Stop exposing stale Zaim series fetched with the cleared token
+	s.metricsManager.UnregisterCollector()
+	s.auditLog(r, auditAuthReset, "", nil)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"status": "success",
+		"status":  "success",
 		"message": "Authentication reset successfully",
 	})
 }
@@ -206,27 +476,27 @@ const indexHTML = `<!DOCTYPE html>
         <div class="status authenticated">
             ✅ Authenticated with Zaim API
         </div>
-        <p>Metrics are available at <a href="/metrics">/metrics</a></p>
+        <p>Metrics are available at <a href="{{.Prefix}}/metrics">/metrics</a></p>
         <button onclick="resetAuth()">Reset Authentication</button>
     {{else}}
         <div class="status not-authenticated">
             ❌ Not authenticated
         </div>
-        <a href="/zaim/auth/start"><button>Authenticate with Zaim</button></a>
+        <a href="{{.Prefix}}/zaim/auth/start"><button>Authenticate with Zaim</button></a>
     {{end}}
 
     <h2>Available Endpoints</h2>
     <ul>
-        <li><a href="/metrics">/metrics</a> - Prometheus metrics</li>
-        <li><a href="/zaim/auth/status">/zaim/auth/status</a> - Authentication status</li>
-        <li><a href="/health">/health</a> - Health check</li>
-        <li><a href="/ready">/ready</a> - Readiness check</li>
+        <li><a href="{{.Prefix}}/metrics">/metrics</a> - Prometheus metrics</li>
+        <li><a href="{{.Prefix}}/zaim/auth/status">/zaim/auth/status</a> - Authentication status</li>
+        <li><a href="{{.Prefix}}/health">/health</a> - Health check</li>
+        <li><a href="{{.Prefix}}/ready">/ready</a> - Readiness check</li>
     </ul>
 
     <script>
         function resetAuth() {
             if (confirm('Are you sure you want to reset authentication?')) {
-                fetch('/zaim/auth/reset', { method: 'POST' })
+                fetch('{{.Prefix}}/zaim/auth/reset', { method: 'POST' })
                     .then(response => response.json())
                     .then(data => {
                         alert(data.message);
@@ -252,8 +522,8 @@ const successHTML = `<!DOCTYPE html>
     <div class="success">
         <h1>✅ Authentication Successful!</h1>
         <p>You have successfully authenticated with Zaim API.</p>
-        <p>Metrics are now available at <a href="/metrics">/metrics</a></p>
-        <a href="/"><button>Back to Home</button></a>
+        <p>Metrics are now available at <a href="{{.Prefix}}/metrics">/metrics</a></p>
+        <a href="{{.Prefix}}/"><button>Back to Home</button></a>
     </div>
 </body>
-</html>`
\ No newline at end of file
+</html>`
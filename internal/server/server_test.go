@@ -0,0 +1,446 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dghubble/oauth1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/metrics"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+// stubFetcher は固定の取引データを返す zaim.TransactionFetcher
+type stubFetcher struct {
+	transactions []zaim.Transaction
+	err          error
+}
+
+func (f *stubFetcher) GetCurrentMonthTransactions(ctx context.Context) ([]zaim.Transaction, error) {
+	return f.transactions, f.err
+}
+
+// newTestAuthManager は一時ディレクトリのトークンファイルを使う auth.Manager を生成
+func newTestAuthManager(t *testing.T) *auth.Manager {
+	t.Helper()
+
+	tokenStorage, err := auth.NewFileTokenStorage(filepath.Join(t.TempDir(), "tokens.json"), "")
+	require.NoError(t, err)
+	return auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop())
+}
+
+// newTestServer は独立したレジストリを使うテスト用サーバーを生成
+func newTestServer(t *testing.T, registry *prometheus.Registry, opts ...Option) *Server {
+	t.Helper()
+	return newTestServerWithLogger(t, registry, zap.NewNop(), opts...)
+}
+
+func newTestServerWithLogger(t *testing.T, registry *prometheus.Registry, logger *zap.Logger, opts ...Option) *Server {
+	t.Helper()
+
+	return NewServer(
+		newTestAuthManager(t),
+		storage.NewMemoryRequestTokenStore(zap.NewNop()),
+		metrics.NewManager(registry, zap.NewNop()),
+		registry,
+		logger,
+		opts...,
+	)
+}
+
+func TestServer_MetricsOpenMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test gauge"})
+	registry.MustRegister(gauge)
+
+	srv := newTestServer(t, registry)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "application/openmetrics-text")
+	assert.Contains(t, rec.Body.String(), "test_gauge")
+	assert.Contains(t, rec.Body.String(), "# EOF")
+}
+
+func TestServer_MetricsGzip(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge", Help: "test gauge"})
+	registry.MustRegister(gauge)
+
+	// アクセスログと HTTP メトリクスのミドルウェアを通しても圧縮が保たれる
+	srv := newTestServerWithLogger(t, registry, zap.NewNop(), WithHTTPMetrics(registry), WithAccessLogSkipPaths())
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+
+	reader, err := gzip.NewReader(rec.Body)
+	require.NoError(t, err)
+	parser := expfmt.NewTextParser(model.UTF8Validation)
+	families, err := parser.TextToMetricFamilies(reader)
+	require.NoError(t, err)
+	assert.Contains(t, families, "test_gauge")
+}
+
+func TestServer_MetricsFromManagerRegistry(t *testing.T) {
+	// カスタムレジストリに Manager 経由で登録した Collector が /metrics に出ることを確認
+	registry := prometheus.NewRegistry()
+	// 2024 年 1 月の時間帯が集計範囲に入るよう時計を固定
+	aggregator := metrics.NewAggregator(metrics.WithClock(func() time.Time {
+		return time.Date(2024, 1, 15, 12, 0, 0, 0, time.Local)
+	}))
+	srv := NewServer(
+		newTestAuthManager(t),
+		storage.NewMemoryRequestTokenStore(zap.NewNop()),
+		metrics.NewManager(registry, zap.NewNop(), metrics.WithAggregator(aggregator)),
+		registry,
+		zap.NewNop(),
+	)
+	fetcher := &stubFetcher{
+		transactions: []zaim.Transaction{
+			{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1200, Created: "2024-01-15 10:30:00"},
+		},
+	}
+	require.NoError(t, srv.metricsManager.RegisterCollector(fetcher))
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `zaim_payment_amount{currency="JPY",hour="2024-01-15 10:00:00"} 1200`)
+}
+
+func TestServer_AuthResetUnregistersCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	srv := newTestServer(t, registry)
+	require.NoError(t, srv.metricsManager.RegisterCollector(&stubFetcher{}))
+	require.True(t, srv.metricsManager.IsRegistered())
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/zaim/auth/reset", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, srv.metricsManager.IsRegistered())
+
+	// リセット後は Zaim のメトリクスが /metrics から消える
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.NotContains(t, rec.Body.String(), "zaim_")
+}
+
+func TestServer_ReadOnlyTokenStorage(t *testing.T) {
+	zaimServer := newMockZaimOAuthServer(t, make(chan string, 1))
+	authManager := auth.NewManager("consumer-key", "consumer-secret", auth.NewEnvTokenStorage("env-token", "env-secret"), zap.NewNop(),
+		auth.WithEndpoint(oauth1.Endpoint{
+			RequestTokenURL: zaimServer.URL + "/request_token",
+			AuthorizeURL:    zaimServer.URL + "/authorize",
+			AccessTokenURL:  zaimServer.URL + "/access_token",
+		}))
+	requestTokenStore := storage.NewMemoryRequestTokenStore(zap.NewNop())
+	t.Cleanup(func() { requestTokenStore.Close() })
+	registry := prometheus.NewRegistry()
+	srv := NewServer(authManager, requestTokenStore, metrics.NewManager(registry, zap.NewNop()), registry, zap.NewNop())
+	require.NoError(t, srv.metricsManager.RegisterCollector(&stubFetcher{}))
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	t.Run("リセットは失敗を返し、収集を止めない", func(t *testing.T) {
+		rec := serve(http.MethodPost, "/zaim/auth/reset")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), "ZAIM_ACCESS_TOKEN")
+		assert.True(t, srv.metricsManager.IsRegistered())
+		assert.True(t, authManager.IsAuthenticated())
+	})
+
+	t.Run("コールバックは新しいトークンを保存できないと返す", func(t *testing.T) {
+		require.Equal(t, http.StatusFound, serve(http.MethodGet, "/zaim/auth/start").Code)
+		rec := serve(http.MethodGet, "/zaim/auth/callback?oauth_token=request-token&oauth_verifier=verifier")
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.Contains(t, rec.Body.String(), "ZAIM_ACCESS_TOKEN")
+
+		tokens, err := auth.NewEnvTokenStorage("env-token", "env-secret").Load()
+		require.NoError(t, err)
+		client, err := authManager.GetClient(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, tokens.Token, client.Token)
+	})
+}
+
+func TestServer_RegisterCollectorAfterAuth(t *testing.T) {
+	// 未認証で起動 → OAuth コールバックでトークン保存 → Collector が再起動なしで登録される
+	tokenStorage, err := auth.NewFileTokenStorage(filepath.Join(t.TempDir(), "tokens.json"), "")
+	require.NoError(t, err)
+	authManager := auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop())
+
+	var receivedToken *oauth1.Token
+	factory := func(token *oauth1.Token) zaim.TransactionFetcher {
+		receivedToken = token
+		return &stubFetcher{}
+	}
+
+	registry := prometheus.NewRegistry()
+	srv := NewServer(
+		authManager,
+		storage.NewMemoryRequestTokenStore(zap.NewNop()),
+		metrics.NewManager(registry, zap.NewNop()),
+		registry,
+		zap.NewNop(),
+		WithFetcherFactory(factory),
+	)
+	require.False(t, srv.metricsManager.IsRegistered())
+
+	// HandleCallback がアクセストークンを保存した状態を再現
+	require.NoError(t, tokenStorage.Save(&auth.OAuthTokens{Token: "access-token", TokenSecret: "access-secret"}))
+	require.NoError(t, srv.registerCollector(context.Background()))
+
+	assert.True(t, srv.metricsManager.IsRegistered())
+	require.NotNil(t, receivedToken)
+	assert.Equal(t, "access-token", receivedToken.Token)
+	assert.Equal(t, "access-secret", receivedToken.TokenSecret)
+}
+
+func TestServer_RegisterCollectorWithoutToken(t *testing.T) {
+	srv := newTestServer(t, prometheus.NewRegistry(), WithFetcherFactory(func(token *oauth1.Token) zaim.TransactionFetcher {
+		return &stubFetcher{}
+	}))
+
+	assert.ErrorIs(t, srv.registerCollector(context.Background()), auth.ErrTokenNotFound)
+	assert.False(t, srv.metricsManager.IsRegistered())
+}
+
+func TestServer_Version(t *testing.T) {
+	info := metrics.BuildInfo{Version: "v1.2.3", Commit: "abc1234", BuildDate: "2024-01-20T00:00:00Z"}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewBuildInfoCollector(info))
+	srv := newTestServer(t, registry, WithBuildInfo(info))
+
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var got metrics.BuildInfo
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, info, got)
+
+	// ビルド情報のメトリクスも /metrics に出力される
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `zaim_exporter_build_info{commit="abc1234",version="v1.2.3"} 1`)
+}
+
+func TestServer_RootWithoutUI(t *testing.T) {
+	t.Run("既定は HTML", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newTestServer(t, prometheus.NewRegistry()).Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "<html>")
+	})
+
+	t.Run("無効時は JSON のみ", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newTestServer(t, prometheus.NewRegistry(), WithUI(false)).Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		assert.NotContains(t, rec.Body.String(), "<")
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, false, body["authenticated"])
+		assert.Equal(t, "/metrics", body["metrics"])
+	})
+}
+
+// failingStore は Ping が常に失敗する RequestTokenStore（Redis 停止を再現）
+type failingStore struct {
+	storage.RequestTokenStore
+}
+
+func (f *failingStore) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestServer_Health(t *testing.T) {
+	t.Run("依存先が正常なら 200", func(t *testing.T) {
+		srv := newTestServer(t, prometheus.NewRegistry())
+
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var body struct {
+			Status string            `json:"status"`
+			Checks map[string]string `json:"checks"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, "healthy", body.Status)
+		assert.Equal(t, map[string]string{"request_token_store": "ok", "token_storage": "ok"}, body.Checks)
+	})
+
+	t.Run("ストア障害時は 503", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		srv := NewServer(
+			newTestAuthManager(t),
+			&failingStore{RequestTokenStore: storage.NewMemoryRequestTokenStore(zap.NewNop())},
+			metrics.NewManager(registry, zap.NewNop()),
+			registry,
+			zap.NewNop(),
+		)
+
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		var body struct {
+			Status string            `json:"status"`
+			Checks map[string]string `json:"checks"`
+		}
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, "unhealthy", body.Status)
+		assert.Equal(t, "connection refused", body.Checks["request_token_store"])
+		assert.Equal(t, "ok", body.Checks["token_storage"])
+	})
+
+	t.Run("トークンファイルが読めない場合は 503", func(t *testing.T) {
+		tokenFile := filepath.Join(t.TempDir(), "tokens.json")
+		require.NoError(t, os.WriteFile(tokenFile, []byte("not json"), 0600))
+		tokenStorage, err := auth.NewFileTokenStorage(tokenFile, "")
+		require.NoError(t, err)
+
+		registry := prometheus.NewRegistry()
+		srv := NewServer(
+			auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop()),
+			storage.NewMemoryRequestTokenStore(zap.NewNop()),
+			metrics.NewManager(registry, zap.NewNop()),
+			registry,
+			zap.NewNop(),
+		)
+
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
+
+func TestServer_Probes(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	down := NewServer(
+		newTestAuthManager(t),
+		&failingStore{RequestTokenStore: storage.NewMemoryRequestTokenStore(zap.NewNop())},
+		metrics.NewManager(registry, zap.NewNop()),
+		registry,
+		zap.NewNop(),
+	)
+	get := func(srv *Server, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	t.Run("ストア障害でも /livez は 200", func(t *testing.T) {
+		rec := get(down, "/livez")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"alive"}`, rec.Body.String())
+	})
+
+	t.Run("ストア障害時は /readyz と /ready が 503", func(t *testing.T) {
+		for _, path := range []string{"/readyz", "/ready"} {
+			rec := get(down, path)
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code, path)
+			var body struct {
+				Reason string            `json:"reason"`
+				Checks map[string]string `json:"checks"`
+			}
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.Equal(t, "dependency check failed", body.Reason)
+			assert.Equal(t, "connection refused", body.Checks["request_token_store"])
+		}
+	})
+
+	t.Run("/healthz は /livez と同じでストア障害でも 200", func(t *testing.T) {
+		rec := get(down, "/healthz")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"alive"}`, rec.Body.String())
+		assert.Equal(t, http.StatusServiceUnavailable, get(down, "/health").Code)
+	})
+}
+
+func TestServer_DebugCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	srv := newTestServer(t, registry)
+	require.NoError(t, srv.metricsManager.RegisterCollector(&stubFetcher{
+		transactions: []zaim.Transaction{{ID: 1, Mode: "payment", Date: "2024-01-15", Amount: 1200}},
+	}))
+
+	// スクレイプで取得を発生させる
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	rec = httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/collector", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status metrics.CollectorStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	assert.True(t, status.Registered)
+	assert.Equal(t, 1, status.CachedTransactions)
+}
+
+func TestServer_AuthURL(t *testing.T) {
+	oauthServer := newMockZaimRequestTokenServer(t)
+	srv := newTestServer(t, prometheus.NewRegistry())
+	srv.authManager = newTestAuthManagerWithEndpoint(t, oauthServer.URL)
+	srv.setupRoutes()
+
+	req := httptest.NewRequest(http.MethodGet, "/zaim/auth/url", nil)
+	req.Host = "exporter.example.com"
+	rec := httptest.NewRecorder()
+	srv.Router().ServeHTTP(rec, req)
+
+	// リダイレクトせず JSON で返す
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body struct {
+		AuthorizationURL string `json:"authorization_url"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+
+	authURL, err := url.Parse(body.AuthorizationURL)
+	require.NoError(t, err)
+	assert.Equal(t, "https", authURL.Scheme)
+	assert.Equal(t, "auth.zaim.net", authURL.Host)
+	assert.Equal(t, "request-token", authURL.Query().Get("oauth_token"))
+	assert.Equal(t, "http://exporter.example.com/zaim/auth/callback", <-oauthServer.callbacks)
+
+	// コールバックで使うリクエストトークンが保存されている
+	secret, err := srv.requestTokenStore.Get(context.Background(), "request-token")
+	require.NoError(t, err)
+	assert.Equal(t, "request-secret", secret)
+}
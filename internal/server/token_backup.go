@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"go.uber.org/zap"
+)
+
+// maxTokenImportSize bounds POST /zaim/auth/import bodies; token files are a
+// few hundred bytes
+const maxTokenImportSize = 64 << 10
+
+// WithAdminToken enables GET /zaim/auth/export and POST /zaim/auth/import,
+// which require "Authorization: Bearer <token>". Empty leaves them disabled
+func WithAdminToken(token string) Option {
+	return func(s *Server) {
+		s.adminToken = token
+	}
+}
+
+// requireAdmin rejects requests without the admin bearer token
+func (s *Server) requireAdmin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zaim-exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// handleTokenExport streams the stored token file as is for backups; without
+// ENCRYPTION_KEY that is the plaintext access token
+func (s *Server) handleTokenExport(w http.ResponseWriter, r *http.Request) {
+	data, err := s.authManager.ExportTokens()
+	switch {
+	case errors.Is(err, auth.ErrRawTokensUnsupported):
+		http.Error(w, "Token storage does not support export", http.StatusNotImplemented)
+		return
+	case errors.Is(err, auth.ErrTokenNotFound):
+		http.Error(w, "Not authenticated", http.StatusNotFound)
+		return
+	case err != nil:
+		s.logger.Error("failed to export tokens", zap.Error(err))
+		http.Error(w, "Failed to export tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="oauth_tokens.json"`)
+	w.Write(data)
+}
+
+// handleTokenImport stores a token file produced by /zaim/auth/export and
+// starts collecting with it
+func (s *Server) handleTokenImport(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTokenImportSize))
+	if err != nil {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = s.authManager.ImportTokens(data)
+	switch {
+	case errors.Is(err, auth.ErrRawTokensUnsupported):
+		http.Error(w, "Token storage does not support import", http.StatusNotImplemented)
+		return
+	case errors.Is(err, auth.ErrInvalidToken):
+		http.Error(w, "Invalid token file (wrong ENCRYPTION_KEY?)", http.StatusBadRequest)
+		return
+	case err != nil:
+		s.logger.Error("failed to import tokens", zap.Error(err))
+		http.Error(w, "Failed to import tokens", http.StatusInternalServerError)
+		return
+	}
+
+	// The tokens are saved, so a failure here is logged rather than returned
+	if err := s.registerCollector(r.Context()); err != nil {
+		s.logger.Error("failed to register collector after token import", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"message": "Tokens imported successfully",
+	})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dghubble/oauth1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/metrics"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/storage"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/zaim"
+	"go.uber.org/zap"
+)
+
+const testEncryptionKey = "0123456789abcdef0123456789abcdef"
+
+// newBackupServer は暗号化トークンファイルを使うサーバーと、そのファイルのパスを返す
+func newBackupServer(t *testing.T, opts ...Option) (*Server, string) {
+	t.Helper()
+
+	tokenFile := filepath.Join(t.TempDir(), "tokens.json")
+	tokenStorage, err := auth.NewFileTokenStorage(tokenFile, testEncryptionKey)
+	require.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	srv := NewServer(
+		auth.NewManager("consumer-key", "consumer-secret", tokenStorage, zap.NewNop()),
+		storage.NewMemoryRequestTokenStore(zap.NewNop()),
+		metrics.NewManager(registry, zap.NewNop()),
+		registry,
+		zap.NewNop(),
+		append([]Option{WithAdminToken("admin-secret")}, opts...)...,
+	)
+	return srv, tokenFile
+}
+
+func adminRequest(method, path string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	return req
+}
+
+func TestServer_TokenExportImport(t *testing.T) {
+	source, sourceFile := newBackupServer(t)
+	sourceStorage, err := auth.NewFileTokenStorage(sourceFile, testEncryptionKey)
+	require.NoError(t, err)
+	require.NoError(t, sourceStorage.Save(&auth.OAuthTokens{Token: "access-token", TokenSecret: "access-secret"}))
+
+	var blob []byte
+	t.Run("暗号化されたままのトークンファイルを取り出す", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		source.Router().ServeHTTP(rec, adminRequest(http.MethodGet, "/zaim/auth/export", nil))
+
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+		blob = rec.Body.Bytes()
+		assert.NotContains(t, string(blob), "access-token")
+	})
+
+	t.Run("別のインスタンスに取り込むと認証済みになり収集を始める", func(t *testing.T) {
+		var registered *oauth1.Token
+		target, tokenFile := newBackupServer(t, WithFetcherFactory(func(token *oauth1.Token) zaim.TransactionFetcher {
+			registered = token
+			return &stubFetcher{}
+		}))
+		require.False(t, target.authManager.IsAuthenticated())
+
+		rec := httptest.NewRecorder()
+		target.Router().ServeHTTP(rec, adminRequest(http.MethodPost, "/zaim/auth/import", bytes.NewReader(blob)))
+
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		token, err := target.authManager.GetClient(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "access-token", token.Token)
+		require.NotNil(t, registered)
+		assert.Equal(t, "access-secret", registered.TokenSecret)
+
+		// ファイルには受け取ったバイト列がそのまま書かれる
+		written, err := os.ReadFile(tokenFile)
+		require.NoError(t, err)
+		assert.Equal(t, blob, written)
+	})
+
+	t.Run("復号できないデータは 400", func(t *testing.T) {
+		target, tokenFile := newBackupServer(t)
+
+		rec := httptest.NewRecorder()
+		target.Router().ServeHTTP(rec, adminRequest(http.MethodPost, "/zaim/auth/import", bytes.NewReader([]byte(`{"token":"plain"}`))))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoFileExists(t, tokenFile)
+	})
+
+	t.Run("管理トークンがなければ 401", func(t *testing.T) {
+		for _, req := range []*http.Request{
+			httptest.NewRequest(http.MethodGet, "/zaim/auth/export", nil),
+			httptest.NewRequest(http.MethodPost, "/zaim/auth/import", bytes.NewReader(blob)),
+		} {
+			req.Header.Set("Authorization", "Bearer wrong")
+			rec := httptest.NewRecorder()
+			source.Router().ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, req.URL.Path)
+		}
+	})
+
+	t.Run("管理トークン未設定ならエンドポイントはない", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newTestServer(t, prometheus.NewRegistry()).Router().ServeHTTP(rec, adminRequest(http.MethodGet, "/zaim/auth/export", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PaymentTotals is the persisted state of the cumulative payment counter
+type PaymentTotals struct {
+	// Totals is the running payment total per currency
+	Totals map[string]float64 `json:"totals"`
+	// Seen are the transactions already counted (or seeded), by month
+	// (YYYY-MM), so they are never counted twice
+	Seen map[string][]int64 `json:"seen,omitempty"`
+	// Since is the first month (YYYY-MM) payments are counted from
+	Since string `json:"since,omitempty"`
+	// SeenIDs is the flat list written by earlier versions; read only
+	SeenIDs []int64 `json:"seen_ids,omitempty"`
+}
+
+// PaymentTotalsStore persists PaymentTotals across restarts
+type PaymentTotalsStore interface {
+	// Load returns empty totals when nothing has been saved yet
+	Load() (*PaymentTotals, error)
+	Save(*PaymentTotals) error
+}
+
+// FilePaymentTotalsStore keeps PaymentTotals in a JSON file
+type FilePaymentTotalsStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFilePaymentTotalsStore(path string) *FilePaymentTotalsStore {
+	return &FilePaymentTotalsStore{path: path}
+}
+
+func (s *FilePaymentTotalsStore) Load() (*PaymentTotals, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &PaymentTotals{Totals: map[string]float64{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var totals PaymentTotals
+	if err := json.Unmarshal(data, &totals); err != nil {
+		return nil, fmt.Errorf("failed to decode payment totals: %w", err)
+	}
+	if totals.Totals == nil {
+		totals.Totals = map[string]float64{}
+	}
+	return &totals, nil
+}
+
+// Save writes to a temporary file and renames it so a crash never leaves a
+// truncated file behind
+func (s *FilePaymentTotalsStore) Save(totals *PaymentTotals) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(totals)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePaymentTotalsStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "payment_totals.json")
+	store := NewFilePaymentTotalsStore(path)
+
+	// 未保存なら空の状態
+	totals, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, totals.Totals)
+	assert.Empty(t, totals.Seen)
+
+	require.NoError(t, store.Save(&PaymentTotals{
+		Totals: map[string]float64{"JPY": 1200},
+		Seen:   map[string][]int64{"2024-01": {1, 2}},
+		Since:  "2024-01",
+	}))
+
+	totals, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"JPY": 1200}, totals.Totals)
+	assert.Equal(t, map[string][]int64{"2024-01": {1, 2}}, totals.Seen)
+	assert.Equal(t, "2024-01", totals.Since)
+
+	// 一時ファイルは残らない
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestFilePaymentTotalsStore_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payment_totals.json")
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0600))
+
+	_, err := NewFilePaymentTotalsStore(path).Load()
+	assert.Error(t, err)
+}
@@ -2,11 +2,19 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis/go-redis/v9"
+	"github.com/yourusername/zaim-prometheus-exporter/internal/auth"
 	"go.uber.org/zap"
 )
 
@@ -14,38 +22,170 @@ type RequestTokenStore interface {
 	Set(ctx context.Context, token, secret string) error
 	Get(ctx context.Context, token string) (string, error)
 	Delete(ctx context.Context, token string) error
+	// Ping verifies the store is reachable (used by the health check)
+	Ping(ctx context.Context) error
 	Close() error
 }
 
 type RedisRequestTokenStore struct {
-	client *redis.Client
-	ttl    time.Duration
-	logger *zap.Logger
+	client        *redis.Client
+	ttl           time.Duration
+	logger        *zap.Logger
+	encryptionKey []byte // nil stores secrets in plaintext
+	tuning        RedisTuning
+
+	retryAttempts       int
+	retryBackoff        time.Duration
+	healthCheckInterval time.Duration
+	up                  prometheus.Gauge
+	healthy             atomic.Bool // last health check result, for logging transitions
+	stop                chan struct{}
+	done                chan struct{}
+	closeOnce           sync.Once
+}
+
+const (
+	// defaultPingTimeout bounds the connection check at startup
+	defaultPingTimeout = 5 * time.Second
+
+	// DefaultRedisRetryAttempts is how many times an operation is tried
+	// before a connection error is returned
+	DefaultRedisRetryAttempts = 3
+
+	// DefaultRedisRetryBackoff is the delay before the first retry; it doubles per attempt
+	DefaultRedisRetryBackoff = 100 * time.Millisecond
+
+	// DefaultRedisHealthCheckInterval is how often the background check pings Redis
+	DefaultRedisHealthCheckInterval = 30 * time.Second
+)
+
+// RedisTuning overrides connection settings parsed from the Redis URL
+// Zero values keep the go-redis defaults
+type RedisTuning struct {
+	PoolSize    int
+	DialTimeout time.Duration
+	ReadTimeout time.Duration
 }
 
-func NewRedisRequestTokenStore(redisURL string, ttl time.Duration, logger *zap.Logger) (*RedisRequestTokenStore, error) {
+// apply copies the non-zero settings onto opt
+func (t RedisTuning) apply(opt *redis.Options) {
+	if t.PoolSize > 0 {
+		opt.PoolSize = t.PoolSize
+	}
+	if t.DialTimeout > 0 {
+		opt.DialTimeout = t.DialTimeout
+	}
+	if t.ReadTimeout > 0 {
+		opt.ReadTimeout = t.ReadTimeout
+	}
+}
+
+// pingTimeout allows the startup ping at least one dial and one read
+func (t RedisTuning) pingTimeout() time.Duration {
+	if timeout := t.DialTimeout + t.ReadTimeout; timeout > defaultPingTimeout {
+		return timeout
+	}
+	return defaultPingTimeout
+}
+
+// redisOptions parses redisURL and applies tuning
+func redisOptions(redisURL string, tuning RedisTuning) (*redis.Options, error) {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse redis URL: %w", err)
 	}
+	tuning.apply(opt)
+	return opt, nil
+}
+
+// RedisOption configures a RedisRequestTokenStore
+type RedisOption func(*RedisRequestTokenStore)
+
+// WithEncryptionKey encrypts request secrets at rest with the given key
+// (see auth.ParseEncryptionKey). A nil key keeps plaintext storage
+func WithEncryptionKey(key []byte) RedisOption {
+	return func(s *RedisRequestTokenStore) {
+		s.encryptionKey = key
+	}
+}
+
+// WithRedisTuning sets the pool size and timeouts of the Redis client
+func WithRedisTuning(tuning RedisTuning) RedisOption {
+	return func(s *RedisRequestTokenStore) {
+		s.tuning = tuning
+	}
+}
+
+// WithRetry sets how often Set/Get/Delete are attempted on connection errors
+// and the initial backoff between attempts. Non-positive values keep the defaults
+func WithRetry(attempts int, backoff time.Duration) RedisOption {
+	return func(s *RedisRequestTokenStore) {
+		if attempts > 0 {
+			s.retryAttempts = attempts
+		}
+		if backoff > 0 {
+			s.retryBackoff = backoff
+		}
+	}
+}
+
+// WithHealthCheckInterval sets how often Redis is pinged in the background
+// Non-positive values keep the default
+func WithHealthCheckInterval(d time.Duration) RedisOption {
+	return func(s *RedisRequestTokenStore) {
+		if d > 0 {
+			s.healthCheckInterval = d
+		}
+	}
+}
+
+// NewRedisRequestTokenStore starts a background health check; call Close to stop it
+func NewRedisRequestTokenStore(redisURL string, ttl time.Duration, logger *zap.Logger, opts ...RedisOption) (*RedisRequestTokenStore, error) {
+	store := &RedisRequestTokenStore{
+		ttl:                 ttl,
+		logger:              logger,
+		retryAttempts:       DefaultRedisRetryAttempts,
+		retryBackoff:        DefaultRedisRetryBackoff,
+		healthCheckInterval: DefaultRedisHealthCheckInterval,
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "zaim_redis_up",
+			Help: "Whether the last Redis health check succeeded (1) or failed (0)",
+		}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(store)
+	}
+
+	opt, err := redisOptions(redisURL, store.tuning)
+	if err != nil {
+		return nil, err
+	}
 
 	client := redis.NewClient(opt)
 
 	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), store.tuning.pingTimeout())
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	logger.Info("connected to redis", zap.String("addr", opt.Addr))
+	logger.Info("connected to redis",
+		zap.String("addr", opt.Addr),
+		zap.Int("pool_size", opt.PoolSize),
+		zap.Duration("dial_timeout", opt.DialTimeout),
+		zap.Duration("read_timeout", opt.ReadTimeout))
 
-	return &RedisRequestTokenStore{
-		client: client,
-		ttl:    ttl,
-		logger: logger,
-	}, nil
+	store.client = client
+	store.up.Set(1)
+	store.healthy.Store(true)
+
+	go store.healthCheckLoop()
+	return store, nil
 }
 
 func (s *RedisRequestTokenStore) Set(ctx context.Context, token, secret string) error {
@@ -53,7 +193,15 @@ func (s *RedisRequestTokenStore) Set(ctx context.Context, token, secret string)
 
 	s.logger.Debug("storing request token in redis", zap.String("token", token))
 
-	err := s.client.Set(ctx, key, secret, s.ttl).Err()
+	value, err := s.seal(secret)
+	if err != nil {
+		s.logger.Error("failed to encrypt request token", zap.Error(err))
+		return err
+	}
+
+	err = s.retry(ctx, func() error {
+		return s.client.Set(ctx, key, value, s.ttl).Err()
+	})
 	if err != nil {
 		s.logger.Error("failed to store request token", zap.Error(err))
 		return err
@@ -65,7 +213,12 @@ func (s *RedisRequestTokenStore) Set(ctx context.Context, token, secret string)
 func (s *RedisRequestTokenStore) Get(ctx context.Context, token string) (string, error) {
 	key := fmt.Sprintf("zaim:request_token:%s", token)
 
-	secret, err := s.client.Get(ctx, key).Result()
+	var value string
+	err := s.retry(ctx, func() error {
+		var err error
+		value, err = s.client.Get(ctx, key).Result()
+		return err
+	})
 	if err == redis.Nil {
 		s.logger.Debug("request token not found", zap.String("token", token))
 		return "", fmt.Errorf("token not found")
@@ -75,6 +228,12 @@ func (s *RedisRequestTokenStore) Get(ctx context.Context, token string) (string,
 		return "", err
 	}
 
+	secret, err := s.open(value)
+	if err != nil {
+		s.logger.Error("failed to decrypt request token", zap.Error(err))
+		return "", err
+	}
+
 	s.logger.Debug("retrieved request token from redis", zap.String("token", token))
 	return secret, nil
 }
@@ -82,7 +241,9 @@ func (s *RedisRequestTokenStore) Get(ctx context.Context, token string) (string,
 func (s *RedisRequestTokenStore) Delete(ctx context.Context, token string) error {
 	key := fmt.Sprintf("zaim:request_token:%s", token)
 
-	err := s.client.Del(ctx, key).Err()
+	err := s.retry(ctx, func() error {
+		return s.client.Del(ctx, key).Err()
+	})
 	if err != nil {
 		s.logger.Error("failed to delete request token", zap.Error(err))
 		return err
@@ -92,14 +253,141 @@ func (s *RedisRequestTokenStore) Delete(ctx context.Context, token string) error
 	return nil
 }
 
+func (s *RedisRequestTokenStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close stops the health check and closes the client; it is safe to call more than once
 func (s *RedisRequestTokenStore) Close() error {
-	return s.client.Close()
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+		err = s.client.Close()
+	})
+	return err
+}
+
+// Describe implements prometheus.Collector for the zaim_redis_up gauge
+func (s *RedisRequestTokenStore) Describe(ch chan<- *prometheus.Desc) {
+	s.up.Describe(ch)
+}
+
+// Collect implements prometheus.Collector for the zaim_redis_up gauge
+func (s *RedisRequestTokenStore) Collect(ch chan<- prometheus.Metric) {
+	s.up.Collect(ch)
+}
+
+// retry runs op until it succeeds, fails with a non-connection error or the
+// attempts are used up. go-redis redials on the next command, so retrying
+// is enough to recover after a Redis restart
+func (s *RedisRequestTokenStore) retry(ctx context.Context, op func() error) error {
+	backoff := s.retryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = op()
+		if err == nil || !isConnectionError(err) || attempt >= s.retryAttempts {
+			return err
+		}
+
+		s.logger.Warn("redis operation failed, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// isConnectionError reports whether err is a transient network failure
+// redis.Nil (missing key) and context errors are not retried
+func isConnectionError(err error) bool {
+	if errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (s *RedisRequestTokenStore) healthCheckLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.checkHealth()
+		}
+	}
+}
+
+// checkHealth pings Redis, updates zaim_redis_up and logs state changes
+func (s *RedisRequestTokenStore) checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.tuning.pingTimeout())
+	defer cancel()
+
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		if s.healthy.Swap(false) {
+			s.logger.Error("redis is unreachable", zap.Error(err))
+		}
+		s.up.Set(0)
+		return
+	}
+	if !s.healthy.Swap(true) {
+		s.logger.Info("redis connection recovered")
+	}
+	s.up.Set(1)
+}
+
+// seal encrypts the secret when a key is configured; ciphertext is base64-encoded
+func (s *RedisRequestTokenStore) seal(secret string) (string, error) {
+	if s.encryptionKey == nil {
+		return secret, nil
+	}
+
+	ciphertext, err := auth.Encrypt([]byte(secret), s.encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// open reverses seal
+func (s *RedisRequestTokenStore) open(value string) (string, error) {
+	if s.encryptionKey == nil {
+		return value, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode request token: %w", err)
+	}
+	plaintext, err := auth.Decrypt(ciphertext, s.encryptionKey)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
 }
 
 // Memory implementation for development/testing
 type MemoryRequestTokenStore struct {
-	tokens map[string]tokenData
-	logger *zap.Logger
+	mu            sync.RWMutex // guards tokens; handlers run concurrently
+	tokens        map[string]tokenData
+	logger        *zap.Logger
+	ttl           time.Duration
+	sweepInterval time.Duration
+	stop          chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
 }
 
 type tokenData struct {
@@ -107,30 +395,91 @@ type tokenData struct {
 	expiresAt time.Time
 }
 
-func NewMemoryRequestTokenStore(logger *zap.Logger) *MemoryRequestTokenStore {
-	return &MemoryRequestTokenStore{
-		tokens: make(map[string]tokenData),
-		logger: logger,
+const (
+	// DefaultRequestTokenTTL is how long a started OAuth flow may take to
+	// reach the callback
+	DefaultRequestTokenTTL = 10 * time.Minute
+
+	// DefaultSweepInterval is how often expired request tokens are removed
+	DefaultSweepInterval = time.Minute
+)
+
+// MemoryOption configures a MemoryRequestTokenStore
+type MemoryOption func(*MemoryRequestTokenStore)
+
+// WithSweepInterval sets how often abandoned (expired) tokens are removed
+// Non-positive values keep the default
+func WithSweepInterval(d time.Duration) MemoryOption {
+	return func(s *MemoryRequestTokenStore) {
+		if d > 0 {
+			s.sweepInterval = d
+		}
+	}
+}
+
+// WithTokenTTL sets how long request tokens stay valid
+// Non-positive values keep DefaultRequestTokenTTL
+func WithTokenTTL(d time.Duration) MemoryOption {
+	return func(s *MemoryRequestTokenStore) {
+		if d > 0 {
+			s.ttl = d
+		}
 	}
 }
 
+// NewMemoryRequestTokenStore starts a sweeper goroutine; call Close to stop it
+func NewMemoryRequestTokenStore(logger *zap.Logger, opts ...MemoryOption) *MemoryRequestTokenStore {
+	s := &MemoryRequestTokenStore{
+		tokens:        make(map[string]tokenData),
+		logger:        logger,
+		ttl:           DefaultRequestTokenTTL,
+		sweepInterval: DefaultSweepInterval,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+
+	go s.sweepLoop()
+	return s
+}
+
 func (s *MemoryRequestTokenStore) Set(ctx context.Context, token, secret string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
 	s.tokens[token] = tokenData{
 		secret:    secret,
-		expiresAt: time.Now().Add(10 * time.Minute),
+		expiresAt: time.Now().Add(s.ttl),
 	}
+	s.mu.Unlock()
+
 	s.logger.Debug("stored request token in memory", zap.String("token", token))
 	return nil
 }
 
 func (s *MemoryRequestTokenStore) Get(ctx context.Context, token string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.RLock()
 	data, exists := s.tokens[token]
+	s.mu.RUnlock()
 	if !exists {
 		return "", fmt.Errorf("token not found")
 	}
 
 	if time.Now().After(data.expiresAt) {
-		delete(s.tokens, token)
+		s.mu.Lock()
+		// Re-check: the token may have been replaced since the read lock was released
+		if current, ok := s.tokens[token]; ok && time.Now().After(current.expiresAt) {
+			delete(s.tokens, token)
+		}
+		s.mu.Unlock()
 		return "", fmt.Errorf("token expired")
 	}
 
@@ -139,29 +488,146 @@ func (s *MemoryRequestTokenStore) Get(ctx context.Context, token string) (string
 }
 
 func (s *MemoryRequestTokenStore) Delete(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
 	delete(s.tokens, token)
+	s.mu.Unlock()
+
 	s.logger.Debug("deleted request token from memory", zap.String("token", token))
 	return nil
 }
 
+func (s *MemoryRequestTokenStore) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Len returns the number of unexpired request tokens, i.e. OAuth flows
+// started but not completed
+func (s *MemoryRequestTokenStore) Len() int {
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, data := range s.tokens {
+		if !now.After(data.expiresAt) {
+			n++
+		}
+	}
+	return n
+}
+
+var pendingRequestTokensDesc = prometheus.NewDesc(
+	"zaim_pending_request_tokens",
+	"Request tokens of OAuth flows started but not completed",
+	nil, nil,
+)
+
+// Describe implements prometheus.Collector for zaim_pending_request_tokens
+func (s *MemoryRequestTokenStore) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pendingRequestTokensDesc
+}
+
+// Collect implements prometheus.Collector for zaim_pending_request_tokens
+func (s *MemoryRequestTokenStore) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(pendingRequestTokensDesc, prometheus.GaugeValue, float64(s.Len()))
+}
+
+// Close stops the sweeper; it is safe to call more than once
 func (s *MemoryRequestTokenStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
 	return nil
 }
 
+func (s *MemoryRequestTokenStore) sweepLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+// sweep removes expired tokens left behind by abandoned OAuth flows
+func (s *MemoryRequestTokenStore) sweep() {
+	now := time.Now()
+
+	s.mu.Lock()
+	removed := 0
+	for token, data := range s.tokens {
+		if now.After(data.expiresAt) {
+			delete(s.tokens, token)
+			removed++
+		}
+	}
+	s.mu.Unlock()
+
+	if removed > 0 {
+		s.logger.Debug("swept expired request tokens", zap.Int("count", removed))
+	}
+}
+
+// DefaultSessionMaxLifetime caps how long a session lives after it was
+// created, even when every access refreshes its TTL
+const DefaultSessionMaxLifetime = 30 * 24 * time.Hour
+
 // Session store for access tokens
 type SessionStore struct {
 	client *redis.Client
 	ttl    time.Duration
 	logger *zap.Logger
+	now    func() time.Time
+
+	// absolute disables refreshing the TTL on access, so a session expires
+	// ttl after creation however often it is used
+	absolute bool
+	// maxLifetime is the age (from CreatedAt) after which a session is
+	// rejected in either mode (0 = no cap)
+	maxLifetime time.Duration
+}
+
+// SessionOption customizes a SessionStore
+type SessionOption func(*SessionStore)
+
+// WithAbsoluteExpiration expires sessions ttl after creation instead of
+// refreshing the TTL on every access (sliding expiration, the default)
+func WithAbsoluteExpiration(enabled bool) SessionOption {
+	return func(s *SessionStore) {
+		s.absolute = enabled
+	}
+}
+
+// WithSessionMaxLifetime replaces DefaultSessionMaxLifetime, the cap on a
+// session's age that sliding expiration cannot extend. 0 removes the cap;
+// negative values keep the default
+func WithSessionMaxLifetime(d time.Duration) SessionOption {
+	return func(s *SessionStore) {
+		if d >= 0 {
+			s.maxLifetime = d
+		}
+	}
 }
 
 type SessionData struct {
 	AccessToken  string    `json:"access_token"`
 	AccessSecret string    `json:"access_secret"`
-	CreatedAt    time.Time `json:"created_at"`
+	CreatedAt    time.Time `json:"created_at"` // set by CreateSession when zero
 }
 
-func NewSessionStore(redisURL string, ttl time.Duration, logger *zap.Logger) (*SessionStore, error) {
+func NewSessionStore(redisURL string, ttl time.Duration, logger *zap.Logger, opts ...SessionOption) (*SessionStore, error) {
 	opt, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse redis URL: %w", err)
@@ -177,22 +643,32 @@ func NewSessionStore(redisURL string, ttl time.Duration, logger *zap.Logger) (*S
 		return nil, fmt.Errorf("failed to connect to redis: %w", err)
 	}
 
-	return &SessionStore{
-		client: client,
-		ttl:    ttl,
-		logger: logger,
-	}, nil
+	s := &SessionStore{
+		client:      client,
+		ttl:         ttl,
+		logger:      logger,
+		now:         time.Now,
+		maxLifetime: DefaultSessionMaxLifetime,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
 }
 
 func (s *SessionStore) CreateSession(ctx context.Context, sessionID string, data *SessionData) error {
 	key := fmt.Sprintf("zaim:session:%s", sessionID)
 
+	if data.CreatedAt.IsZero() {
+		data.CreatedAt = s.now()
+	}
+
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	err = s.client.Set(ctx, key, jsonData, s.ttl).Err()
+	err = s.client.Set(ctx, key, jsonData, s.expiry(data.CreatedAt)).Err()
 	if err != nil {
 		s.logger.Error("failed to create session", zap.Error(err))
 		return err
@@ -202,6 +678,10 @@ func (s *SessionStore) CreateSession(ctx context.Context, sessionID string, data
 	return nil
 }
 
+// GetSession returns the session, refreshing its TTL under sliding
+// expiration. Sessions older than the maximum lifetime are deleted and
+// rejected; sessions stored before CreatedAt existed start their lifetime
+// on first access
 func (s *SessionStore) GetSession(ctx context.Context, sessionID string) (*SessionData, error) {
 	key := fmt.Sprintf("zaim:session:%s", sessionID)
 
@@ -219,12 +699,43 @@ func (s *SessionStore) GetSession(ctx context.Context, sessionID string) (*Sessi
 		return nil, err
 	}
 
-	// Refresh TTL on access
-	s.client.Expire(ctx, key, s.ttl)
+	if data.CreatedAt.IsZero() {
+		data.CreatedAt = s.now()
+		stamped, err := json.Marshal(&data)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.client.Set(ctx, key, stamped, redis.KeepTTL).Err(); err != nil {
+			s.logger.Warn("failed to stamp legacy session", zap.String("session_id", sessionID), zap.Error(err))
+		}
+	}
+
+	if s.maxLifetime > 0 && s.now().Sub(data.CreatedAt) >= s.maxLifetime {
+		s.client.Del(ctx, key)
+		s.logger.Info("rejected session past its maximum lifetime", zap.String("session_id", sessionID))
+		return nil, fmt.Errorf("session expired")
+	}
+
+	// Refresh TTL on access (sliding expiration), never past the maximum lifetime
+	if !s.absolute {
+		s.client.Expire(ctx, key, s.expiry(data.CreatedAt))
+	}
 
 	return &data, nil
 }
 
+// expiry returns the TTL to set now for a session created at createdAt: the
+// configured TTL, shortened so the key never outlives the maximum lifetime
+func (s *SessionStore) expiry(createdAt time.Time) time.Duration {
+	ttl := s.ttl
+	if s.maxLifetime > 0 {
+		if remaining := s.maxLifetime - s.now().Sub(createdAt); remaining < ttl {
+			ttl = max(remaining, time.Millisecond)
+		}
+	}
+	return ttl
+}
+
 func (s *SessionStore) DeleteSession(ctx context.Context, sessionID string) error {
 	key := fmt.Sprintf("zaim:session:%s", sessionID)
 
@@ -240,4 +751,4 @@ func (s *SessionStore) DeleteSession(ctx context.Context, sessionID string) erro
 
 func (s *SessionStore) Close() error {
 	return s.client.Close()
-}
\ No newline at end of file
+}
@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRedisRequestTokenStore_Encryption(t *testing.T) {
+	mr := miniredis.RunT(t)
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	store, err := NewRedisRequestTokenStore("redis://"+mr.Addr(), 10*time.Minute, zap.NewNop(), WithEncryptionKey(key))
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "request-token", "request-secret"))
+
+	// Redis 上の値は平文のシークレットではない
+	raw, err := mr.Get("zaim:request_token:request-token")
+	require.NoError(t, err)
+	assert.NotEqual(t, "request-secret", raw)
+	assert.NotContains(t, raw, "request-secret")
+
+	secret, err := store.Get(ctx, "request-token")
+	require.NoError(t, err)
+	assert.Equal(t, "request-secret", secret)
+}
+
+func TestRedisRequestTokenStore_Plaintext(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	store, err := NewRedisRequestTokenStore("redis://"+mr.Addr(), 10*time.Minute, zap.NewNop())
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "request-token", "request-secret"))
+
+	// 鍵未設定時は従来どおり平文で保存される
+	raw, err := mr.Get("zaim:request_token:request-token")
+	require.NoError(t, err)
+	assert.Equal(t, "request-secret", raw)
+
+	secret, err := store.Get(ctx, "request-token")
+	require.NoError(t, err)
+	assert.Equal(t, "request-secret", secret)
+}
+
+func TestMemoryRequestTokenStore_ConcurrentAccess(t *testing.T) {
+	store := NewMemoryRequestTokenStore(zap.NewNop(), WithSweepInterval(time.Millisecond))
+	defer store.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			token := fmt.Sprintf("token-%d", i)
+			assert.NoError(t, store.Set(ctx, token, "secret"))
+			secret, err := store.Get(ctx, token)
+			assert.NoError(t, err)
+			assert.Equal(t, "secret", secret)
+			assert.NoError(t, store.Delete(ctx, token))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMemoryRequestTokenStore_SweepsExpiredTokens(t *testing.T) {
+	store := NewMemoryRequestTokenStore(zap.NewNop(), WithSweepInterval(5*time.Millisecond))
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "abandoned", "secret"))
+	require.NoError(t, store.Set(ctx, "active", "secret"))
+
+	// 放棄された OAuth フローのトークンを期限切れにする
+	store.mu.Lock()
+	store.tokens["abandoned"] = tokenData{secret: "secret", expiresAt: time.Now().Add(-time.Second)}
+	store.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		_, exists := store.tokens["abandoned"]
+		return !exists
+	}, time.Second, 5*time.Millisecond)
+
+	secret, err := store.Get(ctx, "active")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret)
+}
+
+func TestMemoryRequestTokenStore_TokenTTL(t *testing.T) {
+	store := NewMemoryRequestTokenStore(zap.NewNop(), WithTokenTTL(time.Millisecond))
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "request-token", "secret"))
+
+	time.Sleep(5 * time.Millisecond)
+	_, err := store.Get(ctx, "request-token")
+	assert.EqualError(t, err, "token expired")
+}
+
+func TestRedisRequestTokenStore_TokenTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	store, err := NewRedisRequestTokenStore("redis://"+mr.Addr(), time.Millisecond, zap.NewNop())
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "request-token", "secret"))
+
+	// miniredis の時計を進めて期限切れにする
+	mr.FastForward(5 * time.Millisecond)
+	_, err = store.Get(ctx, "request-token")
+	assert.Error(t, err)
+}
+
+func TestMemoryRequestTokenStore_PendingRequestTokens(t *testing.T) {
+	store := NewMemoryRequestTokenStore(zap.NewNop())
+	defer store.Close()
+
+	ctx := context.Background()
+	assert.Equal(t, 0.0, testutil.ToFloat64(store))
+
+	require.NoError(t, store.Set(ctx, "a", "secret"))
+	require.NoError(t, store.Set(ctx, "b", "secret"))
+	assert.Equal(t, 2.0, testutil.ToFloat64(store))
+
+	require.NoError(t, store.Delete(ctx, "a"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(store))
+
+	// 期限切れはスイープ前でも数えない
+	store.mu.Lock()
+	store.tokens["b"] = tokenData{secret: "secret", expiresAt: time.Now().Add(-time.Second)}
+	store.mu.Unlock()
+	assert.Equal(t, 0.0, testutil.ToFloat64(store))
+}
+
+func TestMemoryRequestTokenStore_HonorsContext(t *testing.T) {
+	store := NewMemoryRequestTokenStore(zap.NewNop())
+	require.NoError(t, store.Close())
+	require.NoError(t, store.Close(), "Close は複数回呼んでも安全")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, store.Set(ctx, "token", "secret"), context.Canceled)
+	_, err := store.Get(ctx, "token")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, store.Delete(ctx, "token"), context.Canceled)
+}
+
+func TestMemoryRequestTokenStore_ConcurrentSharedTokens(t *testing.T) {
+	// go test -race で検出されるよう、同じキーに対して読み書きを混在させる
+	store := NewMemoryRequestTokenStore(zap.NewNop(), WithSweepInterval(time.Millisecond))
+	defer store.Close()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				token := fmt.Sprintf("token-%d", j%5)
+				switch (i + j) % 3 {
+				case 0:
+					assert.NoError(t, store.Set(ctx, token, "secret"))
+				case 1:
+					store.Get(ctx, token)
+				case 2:
+					assert.NoError(t, store.Delete(ctx, token))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRedisOptions_Tuning(t *testing.T) {
+	t.Run("設定値を反映", func(t *testing.T) {
+		opt, err := redisOptions("redis://localhost:6379/0", RedisTuning{
+			PoolSize:    32,
+			DialTimeout: 2 * time.Second,
+			ReadTimeout: 500 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 32, opt.PoolSize)
+		assert.Equal(t, 2*time.Second, opt.DialTimeout)
+		assert.Equal(t, 500*time.Millisecond, opt.ReadTimeout)
+	})
+
+	t.Run("ゼロ値は go-redis の既定値", func(t *testing.T) {
+		defaults, err := redisOptions("redis://localhost:6379/0", RedisTuning{})
+		require.NoError(t, err)
+		tuned, err := redisOptions("redis://localhost:6379/0", RedisTuning{PoolSize: -1})
+		require.NoError(t, err)
+		assert.Equal(t, defaults.PoolSize, tuned.PoolSize)
+		assert.Equal(t, defaults.DialTimeout, tuned.DialTimeout)
+	})
+
+	t.Run("不正な URL", func(t *testing.T) {
+		_, err := redisOptions("://bad", RedisTuning{})
+		assert.Error(t, err)
+	})
+}
+
+func TestRedisTuning_PingTimeout(t *testing.T) {
+	assert.Equal(t, defaultPingTimeout, RedisTuning{}.pingTimeout())
+	assert.Equal(t, 12*time.Second, RedisTuning{DialTimeout: 10 * time.Second, ReadTimeout: 2 * time.Second}.pingTimeout())
+}
+
+func TestRedisRequestTokenStore_RecoversAfterRestart(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	store, err := NewRedisRequestTokenStore("redis://"+mr.Addr(), 10*time.Minute, zap.NewNop(),
+		WithRetry(5, 20*time.Millisecond),
+		WithHealthCheckInterval(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	require.NoError(t, store.Set(ctx, "before", "secret"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(store))
+
+	// Redis 停止中はヘルスチェックが zaim_redis_up を 0 にする
+	mr.Close()
+	assert.Eventually(t, func() bool { return testutil.ToFloat64(store) == 0 }, time.Second, 5*time.Millisecond)
+
+	// 操作中に Redis が復帰すればリトライで成功する
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		assert.NoError(t, mr.Restart())
+	}()
+	require.NoError(t, store.Set(ctx, "after", "secret"))
+
+	secret, err := store.Get(ctx, "after")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", secret)
+	require.NoError(t, store.Delete(ctx, "after"))
+	assert.Eventually(t, func() bool { return testutil.ToFloat64(store) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestRedisRequestTokenStore_RetryGivesUp(t *testing.T) {
+	mr := miniredis.RunT(t)
+
+	store, err := NewRedisRequestTokenStore("redis://"+mr.Addr(), 10*time.Minute, zap.NewNop(),
+		WithRetry(2, time.Millisecond),
+	)
+	require.NoError(t, err)
+	defer store.Close()
+
+	mr.Close()
+	assert.Error(t, store.Set(context.Background(), "token", "secret"))
+}
+
+func TestIsConnectionError(t *testing.T) {
+	assert.False(t, isConnectionError(redis.Nil))
+	assert.False(t, isConnectionError(context.Canceled))
+	assert.False(t, isConnectionError(errors.New("WRONGTYPE")))
+	assert.True(t, isConnectionError(io.EOF))
+	assert.True(t, isConnectionError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+}
+
+func TestSessionStore_Expiration(t *testing.T) {
+	ctx := context.Background()
+	newStore := func(t *testing.T, mr *miniredis.Miniredis, now *time.Time, opts ...SessionOption) *SessionStore {
+		t.Helper()
+		store, err := NewSessionStore("redis://"+mr.Addr(), time.Hour, zap.NewNop(), opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		store.now = func() time.Time { return *now }
+		return store
+	}
+	session := func() *SessionData {
+		return &SessionData{AccessToken: "access-token", AccessSecret: "access-secret"}
+	}
+
+	t.Run("アクセスし続けても最大寿命を過ぎたら拒否", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+		store := newStore(t, mr, &now, WithSessionMaxLifetime(24*time.Hour))
+		require.NoError(t, store.CreateSession(ctx, "s1", session()))
+
+		// TTL（1 時間）内に 30 分おきにアクセスすれば延長され続ける
+		for elapsed := 30 * time.Minute; elapsed < 24*time.Hour; elapsed += 30 * time.Minute {
+			now = now.Add(30 * time.Minute)
+			mr.FastForward(30 * time.Minute)
+			_, err := store.GetSession(ctx, "s1")
+			require.NoError(t, err, elapsed)
+		}
+		// 延長は最大寿命を超えない
+		assert.LessOrEqual(t, mr.TTL("zaim:session:s1"), 30*time.Minute)
+
+		now = now.Add(30 * time.Minute)
+		_, err := store.GetSession(ctx, "s1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expired")
+		assert.False(t, mr.Exists("zaim:session:s1"), "拒否したセッションは削除される")
+	})
+
+	t.Run("CreatedAt のないセッションは初回アクセスから寿命を数える", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+		store := newStore(t, mr, &now, WithSessionMaxLifetime(24*time.Hour))
+		require.NoError(t, mr.Set("zaim:session:legacy", `{"access_token":"a","access_secret":"b"}`))
+		mr.SetTTL("zaim:session:legacy", time.Hour)
+
+		data, err := store.GetSession(ctx, "legacy")
+		require.NoError(t, err)
+		assert.Equal(t, "a", data.AccessToken)
+		assert.Equal(t, now, data.CreatedAt)
+
+		// 記録した CreatedAt は保存され、最大寿命を過ぎれば拒否される
+		stored, err := mr.Get("zaim:session:legacy")
+		require.NoError(t, err)
+		assert.Contains(t, stored, `"created_at":"2024-01-15T12:00:00Z"`)
+		assert.Positive(t, mr.TTL("zaim:session:legacy"))
+
+		now = now.Add(24 * time.Hour)
+		_, err = store.GetSession(ctx, "legacy")
+		assert.Error(t, err)
+	})
+
+	t.Run("絶対期限ではアクセスしても延長しない", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+		store := newStore(t, mr, &now, WithAbsoluteExpiration(true))
+		require.NoError(t, store.CreateSession(ctx, "s1", session()))
+
+		now = now.Add(40 * time.Minute)
+		mr.FastForward(40 * time.Minute)
+		_, err := store.GetSession(ctx, "s1")
+		require.NoError(t, err)
+
+		now = now.Add(30 * time.Minute)
+		mr.FastForward(30 * time.Minute)
+		_, err = store.GetSession(ctx, "s1")
+		assert.Error(t, err)
+	})
+
+	t.Run("スライド期限ではアクセスで延長", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+		store := newStore(t, mr, &now)
+		require.NoError(t, store.CreateSession(ctx, "s1", session()))
+
+		now = now.Add(40 * time.Minute)
+		mr.FastForward(40 * time.Minute)
+		_, err := store.GetSession(ctx, "s1")
+		require.NoError(t, err)
+
+		now = now.Add(30 * time.Minute)
+		mr.FastForward(30 * time.Minute)
+		data, err := store.GetSession(ctx, "s1")
+		require.NoError(t, err)
+		assert.Equal(t, "access-token", data.AccessToken)
+	})
+}
@@ -0,0 +1,44 @@
+package zaim
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// AccountFetcher は口座 ID → 口座名の対応を取得する
+// TransactionFetcher の実装が任意で実装する（Client は実装、FixtureFetcher は未実装）
+type AccountFetcher interface {
+	GetAccounts(ctx context.Context) (map[int]string, error)
+}
+
+var _ AccountFetcher = (*Client)(nil)
+
+type Account struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Active int    `json:"active"`
+}
+
+type AccountData struct {
+	Accounts []Account `json:"accounts"`
+}
+
+// GetAccounts は /home/account から口座名の対応表を取得する
+func (c *Client) GetAccounts(ctx context.Context) (map[int]string, error) {
+	url := fmt.Sprintf("%s/account?mapping=1", c.baseURL)
+
+	var data AccountData
+	if err := c.getJSON(ctx, url, &data); err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string, len(data.Accounts))
+	for _, account := range data.Accounts {
+		names[account.ID] = account.Name
+	}
+
+	c.logger.Info("fetched accounts", zap.Int("count", len(names)))
+	return names, nil
+}
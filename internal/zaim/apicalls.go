@@ -0,0 +1,14 @@
+package zaim
+
+// APICallReporter は Zaim API に送った HTTP リクエスト数を報告する
+// TransactionFetcher の実装が任意で実装する（Client は実装、FixtureFetcher は未実装）
+type APICallReporter interface {
+	// APICalls はクライアント作成以降に送ったリクエスト数を返す（ページ送りは 1 ページごとに数える）
+	APICalls() uint64
+}
+
+var _ APICallReporter = (*Client)(nil)
+
+func (c *Client) APICalls() uint64 {
+	return c.apiCalls.Load()
+}
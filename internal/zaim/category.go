@@ -0,0 +1,45 @@
+package zaim
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// CategoryFetcher はカテゴリ ID → カテゴリ名の対応を取得する
+// TransactionFetcher の実装が任意で実装する（Client は実装、FixtureFetcher は未実装）
+type CategoryFetcher interface {
+	GetCategories(ctx context.Context) (map[int]string, error)
+}
+
+var _ CategoryFetcher = (*Client)(nil)
+
+type Category struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Mode   string `json:"mode"`
+	Active int    `json:"active"`
+}
+
+type CategoryData struct {
+	Categories []Category `json:"categories"`
+}
+
+// GetCategories は /home/category からカテゴリ名の対応表を取得する
+func (c *Client) GetCategories(ctx context.Context) (map[int]string, error) {
+	url := fmt.Sprintf("%s/category?mapping=1", c.baseURL)
+
+	var data CategoryData
+	if err := c.getJSON(ctx, url, &data); err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string, len(data.Categories))
+	for _, category := range data.Categories {
+		names[category.ID] = category.Name
+	}
+
+	c.logger.Info("fetched categories", zap.Int("count", len(names)))
+	return names, nil
+}
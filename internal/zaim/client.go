@@ -3,8 +3,13 @@ package zaim
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dghubble/oauth1"
@@ -12,7 +17,31 @@ import (
 )
 
 const (
-	baseURL = "https://api.zaim.net/v2/home"
+	// DefaultBaseURL は Zaim API（/v2/home）のベース URL
+	DefaultBaseURL = "https://api.zaim.net/v2/home"
+
+	// DefaultTimeout は Zaim API への HTTP リクエストのタイムアウト既定値
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultMaxResponseSize は 1 レスポンスあたりに読み込む最大バイト数の既定値
+	DefaultMaxResponseSize = 4 << 20
+
+	// pageLimit は 1 ページあたりの取得件数（Zaim API の limit パラメータ）
+	pageLimit = 100
+
+	// maxPages は 1 回の取得で辿るページ数の上限（page を無視して満杯のページを返し続ける API への備え）
+	maxPages = 100
+
+	// DefaultCurrency は currency_code が省略された取引の通貨
+	DefaultCurrency = "JPY"
+)
+
+// データの範囲（ZAIM_DATA_SCOPE）
+const (
+	// ScopeHome は個人の家計簿（/v2/home）
+	ScopeHome = "home"
+	// ScopeGroup は共有グループの家計簿（/v2/group）
+	ScopeGroup = "group"
 )
 
 // TransactionFetcher は取引データ取得の抽象化インターフェース
@@ -23,20 +52,101 @@ type TransactionFetcher interface {
 
 type Client struct {
 	httpClient *http.Client
+	baseURL    string
+	scope      string
+	maxBody    int64 // レスポンスボディの上限（バイト）
+	location   *time.Location
 	logger     *zap.Logger
+	now        func() time.Time
+
+	skewThreshold time.Duration
+	skewMu        sync.Mutex
+	skew          time.Duration // ローカル時刻 − 最後のレスポンスの Date
+	skewMeasured  bool
+	skewWarned    bool // しきい値超過を警告済み
+
+	limiter           *rateLimiter // nil なら制限なし
+	rateLimitFailFast bool
+
+	apiCalls atomic.Uint64 // 送った HTTP リクエスト数
 }
 
 // Client が TransactionFetcher を実装していることをコンパイル時に保証
 var _ TransactionFetcher = (*Client)(nil)
 
-func NewClient(config *oauth1.Config, token *oauth1.Token, logger *zap.Logger) *Client {
+// ClientOption は Client の設定を変更する
+type ClientOption func(*Client)
+
+// WithTimeout は HTTP リクエストのタイムアウトを設定する（0 以下は無視して既定値を使う）
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.httpClient.Timeout = timeout
+		}
+	}
+}
+
+// WithBaseURL は API のベース URL を差し替える（モックサーバーやミラー向け、空文字列は無視）
+func WithBaseURL(url string) ClientOption {
+	return func(c *Client) {
+		if url != "" {
+			c.baseURL = strings.TrimSuffix(url, "/")
+		}
+	}
+}
+
+// WithMaxResponseSize はレスポンスボディの上限（バイト）を設定する（0 以下は無視して既定値を使う）
+// 巨大な・壊れたレスポンスでメモリを使い果たさないための制限
+func WithMaxResponseSize(bytes int64) ClientOption {
+	return func(c *Client) {
+		if bytes > 0 {
+			c.maxBody = bytes
+		}
+	}
+}
+
+// WithDataScope は取得対象を個人（ScopeHome）か共有グループ（ScopeGroup）かで切り替える
+// ベース URL 末尾の /home を /group に置き換える
+func WithDataScope(scope string) ClientOption {
+	return func(c *Client) {
+		c.scope = scope
+	}
+}
+
+// ParseDataScope はデータ範囲の設定値を検証する（空文字列は ScopeHome）
+func ParseDataScope(value string) (string, error) {
+	switch value {
+	case "", ScopeHome:
+		return ScopeHome, nil
+	case ScopeGroup:
+		return ScopeGroup, nil
+	}
+	return "", fmt.Errorf("unknown data scope %q (valid: %s, %s)", value, ScopeHome, ScopeGroup)
+}
+
+func NewClient(config *oauth1.Config, token *oauth1.Token, logger *zap.Logger, opts ...ClientOption) *Client {
 	httpClient := config.Client(context.Background(), token)
-	httpClient.Timeout = 30 * time.Second
+	httpClient.Timeout = DefaultTimeout
 
-	return &Client{
+	c := &Client{
 		httpClient: httpClient,
+		baseURL:    DefaultBaseURL,
+		scope:      ScopeHome,
+		maxBody:    DefaultMaxResponseSize,
+		location:   LoadLocation(logger),
 		logger:     logger,
+		now:        time.Now,
+
+		skewThreshold: DefaultClockSkewThreshold,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	// オプションの順序に依らないよう、ベース URL 確定後に範囲を反映する
+	if c.scope == ScopeGroup {
+		c.baseURL = strings.TrimSuffix(c.baseURL, "/"+ScopeHome) + "/" + ScopeGroup
+	}
+	return c
 }
 
 type MoneyData struct {
@@ -45,64 +155,161 @@ type MoneyData struct {
 
 type Transaction struct {
 	ID            int64  `json:"id"`
-	Mode          string `json:"mode"`          // "payment", "income", "transfer"
+	Mode          string `json:"mode"` // "payment", "income", "transfer"
 	UserID        int    `json:"user_id"`
-	Date          string `json:"date"`          // "2024-01-15"
+	Date          string `json:"date"` // "2024-01-15"
 	FromAccountID int    `json:"from_account_id"`
 	ToAccountID   int    `json:"to_account_id,omitempty"`
-	Amount        int    `json:"amount"`
+	CategoryID    int    `json:"category_id"`
+	GenreID       int    `json:"genre_id"`
+	Amount        int    `json:"amount"`        // 整数に丸めた金額（JPY では AmountFloat と同じ）
+	Currency      string `json:"currency_code"` // "JPY", "USD", ...
 	Comment       string `json:"comment"`
 	Name          string `json:"name"`
 	Place         string `json:"place"`
-	Created       string `json:"created"`       // "2024-01-15 10:30:45"
-	Updated       string `json:"updated"`       // "2024-01-15 10:30:45"
+	Created       string `json:"created"`    // "2024-01-15 10:30:45"
+	Updated       string `json:"updated"`    // "2024-01-15 10:30:45"
+	ReceiptID     int64  `json:"receipt_id"` // 添付したレシートの ID（なければ 0）
+
+	// AmountFloat は端数を含む金額（外貨では 10.50 のような値が返る）
+	// 端数がある場合だけ設定され、整数の金額では 0。集計には AmountValue を使う
+	AmountFloat float64 `json:"-"`
 }
 
-func (c *Client) GetTransactions(ctx context.Context, startDate, endDate time.Time) ([]Transaction, error) {
-	url := fmt.Sprintf("%s/money?mapping=1&start_date=%s&end_date=%s&limit=100",
-		baseURL,
-		startDate.Format("2006-01-02"),
-		endDate.Format("2006-01-02"))
+// UnmarshalJSON は amount を四捨五入して Amount に入れ、端数があれば
+// AmountFloat にも残す（int へ直接読み込むと端数付きの金額でエラーになる）
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	type plain Transaction
+	aux := struct {
+		*plain
+		Amount json.Number `json:"amount"`
+	}{plain: (*plain)(t)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
 
+	t.Amount, t.AmountFloat = 0, 0
+	if aux.Amount != "" {
+		amount, err := aux.Amount.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid amount %q: %w", aux.Amount, err)
+		}
+		t.Amount = int(math.Round(amount))
+		if amount != math.Trunc(amount) {
+			t.AmountFloat = amount
+		}
+	}
+	return nil
+}
+
+// AmountValue は集計に使う金額を返す（端数がなければ Amount）
+func (t Transaction) AmountValue() float64 {
+	if t.AmountFloat != 0 {
+		return t.AmountFloat
+	}
+	return float64(t.Amount)
+}
+
+// CurrencyCode は取引の通貨コードを返す（未設定なら JPY）
+func (t Transaction) CurrencyCode() string {
+	if t.Currency == "" {
+		return DefaultCurrency
+	}
+	return t.Currency
+}
+
+func (c *Client) GetTransactions(ctx context.Context, startDate, endDate time.Time) ([]Transaction, error) {
 	c.logger.Info("fetching transactions from Zaim API",
 		zap.String("start_date", startDate.Format("2006-01-02")),
 		zap.String("end_date", endDate.Format("2006-01-02")))
 
+	// limit 件未満のページが返るまで順に取得する
+	var transactions []Transaction
+	for page := 1; ; page++ {
+		if page > maxPages {
+			return nil, fmt.Errorf("%w: stopped after %d pages of %d", ErrTooManyPages, maxPages, pageLimit)
+		}
+		url := fmt.Sprintf("%s/money?mapping=1&start_date=%s&end_date=%s&limit=%d&page=%d",
+			c.baseURL,
+			startDate.Format("2006-01-02"),
+			endDate.Format("2006-01-02"),
+			pageLimit,
+			page)
+
+		var data MoneyData
+		if err := c.getJSON(ctx, url, &data); err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, data.Money...)
+
+		if len(data.Money) < pageLimit {
+			break
+		}
+	}
+
+	// ページング中に取引が追加されるとページ境界で同じ行が重複して返ることがある
+	transactions = dedupTransactions(transactions)
+
+	c.logger.Info("successfully fetched transactions",
+		zap.Int("count", len(transactions)))
+
+	return transactions, nil
+}
+
+// dedupTransactions は ID が重複する取引を除去する
+// 並び順は最初に現れた位置を保ち、内容は最後に取得した行を採用する
+func dedupTransactions(transactions []Transaction) []Transaction {
+	index := make(map[int64]int, len(transactions))
+	result := make([]Transaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if i, ok := index[tx.ID]; ok {
+			result[i] = tx
+			continue
+		}
+		index[tx.ID] = len(result)
+		result = append(result, tx)
+	}
+	return result
+}
+
+func (c *Client) GetCurrentMonthTransactions(ctx context.Context) ([]Transaction, error) {
+	startDate, endDate := MonthWindow.Range(time.Now().In(c.location))
+	return c.GetTransactions(ctx, startDate, endDate)
+}
+
+// getJSON は Zaim API に GET リクエストを送り、レスポンスを v にデコードする
+func (c *Client) getJSON(ctx context.Context, url string, v interface{}) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx, c.rateLimitFailFast); err != nil {
+			return err
+		}
 	}
 
+	c.apiCalls.Add(1)
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch data: %w", err)
+		return fmt.Errorf("failed to fetch data: %w", err)
 	}
 	defer resp.Body.Close()
+	c.recordClockSkew(resp)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return &StatusError{StatusCode: resp.StatusCode}
 	}
 
-	var data MoneyData
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	// 上限を超えて読もうとすると *http.MaxBytesError になる
+	body := http.MaxBytesReader(nil, resp.Body, c.maxBody)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("%w: %w (limit %d bytes)", ErrDecode, ErrResponseTooLarge, tooLarge.Limit)
+		}
+		return fmt.Errorf("%w: %w", ErrDecode, err)
 	}
-
-	c.logger.Info("successfully fetched transactions",
-		zap.Int("count", len(data.Money)))
-
-	return data.Money, nil
+	return nil
 }
-
-func (c *Client) GetCurrentMonthTransactions(ctx context.Context) ([]Transaction, error) {
-	now := time.Now()
-	location, _ := time.LoadLocation("Asia/Tokyo")
-	nowJST := now.In(location)
-
-	// Get first and last day of current month
-	year, month, _ := nowJST.Date()
-	startDate := time.Date(year, month, 1, 0, 0, 0, 0, location)
-	endDate := startDate.AddDate(0, 1, -1)
-
-	return c.GetTransactions(ctx, startDate, endDate)
-}
\ No newline at end of file
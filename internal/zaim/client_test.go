@@ -0,0 +1,395 @@
+package zaim
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dghubble/oauth1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newTestClient は httptest サーバーを向いた Client を生成
+func newTestClient(t *testing.T, server *httptest.Server, opts ...ClientOption) *Client {
+	t.Helper()
+
+	config := &oauth1.Config{ConsumerKey: "consumer-key", ConsumerSecret: "consumer-secret"}
+	opts = append([]ClientOption{WithBaseURL(server.URL)}, opts...)
+	return NewClient(config, oauth1.NewToken("token", "secret"), zap.NewNop(), opts...)
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// クライアントが諦めるまで応答しない遅いサーバー
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server, WithTimeout(time.Millisecond))
+
+	start := time.Now()
+	_, err := client.GetTransactions(context.Background(), time.Now(), time.Now())
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second, "タイムアウトで即座に戻る")
+
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr))
+	assert.True(t, netErr.Timeout())
+}
+
+func TestClient_DefaultTimeout(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	// 0 以下の値は無視して既定値を使う
+	client := newTestClient(t, server, WithTimeout(0))
+	assert.Equal(t, DefaultTimeout, client.httpClient.Timeout)
+}
+
+func TestClient_GetGenres(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/genre", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"genres":[{"id":10101,"name":"食料品","category_id":101,"mode":"payment","active":1},{"id":10102,"name":"外食","category_id":101,"mode":"payment","active":1}]}`))
+	}))
+	defer server.Close()
+
+	genres, err := newTestClient(t, server).GetGenres(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{10101: "食料品", 10102: "外食"}, genres)
+}
+
+func TestClient_GetCategories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/category", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"categories":[{"id":101,"name":"食費","mode":"payment","active":1},{"id":11,"name":"給与所得","mode":"income","active":1}]}`))
+	}))
+	defer server.Close()
+
+	categories, err := newTestClient(t, server).GetCategories(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{101: "食費", 11: "給与所得"}, categories)
+}
+
+func TestClient_GetAccounts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/account", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"accounts":[{"id":1,"name":"お財布","active":1},{"id":2,"name":"クレジットカード","active":1}]}`))
+	}))
+	defer server.Close()
+
+	accounts, err := newTestClient(t, server).GetAccounts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{1: "お財布", 2: "クレジットカード"}, accounts)
+}
+
+func TestClient_GetTransactionsDeduplicatesAcrossPages(t *testing.T) {
+	// 1 ページ目は満杯（limit 件）、2 ページ目は境界の取引（ID 100）を再度含む
+	page1 := make([]Transaction, 0, pageLimit)
+	for i := 1; i <= pageLimit; i++ {
+		page1 = append(page1, Transaction{ID: int64(i), Mode: "payment", Amount: 10})
+	}
+	page2 := []Transaction{
+		{ID: int64(pageLimit), Mode: "payment", Amount: 10},
+		{ID: int64(pageLimit + 1), Mode: "payment", Amount: 10},
+	}
+
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/money", r.URL.Path)
+		page := r.URL.Query().Get("page")
+		pages = append(pages, page)
+
+		data := MoneyData{}
+		switch page {
+		case "1":
+			data.Money = page1
+		case "2":
+			data.Money = page2
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := newTestClient(t, server)
+	transactions, err := client.GetTransactions(context.Background(), start, start.AddDate(0, 1, -1))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, pages)
+	assert.Equal(t, uint64(2), client.APICalls(), "ページごとに 1 リクエストと数える")
+
+	seen := make(map[int64]bool)
+	total := 0
+	for _, tx := range transactions {
+		assert.False(t, seen[tx.ID], "duplicate transaction ID %d", tx.ID)
+		seen[tx.ID] = true
+		total += tx.Amount
+	}
+	assert.Len(t, transactions, pageLimit+1)
+	assert.Equal(t, (pageLimit+1)*10, total)
+}
+
+func TestClient_GetTransactionsStopsAtMaxPages(t *testing.T) {
+	// page を無視して常に満杯のページを返す API
+	full := make([]Transaction, 0, pageLimit)
+	for i := 1; i <= pageLimit; i++ {
+		full = append(full, Transaction{ID: int64(i), Mode: "payment", Amount: 10})
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MoneyData{Money: full})
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	transactions, err := newTestClient(t, server).GetTransactions(context.Background(), start, start.AddDate(0, 1, -1))
+	require.ErrorIs(t, err, ErrTooManyPages)
+	assert.Nil(t, transactions)
+	assert.Equal(t, maxPages, requests, "上限ページ数で打ち切る")
+}
+
+func TestDedupTransactions_KeepsLastSeen(t *testing.T) {
+	transactions := dedupTransactions([]Transaction{
+		{ID: 1, Amount: 100},
+		{ID: 2, Amount: 200},
+		{ID: 1, Amount: 150}, // 後から取得した行（更新後）を採用
+	})
+
+	assert.Equal(t, []Transaction{{ID: 1, Amount: 150}, {ID: 2, Amount: 200}}, transactions)
+}
+
+func TestClient_GetTransactionsParsesMoney(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/money", r.URL.Path)
+		assert.Equal(t, "2024-01-01", r.URL.Query().Get("start_date"))
+		assert.Equal(t, "2024-01-31", r.URL.Query().Get("end_date"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"money":[
+			{"id":101,"mode":"payment","date":"2024-01-15","category_id":101,"genre_id":10101,"amount":1200,"name":"ランチ","created":"2024-01-15 12:10:00"},
+			{"id":102,"mode":"income","date":"2024-01-25","amount":300000,"currency_code":"JPY","created":"2024-01-25 09:00:00"}
+		]}`))
+	}))
+	defer server.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	transactions, err := newTestClient(t, server).GetTransactions(context.Background(), start, start.AddDate(0, 1, -1))
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+
+	assert.Equal(t, Transaction{
+		ID: 101, Mode: "payment", Date: "2024-01-15", CategoryID: 101, GenreID: 10101,
+		Amount: 1200, Name: "ランチ", Created: "2024-01-15 12:10:00",
+	}, transactions[0])
+	assert.Equal(t, "income", transactions[1].Mode)
+	assert.Equal(t, 300000, transactions[1].Amount)
+}
+
+func TestTransaction_UnmarshalFractionalAmount(t *testing.T) {
+	var transactions []Transaction
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"id":1,"amount":10.50,"currency_code":"USD"},
+		{"id":2,"amount":1200},
+		{"id":3}
+	]`), &transactions))
+	require.Len(t, transactions, 3)
+
+	// 端数付きの金額は AmountFloat に残り、Amount は四捨五入した値
+	assert.Equal(t, 10.5, transactions[0].AmountFloat)
+	assert.Equal(t, 11, transactions[0].Amount)
+	assert.Equal(t, 10.5, transactions[0].AmountValue())
+	assert.Equal(t, "USD", transactions[0].Currency)
+
+	// 整数の金額は従来どおり
+	assert.Equal(t, 1200, transactions[1].Amount)
+	assert.Equal(t, 0.0, transactions[1].AmountFloat)
+	assert.Equal(t, 1200.0, transactions[1].AmountValue())
+
+	assert.Equal(t, 0.0, transactions[2].AmountValue())
+
+	var invalid Transaction
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":"abc"}`), &invalid))
+}
+
+func TestWithBaseURL(t *testing.T) {
+	config := &oauth1.Config{}
+	token := oauth1.NewToken("token", "secret")
+
+	assert.Equal(t, DefaultBaseURL, NewClient(config, token, zap.NewNop()).baseURL)
+	assert.Equal(t, DefaultBaseURL, NewClient(config, token, zap.NewNop(), WithBaseURL("")).baseURL, "空文字列は既定値")
+	assert.Equal(t, "http://127.0.0.1:9000/v2/home", NewClient(config, token, zap.NewNop(), WithBaseURL("http://127.0.0.1:9000/v2/home/")).baseURL)
+}
+
+func TestWithDataScope(t *testing.T) {
+	config := &oauth1.Config{}
+	token := oauth1.NewToken("token", "secret")
+
+	assert.Equal(t, "https://api.zaim.net/v2/group", NewClient(config, token, zap.NewNop(), WithDataScope(ScopeGroup)).baseURL)
+	assert.Equal(t, DefaultBaseURL, NewClient(config, token, zap.NewNop(), WithDataScope(ScopeHome)).baseURL)
+	// オプションの順序に依らない
+	assert.Equal(t, "http://127.0.0.1:9000/v2/group",
+		NewClient(config, token, zap.NewNop(), WithDataScope(ScopeGroup), WithBaseURL("http://127.0.0.1:9000/v2/home")).baseURL)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/group/money", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"money":[]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(config, token, zap.NewNop(), WithBaseURL(server.URL+"/v2/home"), WithDataScope(ScopeGroup))
+	_, err := client.GetCurrentMonthTransactions(context.Background())
+	require.NoError(t, err)
+}
+
+func TestParseDataScope(t *testing.T) {
+	for value, want := range map[string]string{"": ScopeHome, "home": ScopeHome, "group": ScopeGroup} {
+		scope, err := ParseDataScope(value)
+		require.NoError(t, err)
+		assert.Equal(t, want, scope)
+	}
+
+	_, err := ParseDataScope("family")
+	assert.ErrorContains(t, err, "family")
+}
+
+func TestClient_ClockSkew(t *testing.T) {
+	serverTime := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.Format(http.TimeFormat))
+		w.Write([]byte(`{"money":[]}`))
+	}))
+	defer server.Close()
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	client := newTestClient(t, server)
+	client.logger = zap.New(core)
+	local := serverTime
+	client.now = func() time.Time { return local }
+
+	t.Run("レスポンス前は未計測", func(t *testing.T) {
+		_, ok := client.ClockSkew()
+		assert.False(t, ok)
+	})
+
+	t.Run("しきい値以内なら警告しない", func(t *testing.T) {
+		local = serverTime.Add(-30 * time.Second)
+		_, err := client.GetTransactions(context.Background(), serverTime, serverTime)
+		require.NoError(t, err)
+
+		skew, ok := client.ClockSkew()
+		require.True(t, ok)
+		assert.Equal(t, -30*time.Second, skew)
+		assert.Equal(t, 0, logs.Len())
+	})
+
+	t.Run("ローカル時計が進んでいれば警告は一度だけ", func(t *testing.T) {
+		local = serverTime.Add(10 * time.Minute)
+		for range 2 {
+			_, err := client.GetTransactions(context.Background(), serverTime, serverTime)
+			require.NoError(t, err)
+		}
+
+		skew, _ := client.ClockSkew()
+		assert.Equal(t, 10*time.Minute, skew)
+		assert.Equal(t, 1, logs.Len())
+	})
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"money":[]}`))
+	}))
+	defer server.Close()
+
+	// 時計を止め、待ち時間は実際に待たずに記録する
+	now := time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC)
+	newLimitedClient := func(rps float64, opts ...ClientOption) (*Client, *[]time.Duration) {
+		client := newTestClient(t, server, append([]ClientOption{WithRateLimit(rps, 1)}, opts...)...)
+		client.now = func() time.Time { return now }
+		var delays []time.Duration
+		client.limiter.after = func(d time.Duration) <-chan time.Time {
+			delays = append(delays, d)
+			ch := make(chan time.Time, 1)
+			ch <- now.Add(d)
+			return ch
+		}
+		return client, &delays
+	}
+
+	t.Run("制限なしでは計測しない", func(t *testing.T) {
+		_, _, ok := newTestClient(t, server).RateLimitWaits()
+		assert.False(t, ok)
+	})
+
+	t.Run("厳しい制限では連続した呼び出しが間隔を空けて直列化される", func(t *testing.T) {
+		client, delays := newLimitedClient(20)
+
+		for range 3 {
+			_, err := client.GetTransactions(context.Background(), now, now)
+			require.NoError(t, err)
+		}
+
+		// 1 件目はバーストで通り、以降は 50ms ずつ後ろに予約される
+		assert.Equal(t, []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}, *delays)
+		count, total, ok := client.RateLimitWaits()
+		require.True(t, ok)
+		assert.Equal(t, uint64(3), count)
+		assert.Equal(t, 150*time.Millisecond, total)
+	})
+
+	t.Run("fail-fast では待たずにレート制限エラー", func(t *testing.T) {
+		client, delays := newLimitedClient(0.001, WithRateLimitFailFast(true))
+
+		_, err := client.GetTransactions(context.Background(), now, now)
+		require.NoError(t, err)
+		_, err = client.GetTransactions(context.Background(), now, now)
+		assert.ErrorIs(t, err, ErrRateLimitExceeded)
+		assert.ErrorIs(t, err, ErrRateLimited)
+		assert.Empty(t, *delays)
+	})
+
+	t.Run("待機中のキャンセルで予約を返す", func(t *testing.T) {
+		client, delays := newLimitedClient(20)
+		_, err := client.GetTransactions(context.Background(), now, now)
+		require.NoError(t, err)
+
+		// 待ちが終わらないうちにキャンセルする
+		after := client.limiter.after
+		client.limiter.after = func(d time.Duration) <-chan time.Time {
+			*delays = append(*delays, d)
+			return nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = client.GetTransactions(ctx, now, now)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		count, total, _ := client.RateLimitWaits()
+		assert.Equal(t, uint64(1), count)
+		assert.Zero(t, total)
+
+		// 取り消した予約の分だけ次の待ちは短い
+		client.limiter.after = after
+		_, err = client.GetTransactions(context.Background(), now, now)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond}, *delays)
+	})
+}
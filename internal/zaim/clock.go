@@ -0,0 +1,61 @@
+package zaim
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultClockSkewThreshold はローカル時計のずれを警告する既定のしきい値
+const DefaultClockSkewThreshold = time.Minute
+
+// ClockSkewReporter はローカル時計と Zaim サーバーの時計のずれを報告する
+// TransactionFetcher の実装が任意で実装する（Client は実装、FixtureFetcher は未実装）
+type ClockSkewReporter interface {
+	// ClockSkew はローカル時刻 − サーバー時刻を返す（正ならローカルが進んでいる）
+	// まだレスポンスを受け取っていなければ ok は false
+	ClockSkew() (skew time.Duration, ok bool)
+}
+
+var _ ClockSkewReporter = (*Client)(nil)
+
+// WithClockSkewThreshold は時計のずれを警告ログに出すしきい値を設定する（0 以下は無視して既定値を使う）
+// 「今日」の境界や取得期間は time.Now() で決まるため、ずれると取引が集計から漏れる
+func WithClockSkewThreshold(threshold time.Duration) ClientOption {
+	return func(c *Client) {
+		if threshold > 0 {
+			c.skewThreshold = threshold
+		}
+	}
+}
+
+func (c *Client) ClockSkew() (time.Duration, bool) {
+	c.skewMu.Lock()
+	defer c.skewMu.Unlock()
+	return c.skew, c.skewMeasured
+}
+
+// recordClockSkew は Date ヘッダーからずれを記録する（ヘッダーがなければ何もしない）
+// Date は秒単位なので 1 秒程度の誤差を含む。しきい値を超えた時点で一度だけ警告する
+func (c *Client) recordClockSkew(resp *http.Response) {
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	skew := c.now().Sub(serverTime)
+
+	c.skewMu.Lock()
+	defer c.skewMu.Unlock()
+	c.skew = skew
+	c.skewMeasured = true
+
+	exceeded := skew.Abs() > c.skewThreshold
+	if exceeded && !c.skewWarned {
+		c.logger.Warn("local clock differs from Zaim server clock; today and month boundaries may be wrong",
+			zap.Duration("skew", skew),
+			zap.Time("server_time", serverTime),
+		)
+	}
+	c.skewWarned = exceeded
+}
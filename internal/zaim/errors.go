@@ -0,0 +1,54 @@
+package zaim
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Zaim API のエラー分類。errors.Is で判定する
+var (
+	// ErrUnauthorized はアクセストークンが無効（401）。再認証が必要
+	ErrUnauthorized = errors.New("zaim: unauthorized")
+
+	// ErrRateLimited はレート制限に達した（429）
+	ErrRateLimited = errors.New("zaim: rate limited")
+
+	// ErrServerError は Zaim 側の障害（5xx）
+	ErrServerError = errors.New("zaim: server error")
+
+	// ErrUnexpectedStatus は上記以外の 200 以外のステータス
+	ErrUnexpectedStatus = errors.New("zaim: unexpected status")
+
+	// ErrDecode はレスポンスの JSON を解釈できなかった
+	ErrDecode = errors.New("zaim: failed to decode response")
+
+	// ErrResponseTooLarge はレスポンスが上限サイズを超えた（ErrDecode としても判定される）
+	ErrResponseTooLarge = errors.New("zaim: response too large")
+
+	// ErrTooManyPages はページングが上限ページ数に達しても終わらなかった
+	ErrTooManyPages = errors.New("zaim: too many pages")
+)
+
+// StatusError は 200 以外の HTTP ステータスを表す
+// Unwrap でステータスの分類に応じたセンチネルエラーを返す
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServerError
+	default:
+		return ErrUnexpectedStatus
+	}
+}
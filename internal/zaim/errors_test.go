@@ -0,0 +1,74 @@
+package zaim
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_StatusErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   error
+	}{
+		{"401 は再認証が必要", http.StatusUnauthorized, ErrUnauthorized},
+		{"429 はレート制限", http.StatusTooManyRequests, ErrRateLimited},
+		{"500 はサーバー障害", http.StatusInternalServerError, ErrServerError},
+		{"503 もサーバー障害", http.StatusServiceUnavailable, ErrServerError},
+		{"404 はその他", http.StatusNotFound, ErrUnexpectedStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			_, err := newTestClient(t, server).GetTransactions(context.Background(), time.Now(), time.Now())
+			require.Error(t, err)
+			assert.ErrorIs(t, err, tt.want)
+
+			var statusErr *StatusError
+			require.True(t, errors.As(err, &statusErr))
+			assert.Equal(t, tt.status, statusErr.StatusCode)
+		})
+	}
+}
+
+func TestClient_DecodeError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(t, server).GetTransactions(context.Background(), time.Now(), time.Now())
+	assert.ErrorIs(t, err, ErrDecode)
+	assert.NotErrorIs(t, err, ErrServerError)
+}
+
+func TestClient_ResponseTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"money":[`))
+		for i := 0; i < 100000; i++ {
+			if _, err := w.Write([]byte(`{"id":1,"mode":"payment","amount":100},`)); err != nil {
+				return
+			}
+		}
+		w.Write([]byte(`{"id":1}]}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestClient(t, server, WithMaxResponseSize(1024)).GetTransactions(context.Background(), time.Now(), time.Now())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+	assert.ErrorIs(t, err, ErrDecode)
+	assert.Contains(t, err.Error(), "limit 1024 bytes")
+}
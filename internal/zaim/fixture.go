@@ -0,0 +1,46 @@
+package zaim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go.uber.org/zap"
+)
+
+// FixtureFetcher は JSON ファイルから取引データを読み込む TransactionFetcher
+// Zaim API や OAuth を使わずにダッシュボードを開発・デモするためのもの
+// ファイルは API の /home/money レスポンスと同じ {"money": [...]} 形式
+type FixtureFetcher struct {
+	path   string
+	logger *zap.Logger
+}
+
+var _ TransactionFetcher = (*FixtureFetcher)(nil)
+
+func NewFixtureFetcher(path string, logger *zap.Logger) *FixtureFetcher {
+	return &FixtureFetcher{
+		path:   path,
+		logger: logger,
+	}
+}
+
+// GetCurrentMonthTransactions は呼び出しごとにファイルを読み直す（編集内容が次回の取得で反映される）
+func (f *FixtureFetcher) GetCurrentMonthTransactions(ctx context.Context) ([]Transaction, error) {
+	raw, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture file: %w", err)
+	}
+
+	var data MoneyData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("failed to decode fixture file: %w", err)
+	}
+
+	f.logger.Debug("loaded transactions from fixture",
+		zap.String("path", f.path),
+		zap.Int("count", len(data.Money)))
+
+	return data.Money, nil
+}
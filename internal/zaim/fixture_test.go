@@ -0,0 +1,47 @@
+package zaim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFixtureFetcher(t *testing.T) {
+	fetcher := NewFixtureFetcher(filepath.Join("testdata", "fixture.json"), zap.NewNop())
+
+	transactions, err := fetcher.GetCurrentMonthTransactions(context.Background())
+	require.NoError(t, err)
+	require.Len(t, transactions, 4)
+
+	assert.Equal(t, int64(1001), transactions[0].ID)
+	assert.Equal(t, "payment", transactions[0].Mode)
+	assert.Equal(t, "2024-01-15", transactions[0].Date)
+	assert.Equal(t, 1200, transactions[0].Amount)
+	assert.Equal(t, "2024-01-15 12:10:00", transactions[0].Created)
+
+	assert.Equal(t, "income", transactions[2].Mode)
+	assert.Equal(t, 250000, transactions[2].Amount)
+	assert.Equal(t, 2, transactions[3].ToAccountID)
+}
+
+func TestFixtureFetcher_Errors(t *testing.T) {
+	t.Run("ファイルが存在しない", func(t *testing.T) {
+		fetcher := NewFixtureFetcher(filepath.Join(t.TempDir(), "missing.json"), zap.NewNop())
+		_, err := fetcher.GetCurrentMonthTransactions(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("不正な JSON", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "broken.json")
+		require.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+
+		fetcher := NewFixtureFetcher(path, zap.NewNop())
+		_, err := fetcher.GetCurrentMonthTransactions(context.Background())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,46 @@
+package zaim
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// GenreFetcher はジャンル ID → ジャンル名の対応を取得する
+// TransactionFetcher の実装が任意で実装する（Client は実装、FixtureFetcher は未実装）
+type GenreFetcher interface {
+	GetGenres(ctx context.Context) (map[int]string, error)
+}
+
+var _ GenreFetcher = (*Client)(nil)
+
+type Genre struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	CategoryID int    `json:"category_id"`
+	Mode       string `json:"mode"`
+	Active     int    `json:"active"`
+}
+
+type GenreData struct {
+	Genres []Genre `json:"genres"`
+}
+
+// GetGenres は /home/genre からジャンル名の対応表を取得する
+func (c *Client) GetGenres(ctx context.Context) (map[int]string, error) {
+	url := fmt.Sprintf("%s/genre?mapping=1", c.baseURL)
+
+	var data GenreData
+	if err := c.getJSON(ctx, url, &data); err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string, len(data.Genres))
+	for _, genre := range data.Genres {
+		names[genre.ID] = genre.Name
+	}
+
+	c.logger.Info("fetched genres", zap.Int("count", len(names)))
+	return names, nil
+}
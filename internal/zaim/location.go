@@ -0,0 +1,57 @@
+package zaim
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Timezone は Zaim の日時（date / created / updated）が記録されているタイムゾーン
+const Timezone = "Asia/Tokyo"
+
+// fallbackLocation は tzdata が無い環境向けの固定オフセット JST
+// Asia/Tokyo には夏時間がないため、UTC+9 固定でも日付の境界は変わらない
+var fallbackLocation = time.FixedZone("JST", 9*60*60)
+
+// loadLocation はテストで読み込み失敗を再現するために差し替え可能にしている
+var loadLocation = time.LoadLocation
+
+// LoadLocation は Asia/Tokyo のロケーションを返す
+// scratch / distroless イメージで tzdata が見つからない場合、エラーを無視すると nil (=UTC) で
+// 日付が静かにずれるため、警告を出したうえで固定オフセットの JST にフォールバックする
+func LoadLocation(logger *zap.Logger) *time.Location {
+	location, err := loadLocation(Timezone)
+	if err != nil {
+		logger.Warn("failed to load time zone data, falling back to fixed UTC+09:00",
+			zap.String("timezone", Timezone),
+			zap.Error(err))
+		return fallbackLocation
+	}
+	return location
+}
+
+// timestampLayouts は created / updated として受け付ける書式（先頭が Zaim の現行書式）
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04",
+}
+
+// ParseTimestamp は created / updated の日時を既知の書式で順に解釈する
+// タイムゾーンの無い書式は location の時刻、ある書式は location に変換して返す
+func ParseTimestamp(value string, location *time.Location) (time.Time, error) {
+	var firstErr error
+	for _, layout := range timestampLayouts {
+		t, err := time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return t.In(location), nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return time.Time{}, firstErr
+}
@@ -0,0 +1,67 @@
+package zaim
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoadLocation_FallbackWhenTzdataMissing(t *testing.T) {
+	// tzdata が無い環境を再現
+	original := loadLocation
+	loadLocation = func(name string) (*time.Location, error) {
+		return nil, errors.New("unknown time zone " + name)
+	}
+	t.Cleanup(func() { loadLocation = original })
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	location := LoadLocation(zap.New(core))
+
+	assert.NotNil(t, location)
+	assert.Equal(t, 1, logs.Len(), "フォールバック時は警告を出力する")
+
+	// UTC 15:30 は JST では翌日 00:30 になる（UTC 扱いだと前日に集計されてしまう）
+	utc := time.Date(2024, 1, 15, 15, 30, 0, 0, time.UTC)
+	assert.Equal(t, "2024-01-16 00:30", utc.In(location).Format("2006-01-02 15:04"))
+
+	parsed, err := time.ParseInLocation("2006-01-02 15:04:05", "2024-01-16 00:30:00", location)
+	assert.NoError(t, err)
+	assert.True(t, parsed.Equal(utc))
+}
+
+func TestLoadLocation_Success(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	location := LoadLocation(zap.New(core))
+
+	assert.Equal(t, Timezone, location.String())
+	assert.Equal(t, 0, logs.Len())
+}
+
+func TestParseTimestamp(t *testing.T) {
+	location := time.FixedZone("JST", 9*60*60)
+	want := time.Date(2024, 1, 15, 10, 30, 45, 0, location)
+
+	for _, value := range []string{
+		"2024-01-15 10:30:45",
+		"2024-01-15T10:30:45",
+		"2024-01-15T10:30:45+09:00",
+		"2024-01-15T01:30:45Z",
+		"2024-01-15 10:30:45 +0900",
+	} {
+		got, err := ParseTimestamp(value, location)
+		if assert.NoError(t, err, value) {
+			assert.True(t, want.Equal(got), value)
+			assert.Equal(t, location, got.Location(), value)
+		}
+	}
+
+	_, err := ParseTimestamp("15/01/2024 10:30", location)
+	assert.Error(t, err)
+	_, err = ParseTimestamp("", location)
+	assert.Error(t, err)
+}
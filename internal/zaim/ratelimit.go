@@ -0,0 +1,114 @@
+package zaim
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimitExceeded は fail-fast 設定でクライアント側のレート制限に達した
+// ErrRateLimited としても判定される
+var ErrRateLimitExceeded = fmt.Errorf("%w: client-side limit exhausted", ErrRateLimited)
+
+// RateLimitReporter はクライアント側のレート制限で待った時間を報告する
+// TransactionFetcher の実装が任意で実装する（Client は実装、FixtureFetcher は未実装）
+type RateLimitReporter interface {
+	// RateLimitWaits は制限を通過したリクエスト数と待ち時間の合計を返す
+	// 制限が無効なら ok は false
+	RateLimitWaits() (count uint64, total time.Duration, ok bool)
+}
+
+var _ RateLimitReporter = (*Client)(nil)
+
+// WithRateLimit はすべてのリクエストをトークンバケット（毎秒 rps 個補充、最大 burst 個）に通す
+// rps が 0 以下なら制限しない。burst が 1 未満なら 1
+// バックグラウンド更新・手動更新・バックフィルなど呼び出し元に依らずまとめて抑える
+func WithRateLimit(rps float64, burst int) ClientOption {
+	return func(c *Client) {
+		if rps <= 0 {
+			c.limiter = nil
+			return
+		}
+		c.limiter = newRateLimiter(rps, max(burst, 1), func() time.Time { return c.now() })
+	}
+}
+
+// WithRateLimitFailFast は制限に達したとき待たずに ErrRateLimitExceeded を返す
+func WithRateLimitFailFast(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.rateLimitFailFast = enabled
+	}
+}
+
+func (c *Client) RateLimitWaits() (uint64, time.Duration, bool) {
+	if c.limiter == nil {
+		return 0, 0, false
+	}
+	count, total := c.limiter.stats()
+	return count, total, true
+}
+
+// rateLimiter は golang.org/x/time/rate のトークンバケットに待ち時間の集計を加える
+// 待つ場合は rate.Limiter.Wait と同じく予約して遅延だけ待つが、遅延を集計に使うため Reserve を直接使う
+type rateLimiter struct {
+	limiter *rate.Limiter
+	now     func() time.Time
+	after   func(time.Duration) <-chan time.Time
+
+	mu        sync.Mutex
+	count     uint64
+	totalWait time.Duration
+}
+
+func newRateLimiter(rps float64, burst int, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		limiter: rate.NewLimiter(rate.Limit(rps), burst),
+		now:     now,
+		after:   time.After,
+	}
+}
+
+// wait はトークンが使えるまで待つ。ctx が先に終われば予約を取り消す
+// failFast ならトークンがないとき待たずに ErrRateLimitExceeded を返す
+func (l *rateLimiter) wait(ctx context.Context, failFast bool) error {
+	now := l.now()
+	if failFast {
+		if !l.limiter.AllowN(now, 1) {
+			return ErrRateLimitExceeded
+		}
+		l.record(0)
+		return nil
+	}
+
+	reservation := l.limiter.ReserveN(now, 1)
+	delay := reservation.DelayFrom(now)
+	if delay <= 0 {
+		l.record(0)
+		return nil
+	}
+
+	select {
+	case <-l.after(delay):
+		l.record(delay)
+		return nil
+	case <-ctx.Done():
+		reservation.CancelAt(l.now())
+		return ctx.Err()
+	}
+}
+
+func (l *rateLimiter) record(wait time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	l.totalWait += wait
+}
+
+func (l *rateLimiter) stats() (uint64, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count, l.totalWait
+}
@@ -0,0 +1,73 @@
+package zaim
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RangeFetcher は期間を指定して取引データを取得できる fetcher
+// Client が実装し、取得期間（FetchWindow）の変更に使う
+type RangeFetcher interface {
+	GetTransactions(ctx context.Context, startDate, endDate time.Time) ([]Transaction, error)
+}
+
+var _ RangeFetcher = (*Client)(nil)
+
+// FetchWindow は取得する取引の期間
+// Days が 0 なら当月（月初〜月末）、正の値なら今日を含む直近 Days 日
+type FetchWindow struct {
+	Days int
+}
+
+// MonthWindow は当月を表す既定の取得期間
+var MonthWindow = FetchWindow{}
+
+// ParseFetchWindow は "month" または "30d" 形式の期間を解析する
+// 空文字列は month として扱う
+func ParseFetchWindow(value string) (FetchWindow, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "month" {
+		return MonthWindow, nil
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+	if !strings.HasSuffix(value, "d") || err != nil || days <= 0 {
+		return FetchWindow{}, fmt.Errorf("invalid fetch window %q (use \"month\" or a day count such as \"30d\")", value)
+	}
+	return FetchWindow{Days: days}, nil
+}
+
+// IsMonth は当月の期間かどうかを返す
+func (w FetchWindow) IsMonth() bool {
+	return w.Days == 0
+}
+
+// Range は now のタイムゾーンでの開始日と終了日を返す（いずれも 0 時）
+func (w FetchWindow) Range(now time.Time) (time.Time, time.Time) {
+	year, month, day := now.Date()
+	location := now.Location()
+
+	if w.IsMonth() {
+		return MonthRange(now, 0)
+	}
+
+	today := time.Date(year, month, day, 0, 0, 0, 0, location)
+	return today.AddDate(0, 0, -w.Days), today
+}
+
+// MonthRange は now から monthsAgo か月前の月初と月末を返す（0 なら当月）
+func MonthRange(now time.Time, monthsAgo int) (time.Time, time.Time) {
+	year, month, _ := now.Date()
+	startDate := time.Date(year, month-time.Month(monthsAgo), 1, 0, 0, 0, 0, now.Location())
+	return startDate, startDate.AddDate(0, 1, -1)
+}
+
+func (w FetchWindow) String() string {
+	if w.IsMonth() {
+		return "month"
+	}
+	return fmt.Sprintf("%dd", w.Days)
+}
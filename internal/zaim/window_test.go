@@ -0,0 +1,69 @@
+package zaim
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFetchWindow(t *testing.T) {
+	t.Run("既定は当月", func(t *testing.T) {
+		for _, value := range []string{"", "month"} {
+			window, err := ParseFetchWindow(value)
+			require.NoError(t, err)
+			assert.True(t, window.IsMonth())
+		}
+	})
+
+	t.Run("日数指定", func(t *testing.T) {
+		window, err := ParseFetchWindow("90d")
+		require.NoError(t, err)
+		assert.Equal(t, FetchWindow{Days: 90}, window)
+		assert.Equal(t, "90d", window.String())
+	})
+
+	t.Run("不正な値はエラー", func(t *testing.T) {
+		for _, value := range []string{"30", "0d", "-5d", "week", "d"} {
+			_, err := ParseFetchWindow(value)
+			assert.Error(t, err, value)
+		}
+	})
+}
+
+func TestFetchWindow_Range30Days(t *testing.T) {
+	// UTC では前日だが JST では 2024-03-01 の時刻
+	now := time.Date(2024, 2, 29, 16, 30, 0, 0, time.UTC).In(fallbackLocation)
+
+	window, err := ParseFetchWindow("30d")
+	require.NoError(t, err)
+	start, end := window.Range(now)
+
+	assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, fallbackLocation), start)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, fallbackLocation), end)
+	assert.Equal(t, 30*24*time.Hour, end.Sub(start))
+}
+
+func TestFetchWindow_RangeMonth(t *testing.T) {
+	now := time.Date(2024, 2, 10, 9, 0, 0, 0, fallbackLocation)
+
+	start, end := MonthWindow.Range(now)
+
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, fallbackLocation), start)
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, fallbackLocation), end)
+}
+
+func TestMonthRange_PriorMonths(t *testing.T) {
+	// 月末日でも前月へ正しく繰り下がる（3/31 → 2 月は 29 日まで）
+	now := time.Date(2024, 3, 31, 9, 0, 0, 0, fallbackLocation)
+
+	start, end := MonthRange(now, 1)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, fallbackLocation), start)
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, fallbackLocation), end)
+
+	// 年をまたぐ
+	start, end = MonthRange(now, 3)
+	assert.Equal(t, time.Date(2023, 12, 1, 0, 0, 0, 0, fallbackLocation), start)
+	assert.Equal(t, time.Date(2023, 12, 31, 0, 0, 0, 0, fallbackLocation), end)
+}